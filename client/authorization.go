@@ -0,0 +1,160 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// AuthorizationPlacement represents the enum for where an authorization is sent
+type AuthorizationPlacement string
+
+// Enum value for where an authorization is sent
+const (
+	InHeader AuthorizationPlacement = "header"
+	InQuery  AuthorizationPlacement = "query"
+	InCookie AuthorizationPlacement = "cookie"
+)
+
+//
+// Private constants
+//
+
+const apiKeyHeaderType = "APIKey"
+
+// NewAPIKey creates the api key authorization sent in the header, query parameter or cookie of the given name.
+// Several api keys can be added to the same client as long as their name, placement or host differ.
+func NewAPIKey(name string, in AuthorizationPlacement, token string) AuthorizationType {
+	authorizationType := APIKey
+	authorizationType.HeaderName = name
+	authorizationType.In = in
+	authorizationType.Token = token
+
+	return authorizationType
+}
+
+// sameAs reports whether the authorization replaces the other one when added to the client.
+// API keys are replaced only by the key of the same name, placement and host, the other types by their type.
+func (a AuthorizationType) sameAs(other AuthorizationType) bool {
+	if a.HeaderType != other.HeaderType {
+		return false
+	}
+	if a.HeaderType != apiKeyHeaderType {
+		return true
+	}
+
+	return a.HeaderName == other.HeaderName && a.placement() == other.placement() && strings.EqualFold(a.Host, other.Host)
+}
+
+// placement returns where the authorization is sent, in a header by default
+func (a AuthorizationType) placement() AuthorizationPlacement {
+	if a.In == "" {
+		return InHeader
+	}
+
+	return a.In
+}
+
+// appliesTo reports whether the authorization is sent to the host of the url
+func (a AuthorizationType) appliesTo(u *url.URL) bool {
+	if a.Host == "" {
+		return true
+	}
+	if u == nil {
+		return false
+	}
+
+	return strings.EqualFold(a.Host, u.Host) || strings.EqualFold(a.Host, u.Hostname())
+}
+
+// value returns the value of the authorization as sent in a header
+func (a AuthorizationType) value() string {
+	return fmt.Sprintf("%s%s", a.HeaderTypeValue, a.Token)
+}
+
+// authentication adds the registered authorizations to the call, in its headers, query or cookies
+func (c *HTTPClient) authentication() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) *ResponseError {
+			u, err := url.Parse(call.URL)
+			if err != nil {
+				u = nil
+			}
+
+			queryChanged := false
+			for _, authorizationType := range c.authorizationTypes() {
+				if !authorizationType.appliesTo(u) {
+					continue
+				}
+
+				switch authorizationType.placement() {
+				case InQuery:
+					if u == nil {
+						continue
+					}
+					query := u.Query()
+					query.Set(authorizationType.HeaderName, authorizationType.Token)
+					u.RawQuery = query.Encode()
+					queryChanged = true
+				case InCookie:
+					cookie := (&http.Cookie{Name: authorizationType.HeaderName, Value: authorizationType.Token}).String()
+					if existing := call.Header.Get("Cookie"); existing != "" {
+						cookie = existing + "; " + cookie
+					}
+					call.Header.Set("Cookie", cookie)
+				default:
+					if authorizationType.HeaderType == apiKeyHeaderType {
+						call.Header.Set(authorizationType.HeaderName, authorizationType.value())
+						continue
+					}
+					call.Header.Add(authorizationType.HeaderName, authorizationType.value())
+				}
+			}
+			if queryChanged {
+				call.URL = u.String()
+			}
+
+			return next(ctx, call)
+		}
+	}
+}
+
+// authorizationValue returns the value of the authorization found in the call
+func authorizationValue(call *Call, authorizationType AuthorizationType) string {
+	switch authorizationType.placement() {
+	case InQuery:
+		u, err := url.Parse(call.URL)
+		if err != nil {
+			return ""
+		}
+		return u.Query().Get(authorizationType.HeaderName)
+	case InCookie:
+		cookie, err := (&http.Request{Header: call.Header}).Cookie(authorizationType.HeaderName)
+		if err != nil {
+			return ""
+		}
+		return cookie.Value
+	}
+
+	return call.Header.Get(authorizationType.HeaderName)
+}
+
+// AuthorizationQueryParams returns the names of the query parameters carrying the authorizations of the client,
+// e.g. to redact them from the recorded requests
+func (c *HTTPClient) AuthorizationQueryParams() []string {
+	return c.authorizationQueryParams()
+}
+
+// authorizationQueryParams returns the names of the query parameters carrying authorizations
+func (c *HTTPClient) authorizationQueryParams() []string {
+	params := []string{}
+	for _, authorizationType := range c.authorizationTypes() {
+		if authorizationType.placement() == InQuery {
+			params = append(params, authorizationType.HeaderName)
+		}
+	}
+
+	return params
+}
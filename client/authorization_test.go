@@ -0,0 +1,143 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestAPIKey(t *testing.T) {
+	tests := []struct {
+		name               string
+		authorizationTypes []AuthorizationType
+		wantSent           map[string]string
+	}{
+		{
+			name:               "header",
+			authorizationTypes: []AuthorizationType{NewAPIKey("X-Api-Key", InHeader, "header-key")},
+			wantSent:           map[string]string{"header X-Api-Key": "header-key"},
+		},
+		{
+			name:               "query",
+			authorizationTypes: []AuthorizationType{NewAPIKey("key", InQuery, "query-key")},
+			wantSent:           map[string]string{"query key": "query-key", "query page": "2"},
+		},
+		{
+			name:               "cookie",
+			authorizationTypes: []AuthorizationType{NewAPIKey("session", InCookie, "cookie-key")},
+			wantSent:           map[string]string{"cookie session": "cookie-key"},
+		},
+		{
+			name: "keys of several upstreams",
+			authorizationTypes: []AuthorizationType{
+				NewAPIKey("X-Api-Key", InHeader, "header-key"),
+				NewAPIKey("key", InQuery, "query-key"),
+				NewAPIKey("session", InCookie, "cookie-key"),
+				NewAPIKey("tracking", InCookie, "other-cookie-key"),
+			},
+			wantSent: map[string]string{
+				"header X-Api-Key": "header-key",
+				"query key":        "query-key",
+				"cookie session":   "cookie-key",
+				"cookie tracking":  "other-cookie-key",
+			},
+		},
+		{
+			name: "key of another host",
+			authorizationTypes: []AuthorizationType{func() AuthorizationType {
+				apiKey := NewAPIKey("X-Api-Key", InHeader, "other-key")
+				apiKey.Host = "other.local"
+				return apiKey
+			}()},
+			wantSent: map[string]string{"header X-Api-Key": ""},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sent := []*http.Request{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				sent = append(sent, r)
+				_, _ = w.Write([]byte(`{}`))
+			}))
+			defer server.Close()
+
+			client := newTestClient(t, server.URL, HTTPClient{AuthorizationTypes: test.authorizationTypes, Cache: NewLRUCache(10, 0)})
+			ctx := context.Background()
+			_ = client.CallClient(ctx, "drugs?page=2", GET, nil, nil, false)
+			_ = client.CallClientWithCachingInRedis(ctx, 60, "drugs?page=2", GET, nil, nil, false)
+			_ = client.CallClientWithCachingInRedisWithDifferentKey(ctx, 60, "drugs?page=2", "drugs", GET, nil, nil, false)
+			_ = client.CallClientWithCircuitBreaker(ctx, "drugs?page=2", GET, nil, nil, false)
+			_ = client.CallClientWithBaseURLGiven(ctx, server.URL+"/drugs?page=2", GET, nil, nil, false)
+			_ = client.CallClientWithRequestInBytes(ctx, "drugs?page=2", GET, nil, nil)
+
+			if len(sent) != 6 {
+				t.Fatalf("upstream called %d times, want 6", len(sent))
+			}
+			for i, r := range sent {
+				for name, want := range test.wantSent {
+					var got string
+					placement, key, _ := strings.Cut(name, " ")
+					switch AuthorizationPlacement(placement) {
+					case InHeader:
+						got = r.Header.Get(key)
+					case InQuery:
+						got = r.URL.Query().Get(key)
+					case InCookie:
+						if cookie, err := r.Cookie(key); err == nil {
+							got = cookie.Value
+						}
+					}
+					if got != want {
+						t.Errorf("call %d sent the %s %q, want %q", i, name, got, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestAuthorizationTypeSameAs(t *testing.T) {
+	tests := []struct {
+		name string
+		a    AuthorizationType
+		b    AuthorizationType
+		want bool
+	}{
+		{name: "same type", a: Bearer, b: Bearer, want: true},
+		{name: "different types", a: Bearer, b: Basic},
+		{name: "same api key", a: NewAPIKey("key", InQuery, "a"), b: NewAPIKey("key", InQuery, "b"), want: true},
+		{name: "api keys of different names", a: NewAPIKey("key", InQuery, "a"), b: NewAPIKey("token", InQuery, "b")},
+		{name: "api keys of different placements", a: NewAPIKey("key", InQuery, "a"), b: NewAPIKey("key", InCookie, "b")},
+		{name: "api key in header by default", a: NewAPIKey("key", "", "a"), b: NewAPIKey("key", InHeader, "b"), want: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.a.sameAs(test.b); got != test.want {
+				t.Errorf("sameAs = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizationQueryParams(t *testing.T) {
+	client := HTTPClient{AuthorizationTypes: []AuthorizationType{
+		Bearer,
+		NewAPIKey("key", InQuery, "a"),
+		NewAPIKey("session", InCookie, "b"),
+	}}
+
+	params := client.AuthorizationQueryParams()
+	if len(params) != 1 || params[0] != "key" {
+		t.Errorf("params = %v, want [key]", params)
+	}
+
+	query := url.Values{"key": {"a"}, "page": {"2"}}
+	if got := stripQueryParams("drugs?"+query.Encode(), params); got != "drugs?page=2" {
+		t.Errorf("stripped path = %q", got)
+	}
+}
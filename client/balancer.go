@@ -0,0 +1,406 @@
+package client
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BalancingStrategy represents the enum for the selection of the endpoint of an attempt
+type BalancingStrategy string
+
+// Enum value for balancing strategy
+const (
+	RoundRobin       BalancingStrategy = "round_robin"
+	LeastOutstanding BalancingStrategy = "least_outstanding"
+	Weighted         BalancingStrategy = "weighted"
+)
+
+//
+// Private constants
+//
+
+const defaultMaxEndpointFailures = 5
+const defaultEjectionDuration = 30 * time.Second
+const defaultHedgingPercentile = 0.95
+const defaultHedgingMinDelay = 10 * time.Millisecond
+
+// hedgingLatencyWindow is the number of recent latencies the hedging percentile is computed from
+const hedgingLatencyWindow = 256
+
+// hedgingMinLatencies is the number of latencies known before the calls are hedged
+const hedgingMinLatencies = 20
+
+// LoadBalancingConfig represents the endpoints of a replicated upstream, zero values fall back to the defaults.
+//
+// The calls whose url starts with the APIURL of the client are sent to one of the endpoints, every attempt selecting
+// an endpoint again so that a retry can reach another replica. An endpoint failing MaxFailures times in a row,
+// with a transport error or a 5xx response, is ejected for EjectionDuration; the ejected endpoints are only used
+// when all the endpoints are ejected.
+type LoadBalancingConfig struct {
+	// Endpoints are the base urls of the replicas, the APIURL of the client is the first one when empty
+	Endpoints []Endpoint
+	// Strategy selects the endpoint of an attempt, RoundRobin by default
+	Strategy BalancingStrategy
+	// MaxFailures is the number of consecutive failures ejecting an endpoint, 5 by default
+	MaxFailures int
+	// EjectionDuration is how long an endpoint is ejected, 30s by default
+	EjectionDuration time.Duration
+	// Hedging sends hedged requests for the slow GET calls when given
+	Hedging *HedgingConfig
+}
+
+// Endpoint represents a base url of a replicated upstream
+type Endpoint struct {
+	URL string
+	// Weight is the share of the calls of the endpoint with the Weighted strategy, 1 by default
+	Weight int
+}
+
+// HedgingConfig represents the hedged requests of the GET calls, zero values fall back to the defaults.
+//
+// A GET attempt without response after the latency percentile of the recent attempts is sent once again to another
+// endpoint, the first response which is not a 5xx wins and the others are canceled.
+// The calls are hedged once enough latencies are known.
+type HedgingConfig struct {
+	// Percentile is the latency percentile after which a hedged request is sent, 0.95 by default
+	Percentile float64
+	// MinDelay is the min delay before a hedged request, 10ms by default
+	MinDelay time.Duration
+	// MaxHedges is the max number of hedged requests of an attempt, 1 by default
+	MaxHedges int
+}
+
+// endpoint represents the state of an endpoint of the balancer
+type endpoint struct {
+	url          string
+	weight       int
+	current      int
+	outstanding  int
+	failures     int
+	ejectedUntil time.Time
+}
+
+// balancer selects the endpoints of the attempts and tracks their health and latencies
+type balancer struct {
+	mutex     sync.Mutex
+	config    LoadBalancingConfig
+	apiURL    *url.URL
+	endpoints []*endpoint
+	next      int
+	latencies []time.Duration
+	position  int
+}
+
+// hedgeResult represents the outcome of an attempt sent by the hedging
+type hedgeResult struct {
+	res    *http.Response
+	err    error
+	cancel context.CancelFunc
+}
+
+// newBalancer creates the balancer of the load balancing config
+func newBalancer(apiURL string, config LoadBalancingConfig) *balancer {
+	if len(config.Endpoints) == 0 {
+		config.Endpoints = []Endpoint{{URL: apiURL}}
+	}
+	if config.Strategy == "" {
+		config.Strategy = RoundRobin
+	}
+	if config.MaxFailures == 0 {
+		config.MaxFailures = defaultMaxEndpointFailures
+	}
+	if config.EjectionDuration == 0 {
+		config.EjectionDuration = defaultEjectionDuration
+	}
+	if config.Hedging != nil {
+		hedging := *config.Hedging
+		if hedging.Percentile == 0 {
+			hedging.Percentile = defaultHedgingPercentile
+		}
+		if hedging.MinDelay == 0 {
+			hedging.MinDelay = defaultHedgingMinDelay
+		}
+		if hedging.MaxHedges == 0 {
+			hedging.MaxHedges = 1
+		}
+		config.Hedging = &hedging
+	}
+
+	endpoints := make([]*endpoint, 0, len(config.Endpoints))
+	for _, e := range config.Endpoints {
+		weight := e.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		endpoints = append(endpoints, &endpoint{
+			url:    strings.TrimSuffix(e.URL, "/"),
+			weight: weight,
+		})
+	}
+
+	// an api url which cannot be parsed matches no request, which are then sent as they are
+	parsedAPIURL, _ := url.Parse(strings.TrimSuffix(apiURL, "/"))
+
+	return &balancer{
+		config:    config,
+		apiURL:    parsedAPIURL,
+		endpoints: endpoints,
+	}
+}
+
+// relativeURL returns the path and query of the url following the api url,
+// false when the url is not on the scheme and host of the api url or not under its path
+func (b *balancer) relativeURL(u *url.URL) (string, bool) {
+	if b.apiURL == nil || !strings.EqualFold(u.Scheme, b.apiURL.Scheme) || !strings.EqualFold(u.Host, b.apiURL.Host) {
+		return "", false
+	}
+
+	apiPath := strings.TrimSuffix(b.apiURL.EscapedPath(), "/")
+	path := u.EscapedPath()
+	if path != apiPath && !strings.HasPrefix(path, apiPath+"/") {
+		return "", false
+	}
+
+	relative := strings.TrimPrefix(path, apiPath)
+	if u.RawQuery != "" {
+		relative += "?" + u.RawQuery
+	}
+
+	return relative, true
+}
+
+// sendToEndpoint sends the attempt to an endpoint of the balancer when the client balances its calls
+func (c *HTTPClient) sendToEndpoint(req *http.Request, retry int) (*http.Response, error) {
+	if c.balancer == nil {
+		return c.sendAttempt(req, retry)
+	}
+	if _, ok := c.balancer.relativeURL(req.URL); !ok {
+		return c.sendAttempt(req, retry)
+	}
+
+	if c.balancer.config.Hedging != nil && req.Method == http.MethodGet && (req.Body == nil || req.Body == http.NoBody) {
+		if delay, ok := c.balancer.hedgingDelay(); ok {
+			return c.sendHedged(req, retry, delay)
+		}
+	}
+
+	return c.sendTo(req.Context(), req, retry, c.balancer.pick(nil))
+}
+
+// sendTo sends the attempt to the endpoint and records its outcome
+func (c *HTTPClient) sendTo(ctx context.Context, req *http.Request, retry int, e *endpoint) (*http.Response, error) {
+	relative, _ := c.balancer.relativeURL(req.URL)
+	target, err := url.Parse(e.url + relative)
+	if err != nil {
+		return nil, err
+	}
+
+	attempt := req.Clone(ctx)
+	attempt.URL = target
+	attempt.Host = ""
+
+	c.balancer.begin(e)
+	start := time.Now()
+	res, err := c.sendAttempt(attempt, retry)
+	c.balancer.end(e, time.Since(start), res, err, ctx.Err() != nil)
+
+	return res, err
+}
+
+// sendHedged sends the attempt and hedges it to other endpoints when it is slower than the delay
+func (c *HTTPClient) sendHedged(req *http.Request, retry int, delay time.Duration) (*http.Response, error) {
+	hedging := c.balancer.config.Hedging
+	results := make(chan hedgeResult, hedging.MaxHedges+1)
+	tried := map[*endpoint]bool{}
+
+	launch := func() {
+		e := c.balancer.pick(tried)
+		tried[e] = true
+
+		ctx, cancel := context.WithCancel(req.Context())
+		go func() {
+			res, err := c.sendTo(ctx, req, retry, e)
+			results <- hedgeResult{res: res, err: err, cancel: cancel}
+		}()
+	}
+
+	launch()
+	pending, hedges := 1, 0
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var last hedgeResult
+	for {
+		select {
+		case <-timer.C:
+			if hedges < hedging.MaxHedges {
+				launch()
+				pending++
+				hedges++
+				timer.Reset(delay)
+			}
+			continue
+		case result := <-results:
+			pending--
+			if result.err == nil && result.res.StatusCode < 500 || pending == 0 {
+				if last.cancel != nil {
+					discardBody(last.res)
+					last.cancel()
+				}
+				go drainHedges(results, pending)
+				return winner(result)
+			}
+
+			if last.cancel != nil {
+				discardBody(last.res)
+				last.cancel()
+			}
+			last = result
+			if hedges < hedging.MaxHedges {
+				launch()
+				pending++
+				hedges++
+				timer.Reset(delay)
+			}
+		}
+	}
+}
+
+// winner returns the response of the hedged attempt, its context is canceled once its body is closed
+func winner(result hedgeResult) (*http.Response, error) {
+	if result.err != nil {
+		result.cancel()
+		return nil, result.err
+	}
+
+	result.res.Body = &cancelOnClose{ReadCloser: result.res.Body, cancel: result.cancel}
+	return result.res, nil
+}
+
+// drainHedges cancels the hedged attempts which lost and discards their responses
+func drainHedges(results chan hedgeResult, pending int) {
+	for ; pending > 0; pending-- {
+		result := <-results
+		discardBody(result.res)
+		result.cancel()
+	}
+}
+
+// pick selects an endpoint following the strategy, preferring the ones neither ejected nor excluded
+func (b *balancer) pick(excluded map[*endpoint]bool) *endpoint {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := time.Now()
+	candidates := []*endpoint{}
+	for _, e := range b.endpoints {
+		if !excluded[e] && !now.Before(e.ejectedUntil) {
+			candidates = append(candidates, e)
+		}
+	}
+	if len(candidates) == 0 {
+		for _, e := range b.endpoints {
+			if !excluded[e] {
+				candidates = append(candidates, e)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		candidates = b.endpoints
+	}
+
+	start := b.next % len(candidates)
+	b.next++
+
+	switch b.config.Strategy {
+	case LeastOutstanding:
+		selected := candidates[start]
+		for i := 1; i < len(candidates); i++ {
+			if e := candidates[(start+i)%len(candidates)]; e.outstanding < selected.outstanding {
+				selected = e
+			}
+		}
+		return selected
+	case Weighted:
+		// smooth weighted round robin
+		total := 0
+		var selected *endpoint
+		for _, e := range candidates {
+			e.current += e.weight
+			total += e.weight
+			if selected == nil || e.current > selected.current {
+				selected = e
+			}
+		}
+		selected.current -= total
+		return selected
+	}
+
+	return candidates[start]
+}
+
+// begin counts the attempt as outstanding
+func (b *balancer) begin(e *endpoint) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	e.outstanding++
+}
+
+// end records the outcome of the attempt, the canceled attempts do not count as failures
+func (b *balancer) end(e *endpoint, latency time.Duration, res *http.Response, err error, canceled bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	e.outstanding--
+	if canceled {
+		return
+	}
+
+	if err != nil || res.StatusCode >= 500 {
+		e.failures++
+		if e.failures >= b.config.MaxFailures {
+			e.failures = 0
+			e.ejectedUntil = time.Now().Add(b.config.EjectionDuration)
+		}
+		return
+	}
+	e.failures = 0
+
+	if len(b.latencies) < hedgingLatencyWindow {
+		b.latencies = append(b.latencies, latency)
+		return
+	}
+	b.latencies[b.position] = latency
+	b.position = (b.position + 1) % hedgingLatencyWindow
+}
+
+// hedgingDelay returns the latency percentile of the recent attempts, false while too few are known
+func (b *balancer) hedgingDelay() (time.Duration, bool) {
+	b.mutex.Lock()
+	if len(b.latencies) < hedgingMinLatencies {
+		b.mutex.Unlock()
+		return 0, false
+	}
+	latencies := append([]time.Duration{}, b.latencies...)
+	b.mutex.Unlock()
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	index := int(math.Ceil(b.config.Hedging.Percentile*float64(len(latencies)))) - 1
+	if index < 0 {
+		index = 0
+	}
+
+	delay := latencies[index]
+	if delay < b.config.Hedging.MinDelay {
+		delay = b.config.Hedging.MinDelay
+	}
+
+	return delay, true
+}
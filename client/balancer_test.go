@@ -0,0 +1,282 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBalancerRelativeURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		apiURL string
+		url    string
+		want   string
+		wantOK bool
+	}{
+		{name: "path under the api url", apiURL: "http://api.local/v1", url: "http://api.local/v1/drugs", want: "/drugs", wantOK: true},
+		{name: "query kept", apiURL: "http://api.local/v1/", url: "http://api.local/v1/drugs?page=2", want: "/drugs?page=2", wantOK: true},
+		{name: "api url itself", apiURL: "http://api.local/v1", url: "http://api.local/v1", want: "", wantOK: true},
+		{name: "host case insensitive", apiURL: "http://API.local", url: "http://api.LOCAL/drugs", want: "/drugs", wantOK: true},
+		{name: "escaped path", apiURL: "http://api.local", url: "http://api.local/drugs/a%2Fb", want: "/drugs/a%2Fb", wantOK: true},
+		{name: "path sharing the prefix", apiURL: "http://api.local/v1", url: "http://api.local/v10/drugs"},
+		{name: "other path", apiURL: "http://api.local/v1", url: "http://api.local/v2/drugs"},
+		{name: "other host", apiURL: "http://api.local", url: "http://other.local/drugs"},
+		{name: "other port", apiURL: "http://api.local:8080", url: "http://api.local:8081/drugs"},
+		{name: "other scheme", apiURL: "http://api.local", url: "https://api.local/drugs"},
+		{name: "invalid api url", apiURL: "http://api.local/%zz", url: "http://api.local/drugs"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u, err := url.Parse(test.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			relative, ok := newBalancer(test.apiURL, LoadBalancingConfig{}).relativeURL(u)
+			if ok != test.wantOK || relative != test.want {
+				t.Errorf("relativeURL = %q, %t, want %q, %t", relative, ok, test.want, test.wantOK)
+			}
+		})
+	}
+}
+
+func TestBalancerPick(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      LoadBalancingConfig
+		outstanding []int
+		ejected     []bool
+		picks       int
+		want        []string
+	}{
+		{
+			name:   "round robin",
+			config: LoadBalancingConfig{Endpoints: []Endpoint{{URL: "a"}, {URL: "b"}, {URL: "c"}}},
+			picks:  4,
+			want:   []string{"a", "b", "c", "a"},
+		},
+		{
+			name:    "ejected endpoints skipped",
+			config:  LoadBalancingConfig{Endpoints: []Endpoint{{URL: "a"}, {URL: "b"}}},
+			ejected: []bool{true, false},
+			picks:   3,
+			want:    []string{"b", "b", "b"},
+		},
+		{
+			name:    "ejected endpoints used when all are ejected",
+			config:  LoadBalancingConfig{Endpoints: []Endpoint{{URL: "a"}, {URL: "b"}}},
+			ejected: []bool{true, true},
+			picks:   2,
+			want:    []string{"a", "b"},
+		},
+		{
+			name:   "weighted",
+			config: LoadBalancingConfig{Strategy: Weighted, Endpoints: []Endpoint{{URL: "a", Weight: 3}, {URL: "b"}}},
+			picks:  4,
+			want:   []string{"a", "a", "b", "a"},
+		},
+		{
+			name:        "least outstanding",
+			config:      LoadBalancingConfig{Strategy: LeastOutstanding, Endpoints: []Endpoint{{URL: "a"}, {URL: "b"}, {URL: "c"}}},
+			outstanding: []int{2, 0, 1},
+			picks:       2,
+			want:        []string{"b", "b"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			balancer := newBalancer("http://api.local", test.config)
+			for i, outstanding := range test.outstanding {
+				balancer.endpoints[i].outstanding = outstanding
+			}
+			for i, ejected := range test.ejected {
+				if ejected {
+					balancer.endpoints[i].ejectedUntil = time.Now().Add(time.Minute)
+				}
+			}
+
+			picks := []string{}
+			for i := 0; i < test.picks; i++ {
+				picks = append(picks, balancer.pick(nil).url)
+			}
+			for i := range test.want {
+				if picks[i] != test.want[i] {
+					t.Fatalf("picks = %v, want %v", picks, test.want)
+				}
+			}
+		})
+	}
+}
+
+// endpointServer counts the requests of an endpoint and answers them with its status
+type endpointServer struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	requests []string
+}
+
+func newEndpointServer(t *testing.T, status int) *endpointServer {
+	t.Helper()
+
+	server := &endpointServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.mutex.Lock()
+		server.requests = append(server.requests, r.URL.RequestURI())
+		server.mutex.Unlock()
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func (s *endpointServer) count() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.requests)
+}
+
+func TestLoadBalancing(t *testing.T) {
+	t.Run("calls spread over the endpoints", func(t *testing.T) {
+		replica1, replica2 := newEndpointServer(t, http.StatusOK), newEndpointServer(t, http.StatusOK)
+		client := newTestClient(t, "http://api.local/v1", HTTPClient{
+			LoadBalancing: &LoadBalancingConfig{Endpoints: []Endpoint{{URL: replica1.URL}, {URL: replica2.URL}}},
+		})
+
+		for i := 0; i < 4; i++ {
+			if err := client.CallClient(context.Background(), "drugs?page=1", GET, nil, nil, false).Err(); err != nil {
+				t.Fatalf("error = %v", err)
+			}
+		}
+
+		if replica1.count() != 2 || replica2.count() != 2 {
+			t.Errorf("requests = %d and %d, want 2 and 2", replica1.count(), replica2.count())
+		}
+		if replica1.requests[0] != "/drugs?page=1" {
+			t.Errorf("request = %q, want /drugs?page=1", replica1.requests[0])
+		}
+	})
+
+	t.Run("calls outside the api url sent as they are", func(t *testing.T) {
+		replica, other := newEndpointServer(t, http.StatusOK), newEndpointServer(t, http.StatusOK)
+		client := newTestClient(t, "http://api.local", HTTPClient{
+			LoadBalancing: &LoadBalancingConfig{Endpoints: []Endpoint{{URL: replica.URL}}},
+		})
+
+		if err := client.CallClientWithBaseURLGiven(context.Background(), other.URL+"/drugs", GET, nil, nil, false).Err(); err != nil {
+			t.Fatalf("error = %v", err)
+		}
+		if replica.count() != 0 || other.count() != 1 {
+			t.Errorf("requests = %d to the replica and %d to the url, want 0 and 1", replica.count(), other.count())
+		}
+	})
+
+	t.Run("failing endpoint retried on another and ejected", func(t *testing.T) {
+		failing, healthy := newEndpointServer(t, http.StatusServiceUnavailable), newEndpointServer(t, http.StatusOK)
+		client := newTestClient(t, "http://api.local", HTTPClient{
+			RetryPolicy: &RetryPolicy{MaxRetries: 1, MinDelay: time.Millisecond, MaxDelay: time.Millisecond},
+			LoadBalancing: &LoadBalancingConfig{
+				Endpoints:   []Endpoint{{URL: failing.URL}, {URL: healthy.URL}},
+				MaxFailures: 1,
+			},
+		})
+
+		for i := 0; i < 3; i++ {
+			if err := client.CallClient(context.Background(), "drugs", GET, nil, nil, false).Err(); err != nil {
+				t.Fatalf("call %d error = %v", i, err)
+			}
+		}
+
+		if failing.count() != 1 || healthy.count() != 3 {
+			t.Errorf("requests = %d to the failing endpoint and %d to the healthy one, want 1 and 3", failing.count(), healthy.count())
+		}
+	})
+
+	t.Run("unreachable endpoint retried on another", func(t *testing.T) {
+		unreachable, healthy := newEndpointServer(t, http.StatusOK), newEndpointServer(t, http.StatusOK)
+		unreachable.Close()
+		client := newTestClient(t, "http://api.local", HTTPClient{
+			RetryPolicy:   &RetryPolicy{MaxRetries: 1, MinDelay: time.Millisecond, MaxDelay: time.Millisecond},
+			LoadBalancing: &LoadBalancingConfig{Endpoints: []Endpoint{{URL: unreachable.URL}, {URL: healthy.URL}}},
+		})
+
+		if err := client.CallClient(context.Background(), "drugs", GET, nil, nil, false).Err(); err != nil {
+			t.Fatalf("error = %v", err)
+		}
+		if healthy.count() != 1 {
+			t.Errorf("requests = %d to the healthy endpoint, want 1", healthy.count())
+		}
+	})
+}
+
+func TestHedging(t *testing.T) {
+	canceled := make(chan struct{})
+	once := sync.Once{}
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			once.Do(func() { close(canceled) })
+		case <-time.After(2 * time.Second):
+		}
+	}))
+	defer slow.Close()
+	fast := newEndpointServer(t, http.StatusOK)
+
+	client := newTestClient(t, "http://api.local", HTTPClient{
+		LoadBalancing: &LoadBalancingConfig{
+			Endpoints: []Endpoint{{URL: slow.URL}, {URL: fast.URL}},
+			Hedging:   &HedgingConfig{MinDelay: 20 * time.Millisecond},
+		},
+	})
+	// the calls are hedged once enough latencies are known
+	for i := 0; i < hedgingMinLatencies; i++ {
+		client.balancer.latencies = append(client.balancer.latencies, time.Millisecond)
+	}
+
+	tests := []struct {
+		name       string
+		method     Method
+		wantHedged bool
+	}{
+		{name: "slow GET hedged", method: GET, wantHedged: true},
+		{name: "POST never hedged", method: POST},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+			defer cancel()
+			// the slow endpoint is picked first
+			client.balancer.mutex.Lock()
+			client.balancer.next = 0
+			client.balancer.mutex.Unlock()
+			sent := fast.count()
+
+			err := client.CallClient(ctx, "drugs", test.method, nil, nil, false).Err()
+			if hedged := fast.count() > sent; hedged != test.wantHedged {
+				t.Fatalf("hedged = %t, want %t", hedged, test.wantHedged)
+			}
+			if !test.wantHedged {
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			select {
+			case <-canceled:
+			case <-time.After(time.Second):
+				t.Errorf("slow attempt not canceled once the hedged request won")
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/afex/hystrix-go/hystrix"
+	metricCollector "github.com/afex/hystrix-go/hystrix/metric_collector"
+)
+
+// CodeCircuitBreakerRejected is the code of the response error returned when the circuit breaker rejects a call
+const CodeCircuitBreakerRejected = "Circuit Breaker Rejected"
+
+//
+// Private constants
+//
+
+const defaultCircuitBreakerTimeout = 5000
+const defaultCircuitBreakerMaxConcurrentRequests = 100
+const defaultCircuitBreakerErrorPercentThreshold = 20
+
+// CircuitBreakerFallback is called when the call failed or was rejected by the circuit breaker.
+// It may fill call.Response, which is then decoded into the call result, and returns the final error of the call.
+type CircuitBreakerFallback func(ctx context.Context, call *Call, errDo *ResponseError) *ResponseError
+
+// CircuitBreakerConfig represents the hystrix configuration of the client, zero values fall back to the defaults
+type CircuitBreakerConfig struct {
+	// Timeout is the max duration of a call in milliseconds, 5000 by default
+	Timeout int
+	// MaxConcurrentRequests is the max number of concurrent calls, 100 by default
+	MaxConcurrentRequests int
+	// RequestVolumeThreshold is the min number of calls before the circuit can be opened, hystrix default by default
+	RequestVolumeThreshold int
+	// SleepWindow is the duration in milliseconds to wait once opened before testing the upstream, hystrix default by default
+	SleepWindow int
+	// ErrorPercentThreshold is the percentage of failed calls opening the circuit, 20 by default
+	ErrorPercentThreshold int
+	// Fallback is called when the call failed or was rejected
+	Fallback CircuitBreakerFallback
+}
+
+// CircuitBreakerState represents the enum for the state of the circuit breaker
+type CircuitBreakerState string
+
+// Enum value for the state of the circuit breaker
+const (
+	CircuitBreakerClosed   CircuitBreakerState = "closed"
+	CircuitBreakerOpen     CircuitBreakerState = "open"
+	CircuitBreakerHalfOpen CircuitBreakerState = "half-open"
+)
+
+// CircuitBreakerStatus represents the state of the circuit breaker and its counts since the circuit was last closed
+type CircuitBreakerStatus struct {
+	Name              string              `json:"name"`
+	State             CircuitBreakerState `json:"state"`
+	Attempts          int64               `json:"attempts"`
+	Successes         int64               `json:"successes"`
+	Failures          int64               `json:"failures"`
+	Rejects           int64               `json:"rejects"`
+	ShortCircuits     int64               `json:"shortCircuits"`
+	Timeouts          int64               `json:"timeouts"`
+	FallbackSuccesses int64               `json:"fallbackSuccesses"`
+	FallbackFailures  int64               `json:"fallbackFailures"`
+	ConcurrencyInUse  float64             `json:"concurrencyInUse"`
+}
+
+//
+// Private variables
+//
+
+var breakerCollectorsMutex = &sync.RWMutex{}
+var breakerCollectors = map[string]*breakerCollector{}
+
+func init() {
+	metricCollector.Registry.Register(newBreakerCollector)
+}
+
+// configureCircuitBreaker applies the circuit breaker config to the hystrix command of the client
+func configureCircuitBreaker(name string, config CircuitBreakerConfig) {
+	if config.Timeout == 0 {
+		config.Timeout = defaultCircuitBreakerTimeout
+	}
+	if config.MaxConcurrentRequests == 0 {
+		config.MaxConcurrentRequests = defaultCircuitBreakerMaxConcurrentRequests
+	}
+	if config.ErrorPercentThreshold == 0 {
+		config.ErrorPercentThreshold = defaultCircuitBreakerErrorPercentThreshold
+	}
+
+	hystrix.ConfigureCommand(name, hystrix.CommandConfig{
+		Timeout:                config.Timeout,
+		MaxConcurrentRequests:  config.MaxConcurrentRequests,
+		RequestVolumeThreshold: config.RequestVolumeThreshold,
+		SleepWindow:            config.SleepWindow,
+		ErrorPercentThreshold:  config.ErrorPercentThreshold,
+	})
+}
+
+// circuitBreaker runs the call inside the hystrix command of the client.
+//
+// The call runs on a copy without the result of the caller, decoded into it only once the call completed,
+// so that a call abandoned by hystrix (timeout) never races with the caller or its fallback.
+func (c *HTTPClient) circuitBreaker() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) *ResponseError {
+			result := make(chan *ResponseError, 1)
+			attempt := detachedCall(call)
+
+			errHystrix := hystrix.DoC(ctx, c.ClientName, func(ctx context.Context) error {
+				errDo := next(ctx, attempt)
+				result <- errDo
+				// the calls rejected by the rate limits never reached the upstream
+				if isFailure(errDo) && errDo.Code != CodeRateLimited {
+					return &CallError{Response: errDo}
+				}
+				return nil
+			}, nil)
+
+			var errDo *ResponseError
+			select {
+			case errDo = <-result:
+				attempt.Result = call.Result
+				attempt.options.metadata = call.options.metadata
+				*call = *attempt
+				if !isFailure(errDo) {
+					if err := call.decode(); err != nil {
+						return &ResponseError{
+							Error: err,
+						}
+					}
+					return errDo
+				}
+			default:
+				errDo = c.circuitBreakerError(errHystrix)
+			}
+
+			if c.CircuitBreaker == nil || c.CircuitBreaker.Fallback == nil {
+				return errDo
+			}
+
+			call.Response = ""
+			errDo = c.CircuitBreaker.Fallback(ctx, call, errDo)
+			if isFailure(errDo) {
+				return errDo
+			}
+			if err := call.decode(); err != nil {
+				return &ResponseError{
+					Error: err,
+				}
+			}
+
+			return errDo
+		}
+	}
+}
+
+// circuitBreakerError converts the error returned by hystrix for a call which did not complete
+func (c *HTTPClient) circuitBreakerError(err error) *ResponseError {
+	var circuitError hystrix.CircuitError
+	if !errors.As(err, &circuitError) {
+		return &ResponseError{
+			Message: "Error while calling",
+			Error:   err,
+			Info:    fmt.Sprintf("Error when calling [%s]", c.APIURL),
+		}
+	}
+
+	return &ResponseError{
+		Code:       CodeCircuitBreakerRejected,
+		Message:    circuitError.Message,
+		StatusCode: http.StatusServiceUnavailable,
+		Error:      err,
+		Info:       fmt.Sprintf("Circuit breaker of [%s] rejected the call", c.ClientName),
+	}
+}
+
+// CircuitBreakerStatus returns the state and the counts of the circuit breaker of the client
+func (c *HTTPClient) CircuitBreakerStatus() CircuitBreakerStatus {
+	status := CircuitBreakerStatus{
+		Name:  c.ClientName,
+		State: CircuitBreakerClosed,
+	}
+
+	breakerCollectorsMutex.RLock()
+	collector, ok := breakerCollectors[c.ClientName]
+	breakerCollectorsMutex.RUnlock()
+
+	var openedAt time.Time
+	if ok {
+		collector.mutex.RLock()
+		status.Attempts = collector.status.Attempts
+		status.Successes = collector.status.Successes
+		status.Failures = collector.status.Failures
+		status.Rejects = collector.status.Rejects
+		status.ShortCircuits = collector.status.ShortCircuits
+		status.Timeouts = collector.status.Timeouts
+		status.FallbackSuccesses = collector.status.FallbackSuccesses
+		status.FallbackFailures = collector.status.FallbackFailures
+		status.ConcurrencyInUse = collector.status.ConcurrencyInUse
+		openedAt = collector.openedAt
+		collector.mutex.RUnlock()
+	}
+
+	circuit, _, err := hystrix.GetCircuit(c.ClientName)
+	if err != nil || !circuit.IsOpen() {
+		return status
+	}
+
+	status.State = CircuitBreakerOpen
+	if settings, ok := hystrix.GetCircuitSettings()[c.ClientName]; ok && !openedAt.IsZero() && time.Since(openedAt) > settings.SleepWindow {
+		status.State = CircuitBreakerHalfOpen
+	}
+
+	return status
+}
+
+// breakerCollector is the hystrix metric collector counting the calls and tracking when the circuit opened
+type breakerCollector struct {
+	mutex    sync.RWMutex
+	status   CircuitBreakerStatus
+	openedAt time.Time
+}
+
+func newBreakerCollector(name string) metricCollector.MetricCollector {
+	collector := &breakerCollector{}
+
+	breakerCollectorsMutex.Lock()
+	breakerCollectors[name] = collector
+	breakerCollectorsMutex.Unlock()
+
+	return collector
+}
+
+// Update accumulates the result of a hystrix command
+func (b *breakerCollector) Update(r metricCollector.MetricResult) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.status.Attempts += int64(r.Attempts)
+	b.status.Successes += int64(r.Successes)
+	b.status.Failures += int64(r.Failures)
+	b.status.Rejects += int64(r.Rejects)
+	b.status.ShortCircuits += int64(r.ShortCircuits)
+	b.status.Timeouts += int64(r.Timeouts)
+	b.status.FallbackSuccesses += int64(r.FallbackSuccesses)
+	b.status.FallbackFailures += int64(r.FallbackFailures)
+	b.status.ConcurrencyInUse = r.ConcurrencyInUse
+
+	switch {
+	case r.ShortCircuits > 0:
+		if b.openedAt.IsZero() {
+			b.openedAt = time.Now()
+		}
+	case b.openedAt.IsZero():
+	case r.Successes > 0:
+		// the single test allowed by the open circuit succeeded, the circuit is closed again
+		b.openedAt = time.Time{}
+	case r.Failures > 0 || r.Timeouts > 0:
+		// the single test failed, the circuit stays open for another sleep window
+		b.openedAt = time.Now()
+	}
+}
+
+// Reset resets the counts when hystrix closes or flushes the circuit
+func (b *breakerCollector) Reset() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.status = CircuitBreakerStatus{}
+	b.openedAt = time.Time{}
+}
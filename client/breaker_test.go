@@ -0,0 +1,133 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type breakerResult struct {
+	Name string `json:"name"`
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	fallback := func(ctx context.Context, call *Call, errDo *ResponseError) *ResponseError {
+		call.Response = `{"name":"fallback"}`
+		return nil
+	}
+
+	tests := []struct {
+		name        string
+		status      int
+		delay       time.Duration
+		config      CircuitBreakerConfig
+		want        string
+		wantErr     error
+		wantTimeout bool
+	}{
+		{
+			name:   "completed call decoded",
+			status: http.StatusOK,
+			want:   "upstream",
+		},
+		{
+			name:    "failed call without fallback",
+			status:  http.StatusInternalServerError,
+			wantErr: ErrServerError,
+		},
+		{
+			name:   "failed call with fallback",
+			status: http.StatusInternalServerError,
+			config: CircuitBreakerConfig{Fallback: fallback},
+			want:   "fallback",
+		},
+		{
+			name:        "call slower than the timeout",
+			status:      http.StatusOK,
+			delay:       200 * time.Millisecond,
+			config:      CircuitBreakerConfig{Timeout: 20},
+			wantErr:     ErrCircuitBreakerRejected,
+			wantTimeout: true,
+		},
+		{
+			name:        "call slower than the timeout with fallback",
+			status:      http.StatusOK,
+			delay:       200 * time.Millisecond,
+			config:      CircuitBreakerConfig{Timeout: 20, Fallback: fallback},
+			want:        "fallback",
+			wantTimeout: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			responded := make(chan struct{}, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(test.delay)
+				w.WriteHeader(test.status)
+				_, _ = w.Write([]byte(`{"name":"upstream"}`))
+				responded <- struct{}{}
+			}))
+			defer server.Close()
+
+			config := test.config
+			client := newTestClient(t, server.URL, HTTPClient{CircuitBreaker: &config})
+
+			result := breakerResult{}
+			err := client.CallClientWithCircuitBreaker(context.Background(), "drugs", GET, nil, &result, false).Err()
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("error = %v, want %v", err, test.wantErr)
+			}
+
+			// the call abandoned by the timeout completes meanwhile and must not write into the result
+			<-responded
+			if test.wantTimeout {
+				time.Sleep(20 * time.Millisecond)
+			}
+			if result.Name != test.want {
+				t.Errorf("result = %q, want %q", result.Name, test.want)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerStatus(t *testing.T) {
+	var upstream int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&upstream, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, server.URL, HTTPClient{
+		CircuitBreaker: &CircuitBreakerConfig{RequestVolumeThreshold: 3, ErrorPercentThreshold: 50, SleepWindow: 60000},
+	})
+	if state := client.CircuitBreakerStatus().State; state != CircuitBreakerClosed {
+		t.Fatalf("state = %s before the calls, want closed", state)
+	}
+
+	// hystrix opens the circuit asynchronously once the failures are counted
+	deadline := time.Now().Add(5 * time.Second)
+	for client.CircuitBreakerStatus().State != CircuitBreakerOpen && time.Now().Before(deadline) {
+		_ = client.CallClientWithCircuitBreaker(context.Background(), "drugs", GET, nil, nil, false)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	status := client.CircuitBreakerStatus()
+	if status.State != CircuitBreakerOpen || status.Failures == 0 {
+		t.Fatalf("status = %+v, want open with failures", status)
+	}
+
+	called := atomic.LoadInt32(&upstream)
+	err := client.CallClientWithCircuitBreaker(context.Background(), "drugs", GET, nil, nil, false).Err()
+	if !errors.Is(err, ErrCircuitBreakerRejected) {
+		t.Errorf("error = %v once open, want ErrCircuitBreakerRejected", err)
+	}
+	if atomic.LoadInt32(&upstream) != called {
+		t.Errorf("upstream called once the circuit is open")
+	}
+}
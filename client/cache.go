@@ -0,0 +1,371 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/medicplus-inc/medicplus-kit/net/authentication/signature"
+)
+
+// ErrCacheMiss is returned by the cache when the key does not exist or is expired
+var ErrCacheMiss = errors.New("cache miss")
+
+// ErrMissingClientName is returned when invalidating the cache of a client without ClientName,
+// whose keys cannot be told apart from the keys of the other clients
+var ErrMissingClientName = errors.New("client name is required to invalidate the client cache")
+
+//
+// Private variables
+//
+
+// cacheNamespaceEscaper escapes the separator of the keys in the client names,
+// so that the keys of a client never start with the namespace of another client
+var cacheNamespaceEscaper = strings.NewReplacer("%", "%25", ":", "%3A")
+
+// credentialHeaders are the headers carrying credentials, part of the auth identity of a call whenever they are present
+var credentialHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Secret",
+	"X-Api-Key",
+	"Api-Key",
+	signature.HeaderKeyID,
+}
+
+// Cache represents the storage of the cached client responses
+type Cache interface {
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key string, value string, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+	// DeletePrefix removes all the keys starting with the prefix
+	DeletePrefix(ctx context.Context, prefix string) error
+	// AddTags attaches the tags to the key, the tags are kept at least for the ttl duration
+	AddTags(ctx context.Context, key string, tags []string, ttl time.Duration) error
+	// DeleteTag removes all the keys having the tag
+	DeleteTag(ctx context.Context, tag string) error
+}
+
+// CacheKeyConfig represents what identifies a cached response besides the client name, the method and the path with its query
+type CacheKeyConfig struct {
+	// IncludeBody adds the hash of the request body to the key
+	IncludeBody bool
+	// ExcludeAuthIdentity removes the hash of the credentials of the call from the key,
+	// only for responses which are the same for every caller
+	ExcludeAuthIdentity bool
+}
+
+// NoopCache is the cache which never stores anything, every call reaches the upstream
+type NoopCache struct{}
+
+// Get always misses
+func (NoopCache) Get(ctx context.Context, key string) (string, error) {
+	return "", ErrCacheMiss
+}
+
+// Set does nothing
+func (NoopCache) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	return nil
+}
+
+// Delete does nothing
+func (NoopCache) Delete(ctx context.Context, key string) error {
+	return nil
+}
+
+// DeletePrefix does nothing
+func (NoopCache) DeletePrefix(ctx context.Context, prefix string) error {
+	return nil
+}
+
+// AddTags does nothing
+func (NoopCache) AddTags(ctx context.Context, key string, tags []string, ttl time.Duration) error {
+	return nil
+}
+
+// DeleteTag does nothing
+func (NoopCache) DeleteTag(ctx context.Context, tag string) error {
+	return nil
+}
+
+// cache returns the cache of the call, the one given as option or the one of the client
+func (c *HTTPClient) cache(call *Call) Cache {
+	if call.options.cache != nil {
+		return call.options.cache
+	}
+
+	return c.cacheOrNoop()
+}
+
+// cacheKey builds the key of the call, formatted as "<escaped client name>:<path>?<sorted query>|<METHOD>",
+// followed by the hashes of the body and of the authorization headers depending on the CacheKeyConfig of the client.
+// The path defaults to the url of the call relative to the api url of the client.
+func (c *HTTPClient) cacheKey(call *Call, path string) string {
+	if path == "" {
+		path = stripQueryParams(strings.TrimPrefix(call.URL, c.APIURL), c.authorizationQueryParams())
+	}
+
+	key := c.cacheKeyPrefix(path) + "|" + string(call.Method)
+	if c.CacheKey.IncludeBody && len(call.Body) > 0 {
+		key += "|b:" + hashCacheKey(string(call.Body))
+	}
+	if !c.CacheKey.ExcludeAuthIdentity {
+		if identity := c.authIdentity(call); identity != "" {
+			key += "|a:" + hashCacheKey(identity)
+		}
+	}
+
+	return key
+}
+
+// cacheKeyPrefix builds the beginning of the keys of the path, with its query sorted
+func (c *HTTPClient) cacheKeyPrefix(path string) string {
+	path = strings.TrimPrefix(path, "/")
+	if u, err := url.Parse(path); err == nil && u.RawQuery != "" {
+		path = u.Path + "?" + u.Query().Encode()
+	}
+
+	return c.cacheNamespace() + path
+}
+
+// cacheNamespace returns the beginning of the keys and the tags of the client
+func (c *HTTPClient) cacheNamespace() string {
+	return cacheNamespaceEscaper.Replace(c.ClientName) + ":"
+}
+
+// authIdentity returns the credentials of the call: the values of the registered authorizations from its headers,
+// query or cookies, the credential headers present on the call, whoever set them, and the key id of the signer
+func (c *HTTPClient) authIdentity(call *Call) string {
+	identities := map[string]struct{}{}
+	for _, authorizationType := range c.authorizationTypes() {
+		name := authorizationType.HeaderName
+		if authorizationType.placement() == InHeader {
+			name = http.CanonicalHeaderKey(name)
+		}
+		if value := authorizationValue(call, authorizationType); value != "" {
+			identities[fmt.Sprintf("%s:%s=%s", authorizationType.placement(), name, value)] = struct{}{}
+		}
+	}
+
+	headers := credentialHeaders
+	if c.credentialCache != nil {
+		if name := c.credentialCache.headerName(); name != "" {
+			headers = append([]string{name}, headers...)
+		}
+	}
+	for _, name := range headers {
+		for _, value := range call.Header.Values(name) {
+			identities[fmt.Sprintf("%s:%s=%s", InHeader, http.CanonicalHeaderKey(name), value)] = struct{}{}
+		}
+	}
+
+	// the signature headers are only added once the request is sent
+	if c.Signer != nil {
+		identities[fmt.Sprintf("%s:%s=%s", InHeader, signature.HeaderKeyID, c.Signer.KeyID())] = struct{}{}
+	}
+
+	identity := make([]string, 0, len(identities))
+	for value := range identities {
+		identity = append(identity, value)
+	}
+	sort.Strings(identity)
+
+	return strings.Join(identity, "\n")
+}
+
+// stripQueryParams removes the query parameters from the path
+func stripQueryParams(path string, params []string) string {
+	if len(params) == 0 {
+		return path
+	}
+
+	u, err := url.Parse(path)
+	if err != nil || u.RawQuery == "" {
+		return path
+	}
+
+	query := u.Query()
+	for _, param := range params {
+		query.Del(param)
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+func hashCacheKey(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:16])
+}
+
+// tagCachedResponse attaches the tags given as option to the stored key of the call
+func (c *HTTPClient) tagCachedResponse(ctx context.Context, cache Cache, key string, call *Call, ttl time.Duration) {
+	if len(call.options.cacheTags) == 0 {
+		return
+	}
+
+	tags := make([]string, 0, len(call.options.cacheTags))
+	for _, tag := range call.options.cacheTags {
+		tags = append(tags, c.cacheNamespace()+tag)
+	}
+
+	if err := cache.AddTags(ctx, key, tags, ttl); err != nil {
+		c.log(ctx, LogLevelWarn, "Error tagging caching", LogFields{"client": c.ClientName, "key": key, "error": err})
+	}
+}
+
+// InvalidateCachePath removes the cached responses of the path, for every method, query and caller
+func (c *HTTPClient) InvalidateCachePath(ctx context.Context, path string) error {
+	prefix := c.cacheKeyPrefix(strings.SplitN(path, "?", 2)[0])
+	if err := c.cacheOrNoop().DeletePrefix(ctx, prefix+"|"); err != nil {
+		return err
+	}
+
+	return c.cacheOrNoop().DeletePrefix(ctx, prefix+"?")
+}
+
+// InvalidateCachePrefix removes the cached responses of all the paths starting with the path prefix
+func (c *HTTPClient) InvalidateCachePrefix(ctx context.Context, pathPrefix string) error {
+	return c.cacheOrNoop().DeletePrefix(ctx, c.cacheKeyPrefix(pathPrefix))
+}
+
+// InvalidateCacheTag removes the cached responses stored with the tag (see WithCacheTags)
+func (c *HTTPClient) InvalidateCacheTag(ctx context.Context, tag string) error {
+	return c.cacheOrNoop().DeleteTag(ctx, c.cacheNamespace()+tag)
+}
+
+// InvalidateClientCache removes all the cached responses of the client, ErrMissingClientName without ClientName
+func (c *HTTPClient) InvalidateClientCache(ctx context.Context) error {
+	if c.ClientName == "" {
+		return ErrMissingClientName
+	}
+
+	return c.cacheOrNoop().DeletePrefix(ctx, c.cacheNamespace())
+}
+
+func (c *HTTPClient) cacheOrNoop() Cache {
+	if c.Cache != nil {
+		return c.Cache
+	}
+
+	return NoopCache{}
+}
+
+// caching serves the call from the cache when the key exists, and stores the successful response otherwise.
+// The key is built from the given path (see cacheKey).
+func (c *HTTPClient) caching(caller string, durationInSecond int, path string) Middleware {
+	ttl := time.Second * time.Duration(durationInSecond)
+
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) *ResponseError {
+			cache := c.cache(call)
+			protection := c.StampedeProtection
+			key := c.cacheKey(call, path)
+
+			if cached := c.loadCachedResponse(ctx, caller, cache, key, ttl); cached != nil {
+				served := false
+				switch {
+				case cached.isFresh():
+					if protection != nil && cached.shouldRefreshEarly(protection.EarlyRefreshBeta) {
+						c.refreshInBackground(ctx, caller, cache, key, ttl, next, call)
+					}
+					served = true
+				case protection != nil && time.Now().Before(cached.ExpiredAt.Add(protection.StaleWhileRevalidate)):
+					c.refreshInBackground(ctx, caller, cache, key, ttl, next, call)
+					served = true
+				}
+
+				if served {
+					errDo := c.serveCachedResponse(call, cached)
+					if errDo == nil {
+						c.recordCacheLookup(ctx, "caching", true)
+						return nil
+					}
+					c.log(ctx, LogLevelWarn, "Error collecting caching", LogFields{"client": c.ClientName, "caller": caller, "key": key, "error": errDo.Error})
+					call.Response = ""
+				}
+			}
+
+			c.recordCacheLookup(ctx, "caching", false)
+			if protection == nil {
+				return c.fetchAndStore(ctx, caller, cache, key, ttl, next, call)
+			}
+
+			return c.coalesce(ctx, caller, cache, key, ttl, next, call)
+		}
+	}
+}
+
+// loadCachedResponse collects the entry of the key, values stored before the entries had metadata are read as fresh
+func (c *HTTPClient) loadCachedResponse(ctx context.Context, caller string, cache Cache, key string, ttl time.Duration) *cachedResponse {
+	val, errCache := cache.Get(ctx, key)
+	if errCache != nil {
+		if errCache != ErrCacheMiss {
+			c.log(ctx, LogLevelWarn, "Error collecting caching", LogFields{"client": c.ClientName, "caller": caller, "key": key, "error": errCache})
+		}
+		return nil
+	}
+
+	cached := &cachedResponse{}
+	if errJSON := json.Unmarshal([]byte(val), cached); errJSON != nil || cached.StoredAt.IsZero() {
+		now := time.Now()
+		cached = &cachedResponse{
+			Body:      val,
+			StoredAt:  now,
+			ExpiredAt: now.Add(ttl),
+		}
+	}
+
+	return cached
+}
+
+// fetchAndStore calls the upstream and stores the successful response
+func (c *HTTPClient) fetchAndStore(ctx context.Context, caller string, cache Cache, key string, ttl time.Duration, next Handler, call *Call) *ResponseError {
+	release, cached := c.acquireCachingLock(ctx, caller, cache, key, ttl)
+	defer release()
+	if cached != nil {
+		if errDo := c.serveCachedResponse(call, cached); errDo == nil {
+			return nil
+		}
+		call.Response = ""
+	}
+
+	start := time.Now()
+	errDo := next(ctx, call)
+	if isFailure(errDo) || call.Response == "" {
+		return errDo
+	}
+
+	now := time.Now()
+	val, err := json.Marshal(&cachedResponse{
+		Body:        call.Response,
+		ContentType: call.ResponseHeader.Get("Content-Type"),
+		StoredAt:    now,
+		ExpiredAt:   now.Add(ttl),
+		Delta:       now.Sub(start),
+	})
+	if err == nil {
+		storageTTL := ttl
+		if c.StampedeProtection != nil {
+			storageTTL += c.StampedeProtection.StaleWhileRevalidate
+		}
+		err = cache.Set(ctx, key, string(val), storageTTL)
+		if err == nil {
+			c.tagCachedResponse(ctx, cache, key, call, storageTTL)
+		}
+	}
+	if err != nil {
+		c.log(ctx, LogLevelWarn, "Error storing caching", LogFields{"client": c.ClientName, "caller": caller, "key": key, "error": err})
+	}
+
+	return errDo
+}
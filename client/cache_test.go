@@ -0,0 +1,285 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/medicplus-inc/medicplus-kit/net/authentication/signature"
+)
+
+type callerKey struct{}
+
+func TestCallWithCache(t *testing.T) {
+	var upstream int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&upstream, 1)
+		if r.URL.Path == "/failing" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(`{"name":"aspirin"}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		cache        Cache
+		opts         func() []CallOption
+		path         string
+		wantUpstream int32
+		wantErr      bool
+	}{
+		{
+			name:         "client without cache",
+			path:         "drugs",
+			wantUpstream: 2,
+		},
+		{
+			name:         "client cache",
+			cache:        NewLRUCache(10, 0),
+			path:         "drugs",
+			wantUpstream: 1,
+		},
+		{
+			name: "cache given per call",
+			opts: func() []CallOption {
+				cache := NewLRUCache(10, 0)
+				return []CallOption{WithCache(cache)}
+			},
+			path:         "drugs",
+			wantUpstream: 1,
+		},
+		{
+			name:  "noop cache given per call",
+			cache: NewLRUCache(10, 0),
+			opts: func() []CallOption {
+				return []CallOption{WithCache(NoopCache{})}
+			},
+			path:         "drugs",
+			wantUpstream: 2,
+		},
+		{
+			name:         "failed response not stored",
+			cache:        NewLRUCache(10, 0),
+			path:         "failing",
+			wantUpstream: 2,
+			wantErr:      true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			atomic.StoreInt32(&upstream, 0)
+			client := newTestClient(t, server.URL, HTTPClient{Cache: test.cache})
+
+			var opts []CallOption
+			if test.opts != nil {
+				opts = test.opts()
+			}
+			for i := 0; i < 2; i++ {
+				result := map[string]interface{}{}
+				errDo := client.CallClientWithCachingInRedis(WithCallOptions(context.Background(), opts...), 60, test.path, GET, nil, &result, false)
+				if (errDo.Err() != nil) != test.wantErr {
+					t.Fatalf("call %d error = %v, want error %v", i, errDo.Err(), test.wantErr)
+				}
+				if !test.wantErr && result["name"] != "aspirin" {
+					t.Errorf("call %d result = %v", i, result)
+				}
+			}
+
+			if got := atomic.LoadInt32(&upstream); got != test.wantUpstream {
+				t.Errorf("upstream called %d times, want %d", got, test.wantUpstream)
+			}
+		})
+	}
+}
+
+func TestCacheKeyAuthIdentity(t *testing.T) {
+	apiKey := AuthorizationType(AuthorizationTypeStruct{HeaderName: "key", In: InQuery})
+
+	tests := []struct {
+		name     string
+		config   HTTPClient
+		header   http.Header
+		other    http.Header
+		url      string
+		otherURL string
+		wantSame bool
+	}{
+		{
+			name:   "authorization set per call",
+			header: http.Header{"Authorization": {"Bearer patient-1"}},
+			other:  http.Header{"Authorization": {"Bearer patient-2"}},
+		},
+		{
+			name:   "cookie",
+			header: http.Header{"Cookie": {"session=patient-1"}},
+			other:  http.Header{"Cookie": {"session=patient-2"}},
+		},
+		{
+			name:   "api key header",
+			header: http.Header{"X-Api-Key": {"patient-1"}},
+			other:  http.Header{"X-Api-Key": {"patient-2"}},
+		},
+		{
+			name:   "header of the credential provider",
+			config: HTTPClient{credentialCache: &credentialCache{token: &Token{HeaderName: "X-Token", Value: "a"}}},
+			header: http.Header{"X-Token": {"patient-1"}},
+			other:  http.Header{"X-Token": {"patient-2"}},
+		},
+		{
+			name:     "registered query authorization",
+			config:   HTTPClient{AuthorizationTypes: []AuthorizationType{apiKey}},
+			url:      "drugs?key=patient-1",
+			otherURL: "drugs?key=patient-2",
+		},
+		{
+			name:     "other headers ignored",
+			header:   http.Header{"Accept-Language": {"id"}},
+			other:    http.Header{"Accept-Language": {"en"}},
+			wantSame: true,
+		},
+		{
+			name:     "identity excluded",
+			config:   HTTPClient{CacheKey: CacheKeyConfig{ExcludeAuthIdentity: true}},
+			header:   http.Header{"Authorization": {"Bearer patient-1"}},
+			other:    http.Header{"Authorization": {"Bearer patient-2"}},
+			wantSame: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := test.config
+			client.ClientName = "drugs"
+			client.APIURL = "https://drugs.local/"
+			if test.url == "" {
+				test.url, test.otherURL = "drugs", "drugs"
+			}
+
+			key := client.cacheKey(&Call{Method: GET, URL: client.APIURL + test.url, Header: test.header}, "")
+			other := client.cacheKey(&Call{Method: GET, URL: client.APIURL + test.otherURL, Header: test.other}, "")
+			if (key == other) != test.wantSame {
+				t.Errorf("keys %q and %q, want the same key %v", key, other, test.wantSame)
+			}
+		})
+	}
+
+	t.Run("key id of the signer", func(t *testing.T) {
+		call := &Call{Method: GET, URL: "https://drugs.local/drugs", Header: http.Header{}}
+		first := HTTPClient{ClientName: "drugs", Signer: signature.NewSigner("service-1", []byte("secret"))}
+		second := HTTPClient{ClientName: "drugs", Signer: signature.NewSigner("service-2", []byte("secret"))}
+		if first.cacheKey(call, "") == second.cacheKey(call, "") {
+			t.Errorf("same key for the signers of different key ids")
+		}
+	})
+}
+
+func TestCachedResponsePerCaller(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"patient":"` + r.Header.Get("Authorization") + `"}`))
+	}))
+	defer server.Close()
+
+	// the authorization of the caller is set by a middleware, not by a registered authorization type
+	client := newTestClient(t, server.URL, HTTPClient{
+		Cache: NewLRUCache(10, 0),
+		Middlewares: []Middleware{func(next Handler) Handler {
+			return func(ctx context.Context, call *Call) *ResponseError {
+				call.Header.Set("Authorization", ctx.Value(callerKey{}).(string))
+				return next(ctx, call)
+			}
+		}},
+	})
+
+	for _, caller := range []string{"patient-1", "patient-2", "patient-1"} {
+		ctx := context.WithValue(context.Background(), callerKey{}, caller)
+		result := map[string]interface{}{}
+		if errDo := client.CallClientWithCachingInRedis(ctx, 60, "records", GET, nil, &result, false); errDo.Err() != nil {
+			t.Fatalf("call of %s error = %v", caller, errDo.Err())
+		}
+		if result["patient"] != caller {
+			t.Errorf("%s served the response of %v", caller, result["patient"])
+		}
+	}
+}
+
+func TestInvalidateCache(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		clientName string
+		invalidate func(client *HTTPClient) error
+		want       map[string]bool
+		wantErr    error
+	}{
+		{
+			name:       "path",
+			clientName: "drugs",
+			invalidate: func(client *HTTPClient) error { return client.InvalidateCachePath(ctx, "items") },
+			want:       map[string]bool{"items": false, "items?page=2": false, "items/1": true, "tagged": true},
+		},
+		{
+			name:       "prefix",
+			clientName: "drugs",
+			invalidate: func(client *HTTPClient) error { return client.InvalidateCachePrefix(ctx, "items") },
+			want:       map[string]bool{"items": false, "items?page=2": false, "items/1": false, "tagged": true},
+		},
+		{
+			name:       "tag",
+			clientName: "drugs",
+			invalidate: func(client *HTTPClient) error { return client.InvalidateCacheTag(ctx, "patient-1") },
+			want:       map[string]bool{"items": true, "items?page=2": true, "items/1": true, "tagged": false},
+		},
+		{
+			name:       "client",
+			clientName: "drugs",
+			invalidate: func(client *HTTPClient) error { return client.InvalidateClientCache(ctx) },
+			want:       map[string]bool{"items": false, "items?page=2": false, "items/1": false, "tagged": false},
+		},
+		{
+			name:       "client without name",
+			invalidate: func(client *HTTPClient) error { return client.InvalidateClientCache(ctx) },
+			want:       map[string]bool{"items": true, "items?page=2": true, "items/1": true, "tagged": true},
+			wantErr:    ErrMissingClientName,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(`{}`))
+			}))
+			defer server.Close()
+
+			cache := NewLRUCache(10, 0)
+			client := NewHTTPClient(HTTPClient{APIURL: server.URL, ClientName: test.clientName, Cache: cache, Logging: &LoggingConfig{Level: LogLevelOff}}, nil)
+			keys := map[string]string{}
+			for path := range test.want {
+				var opts []CallOption
+				if path == "tagged" {
+					opts = append(opts, WithCacheTags("patient-1"))
+				}
+				call := &Call{Method: GET, URL: server.URL + "/" + path, Header: http.Header{}}
+				keys[path] = client.cacheKey(call, "")
+				if errDo := client.CallClientWithCachingInRedis(WithCallOptions(ctx, opts...), 60, path, GET, nil, nil, false); errDo.Err() != nil {
+					t.Fatalf("call of %s error = %v", path, errDo.Err())
+				}
+			}
+
+			if err := test.invalidate(client); !errors.Is(err, test.wantErr) {
+				t.Fatalf("error = %v, want %v", err, test.wantErr)
+			}
+			for path, want := range test.want {
+				if _, err := cache.Get(ctx, keys[path]); (err == nil) != want {
+					t.Errorf("%s cached = %v, want %v", path, err == nil, want)
+				}
+			}
+		})
+	}
+}
@@ -1,22 +1,19 @@
 package client
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
-	"math/rand"
 	"net/http"
-	"net/url"
+	"strconv"
+	"sync"
 	"time"
 
-	"moul.io/http2curl"
-
-	"github.com/afex/hystrix-go/hystrix"
 	"github.com/go-redis/redis"
-	"github.com/medicplus-inc/medicplus-kit/types"
+	"github.com/medicplus-inc/medicplus-kit/net/authentication/signature"
+	"golang.org/x/sync/singleflight"
 )
 
 // Method represents the enum for http call method
@@ -42,10 +39,15 @@ type ResponseError struct {
 
 // AuthorizationTypeStruct represents struct of Authorization Type
 type AuthorizationTypeStruct struct {
+	// HeaderName is the name of the header, or of the query parameter or cookie depending on In
 	HeaderName      string
 	HeaderType      string
 	HeaderTypeValue string
 	Token           string
+	// In is where the authorization is sent, in a header by default
+	In AuthorizationPlacement
+	// Host restricts the authorization to the calls of this host, e.g. "api.example.com", all hosts when empty
+	Host string
 }
 
 // AuthorizationType represents the enum for http authorization type
@@ -66,8 +68,6 @@ var (
 
 const apiURL = "https://127.0.0.1:8080"
 const defaultHTTPTimeout = 80 * time.Second
-const maxNetworkRetriesDelay = 5000 * time.Millisecond
-const minNetworkRetriesDelay = 500 * time.Millisecond
 
 //
 // Private variables
@@ -87,70 +87,101 @@ type GenericHTTPClient interface {
 	AddAuthentication(ctx context.Context, authorizationType AuthorizationType)
 }
 
+// StreamingHTTPClient represents the clients which can also stream their requests and responses (see HTTPClient.Stream)
+type StreamingHTTPClient interface {
+	GenericHTTPClient
+	Stream(ctx context.Context, path string, method Method, contentType string, body io.Reader, opts ...CallOption) (*StreamResponse, *ResponseError)
+}
+
 // HTTPClient represents the service http client
 type HTTPClient struct {
 	redisClient        *redis.Client
+	instrumentation    *instrumentation
+	credentialCache    *credentialCache
+	rateLimiters       []*rateLimiter
+	balancer           *balancer
+	cachingFlights     *singleflight.Group
+	authorizations     *authorizations
+	err                error
 	APIURL             string
 	HTTPClient         *http.Client
 	MaxNetworkRetries  int
+	RetryPolicy        *RetryPolicy
 	UseNormalSleep     bool
 	AuthorizationTypes []AuthorizationType
 	ClientName         string
+	Middlewares        []Middleware
+	CircuitBreaker     *CircuitBreakerConfig
+	Cache              Cache
+	HTTPCaching        bool
+	StampedeProtection *StampedeProtection
+	CacheKey           CacheKeyConfig
+	Logging            *LoggingConfig
+	Telemetry          *TelemetryConfig
+	CredentialProvider CredentialProvider
+	Signer             *signature.Signer
+	TLS                *TLSConfig
+	Codecs             map[string]Codec
+	RateLimit          *RateLimitConfig
+	LoadBalancing      *LoadBalancingConfig
+	// Envelope unwraps the `data` of the json responses in the ResolveStructure of the kit into the results,
+	// the `metadata` being kept apart (see WithMetadata)
+	Envelope bool
+	// IdempotencyKeys attaches an Idempotency-Key header, generated once per call and reused by its retries,
+	// to the POST and PATCH calls (see WithIdempotencyKey); the retryable status codes are then retried for them
+	IdempotencyKeys bool
 }
 
-func (c *HTTPClient) shouldRetry(err error, res *http.Response, retry int) bool {
-	if retry >= c.MaxNetworkRetries {
-		return false
-	}
-
-	if err != nil {
-		return true
-	}
-
-	return false
-}
-
-func (c *HTTPClient) sleepTime(numRetries int) time.Duration {
-	if c.UseNormalSleep {
-		return 0
-	}
-
-	// exponentially backoff by 2^numOfRetries
-	delay := minNetworkRetriesDelay + minNetworkRetriesDelay*time.Duration(1<<uint(numRetries))
-	if delay > maxNetworkRetriesDelay {
-		delay = maxNetworkRetriesDelay
-	}
-
-	// generate random jitter to prevent thundering herd problem
-	jitter := rand.Int63n(int64(delay / 4))
-	delay -= time.Duration(jitter)
-
-	if delay < minNetworkRetriesDelay {
-		delay = minNetworkRetriesDelay
+// Do calls the api http request and parse the response into v
+func (c *HTTPClient) Do(req *http.Request) (string, *ResponseError) {
+	if req.Header == nil {
+		req.Header = http.Header{}
 	}
-
-	return delay
+	c.setIdempotencyKey(req.Method, req.Header, "")
+	_, response, _, errDo := c.do(req, false)
+	return response, errDo
 }
 
-// Do calls the api http request and parse the response into v
-func (c *HTTPClient) Do(req *http.Request) (string, *ResponseError) {
+// do calls the api http request with retries and returns the response with its body already read,
+// along with the number of attempts. The body of a successful response is left unread when streaming.
+func (c *HTTPClient) do(req *http.Request, streaming bool) (*http.Response, string, int, *ResponseError) {
 	var res *http.Response
 	var err error
 
-	for retry := 0; ; {
-		res, err = c.HTTPClient.Do(req)
+	policy := c.retryPolicy()
+	start := time.Now()
+	retry := 0
+	for {
+		res, err = c.sendToEndpoint(req, retry)
 
-		if !c.shouldRetry(err, res, retry) {
+		if !c.shouldRetry(policy, req, err, res, retry) {
 			break
 		}
 
-		sleepDuration := c.sleepTime(retry)
+		sleepDuration, ok := c.sleepTime(policy, retry, res)
+		if !ok {
+			break
+		}
+		if policy.MaxElapsedTime > 0 && time.Since(start)+sleepDuration > policy.MaxElapsedTime {
+			break
+		}
+		if !c.allowRetry(req.Context()) {
+			break
+		}
 		retry++
 
-		time.Sleep(sleepDuration)
+		discardBody(res)
+		if err = sleep(req.Context(), sleepDuration); err != nil {
+			res = nil
+			break
+		}
+		if err = rewindBody(req); err != nil {
+			res = nil
+			break
+		}
 	}
 	if err != nil {
-		return "", &ResponseError{
+		return nil, "", retry + 1, &ResponseError{
 			Code:       "Internal Server Error",
 			Message:    "Error while retry",
 			Error:      err,
@@ -158,13 +189,19 @@ func (c *HTTPClient) Do(req *http.Request) (string, *ResponseError) {
 			Info:       fmt.Sprintf("Error when retrying to call [%s]", c.APIURL),
 		}
 	}
+	if streaming && res.StatusCode >= 200 && res.StatusCode < 300 {
+		return res, "", retry + 1, &ResponseError{
+			Code:       strconv.Itoa(res.StatusCode),
+			StatusCode: res.StatusCode,
+		}
+	}
 	defer res.Body.Close()
 
 	resBody, err := ioutil.ReadAll(res.Body)
 	res.Body.Close()
 	if err != nil {
-		return "", &ResponseError{
-			Code:       string(res.StatusCode),
+		return res, "", retry + 1, &ResponseError{
+			Code:       strconv.Itoa(res.StatusCode),
 			Message:    "",
 			StatusCode: res.StatusCode,
 			Error:      err,
@@ -173,566 +210,264 @@ func (c *HTTPClient) Do(req *http.Request) (string, *ResponseError) {
 	}
 
 	errResponse := &ResponseError{
-		Code:       string(res.StatusCode),
+		Code:       strconv.Itoa(res.StatusCode),
 		Message:    "",
 		StatusCode: res.StatusCode,
 		Error:      nil,
 		Info:       "",
 	}
-	if res.StatusCode < 200 || res.StatusCode >= 300 {
+	if (res.StatusCode < 200 || res.StatusCode >= 300) && !notModified(req, res) {
+		// the error of the body, e.g. the one written by EncodeError, is kept as cause
+		var cause error
 		err = json.Unmarshal([]byte(string(resBody)), errResponse)
 		if err != nil {
 			errResponse.Error = err
+		} else {
+			cause = errResponse.Error
 		}
 		if errResponse.Info != "" {
 			errResponse.Message = errResponse.Info
 		}
 		errResponse.Error = fmt.Errorf("Error while calling %s: %v", req.URL.String(), errResponse.Message)
+		if cause != nil && cause.Error() != errResponse.Message {
+			errResponse.Error = fmt.Errorf("Error while calling %s: %v: %w", req.URL.String(), errResponse.Message, cause)
+		}
 
-		return "", errResponse
+		return res, "", retry + 1, errResponse
 	}
 
-	return string(resBody), errResponse
+	return res, string(resBody), retry + 1, errResponse
+}
+
+// notModified reports whether the response is the 304 of a request carrying validators, which is not a failure
+func notModified(req *http.Request, res *http.Response) bool {
+	return res.StatusCode == http.StatusNotModified &&
+		(req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "")
 }
 
 // CallClient do call client
 func (c *HTTPClient) CallClient(ctx context.Context, path string, method Method, request interface{}, result interface{}, isAcknowledgeNeeded bool) *ResponseError {
-	var jsonData []byte
-	var err error
-	var response string
-	var errDo *ResponseError
-
-	if request != nil && request != "" {
-		jsonData, err = json.Marshal(request)
-		if err != nil {
-			errDo = &ResponseError{
-				Error: err,
-			}
-			return errDo
-		}
-	}
-
-	urlPath, err := url.Parse(fmt.Sprintf("%s/%s", c.APIURL, path))
-	if err != nil {
-		errDo = &ResponseError{
-			Error: err,
-		}
-		return errDo
-	}
-
-	req, err := http.NewRequest(string(method), urlPath.String(), bytes.NewBuffer(jsonData))
-	if err != nil {
-		errDo = &ResponseError{
-			Error: err,
-		}
-		return errDo
-	}
-
-	for _, authorizationType := range c.AuthorizationTypes {
-		if authorizationType.HeaderType != "APIKey" {
-			req.Header.Add(authorizationType.HeaderName, fmt.Sprintf("%s%s", authorizationType.HeaderTypeValue, authorizationType.Token))
-		}
-	}
-	req.Header.Add("Content-Type", "application/json")
-
-	requestRaw := types.Metadata{}
-	if request != nil && request != "" {
-		err = json.Unmarshal(jsonData, &requestRaw)
-		if err != nil {
-			errDo = &ResponseError{
-				Error: err,
-			}
-			return errDo
-		}
-	}
-
-	response, errDo = c.Do(req)
-
-	//TODO change logging to store in elastic search / hadoop
-	command, _ := http2curl.GetCurlCommand(req)
-	log.Printf(`
-	[Calling %s] 
-	curl: %v
-	response: %v 
-	`, c.ClientName, command.String(), response)
-
-	if errDo != nil && (errDo.Error != nil || errDo.Message != "") {
+	call, errDo := c.newCall(path, method, request, result)
+	if errDo != nil {
 		return errDo
 	}
 
-	if response != "" && result != nil {
-		err = json.Unmarshal([]byte(response), result)
-		if err != nil {
-			errDo = &ResponseError{
-				Error: err,
-			}
-			return errDo
-		}
-	}
-
-	return errDo
+	return c.Execute(ctx, call)
 }
 
-// CallClientWithCachingInRedis call client with caching in redis
+// CallClientWithCachingInRedis call client with caching in the cache of the client (redis by default)
 func (c *HTTPClient) CallClientWithCachingInRedis(ctx context.Context, durationInSecond int, path string, method Method, request interface{}, result interface{}, isAcknowledgeNeeded bool) *ResponseError {
-	var jsonData []byte
-	var err error
-	var response string
-	var errDo *ResponseError
-
-	if request != nil && request != "" {
-		jsonData, err = json.Marshal(request)
-		if err != nil {
-			errDo = &ResponseError{
-				Error: err,
-			}
-			return errDo
-		}
-	}
-
-	urlPath, err := url.Parse(fmt.Sprintf("%s/%s", c.APIURL, path))
-	if err != nil {
-		errDo = &ResponseError{
-			Error: err,
-		}
+	call, errDo := c.newCall(path, method, request, result)
+	if errDo != nil {
 		return errDo
 	}
 
-	//collect from redis if already exist
-	val, errRedis := c.redisClient.Get("apicaching:" + urlPath.String()).Result()
-	if errRedis != nil {
-		log.Printf(`
-		======================================================================
-		Error Collecting Caching in "CallClientWithCachingInRedis":
-		"key": %s
-		Error: %v
-		======================================================================
-		`, "apicaching:"+urlPath.String(), errRedis)
-	}
-
-	if val != "" {
-		isSuccess := true
-		if errJSON := json.Unmarshal([]byte(val), &result); errJSON != nil {
-			log.Printf(`
-			======================================================================
-			Error Collecting Caching in "CallClientWithCachingInRedis":
-			"key": %s,
-			Error: %v,
-			======================================================================
-			`, "apicaching:"+urlPath.String(), errJSON)
-			isSuccess = false
-		}
-		if isSuccess {
-			return nil
-		}
-	}
-
-	req, err := http.NewRequest(string(method), urlPath.String(), bytes.NewBuffer(jsonData))
-	if err != nil {
-		errDo = &ResponseError{
-			Error: err,
-		}
-		return errDo
-	}
-
-	for _, authorizationType := range c.AuthorizationTypes {
-		if authorizationType.HeaderType != "APIKey" {
-			req.Header.Add(authorizationType.HeaderName, fmt.Sprintf("%s%s", authorizationType.HeaderTypeValue, authorizationType.Token))
-		}
-	}
-	req.Header.Add("Content-Type", "application/json")
-
-	response, errDo = c.Do(req)
-
-	//TODO change logging to store in elastic search / hadoop
-	command, _ := http2curl.GetCurlCommand(req)
-	log.Printf(`
-	[Calling %s] 
-	curl: %v
-	response: %v 
-	`, c.ClientName, command.String(), response)
-
-	if errDo != nil && (errDo.Error != nil || errDo.Message != "") {
-		return errDo
-	}
-
-	if response != "" && result != nil {
-		err = json.Unmarshal([]byte(response), result)
-		if err != nil {
-			errDo = &ResponseError{
-				Error: err,
-			}
-			return errDo
-		}
-
-		if errRedis = c.redisClient.Set(
-			fmt.Sprintf("%s:%s", "apicaching", urlPath.String()),
-			response,
-			time.Second*time.Duration(durationInSecond),
-		).Err(); err != nil {
-			log.Printf(`
-			======================================================================
-			Error Storing Caching in "CallClientWithCachingInRedis":
-			"key": %s,
-			Error: %v,
-			======================================================================
-			`, "apicaching:"+urlPath.String(), err)
-		}
-	}
-
-	return errDo
+	return c.Execute(ctx, call, WithMiddlewares(c.caching("CallClientWithCachingInRedis", durationInSecond, path)))
 }
 
-// CallClientWithCachingInRedisWithDifferentKey call client with caching in redis with different key
+// CallClientWithCachingInRedisWithDifferentKey call client with caching in the cache of the client (redis by default) with different key
 func (c *HTTPClient) CallClientWithCachingInRedisWithDifferentKey(ctx context.Context, durationInSecond int, path string, pathToBeStoredAsKey string, method Method, request interface{}, result interface{}, isAcknowledgeNeeded bool) *ResponseError {
-	var jsonData []byte
-	var err error
-	var response string
-	var errDo *ResponseError
-
-	if request != nil && request != "" {
-		jsonData, err = json.Marshal(request)
-		if err != nil {
-			errDo = &ResponseError{
-				Error: err,
-			}
-			return errDo
-		}
-	}
-
-	urlPath, err := url.Parse(fmt.Sprintf("%s/%s", c.APIURL, path))
-	if err != nil {
-		errDo = &ResponseError{
-			Error: err,
-		}
-		return errDo
-	}
-
-	urlPathToBeStored, err := url.Parse(fmt.Sprintf("%s/%s", c.APIURL, pathToBeStoredAsKey))
-	if err != nil {
-		errDo = &ResponseError{
-			Error: err,
-		}
+	call, errDo := c.newCall(path, method, request, result)
+	if errDo != nil {
 		return errDo
 	}
 
-	//collect from redis if already exist
-	val, errRedis := c.redisClient.Get("apicaching:" + urlPathToBeStored.String()).Result()
-	if errRedis != nil {
-		log.Printf(`
-		======================================================================
-		Error Collecting Caching in "CallClientWithCachingInRedisWithDifferentKey":
-		"key": %s
-		Error: %v
-		======================================================================
-		`, "apicaching:"+urlPathToBeStored.String(), errRedis)
-	}
-
-	if val != "" {
-		isSuccess := true
-		if errJSON := json.Unmarshal([]byte(val), &result); errJSON != nil {
-			log.Printf(`
-			======================================================================
-			Error Collecting Caching in "CallClientWithCachingInRedisWithDifferentKey":
-			"key": %s,
-			Error: %v,
-			======================================================================
-			`, "apicaching:"+urlPathToBeStored.String(), errJSON)
-			isSuccess = false
-		}
-		if isSuccess {
-			return nil
-		}
-	}
+	return c.Execute(ctx, call, WithMiddlewares(c.caching("CallClientWithCachingInRedisWithDifferentKey", durationInSecond, pathToBeStoredAsKey)))
+}
 
-	req, err := http.NewRequest(string(method), urlPath.String(), bytes.NewBuffer(jsonData))
-	if err != nil {
-		errDo = &ResponseError{
-			Error: err,
-		}
+// CallClientWithCircuitBreaker do call client with circuit breaker (async)
+func (c *HTTPClient) CallClientWithCircuitBreaker(ctx context.Context, path string, method Method, request interface{}, result interface{}, isAcknowledgeNeeded bool) *ResponseError {
+	call, errDo := c.newCall(path, method, request, result)
+	if errDo != nil {
 		return errDo
 	}
 
-	for _, authorizationType := range c.AuthorizationTypes {
-		if authorizationType.HeaderType != "APIKey" {
-			req.Header.Add(authorizationType.HeaderName, fmt.Sprintf("%s%s", authorizationType.HeaderTypeValue, authorizationType.Token))
-		}
-	}
-	req.Header.Add("Content-Type", "application/json")
-
-	response, errDo = c.Do(req)
+	return c.Execute(ctx, call, WithMiddlewares(c.circuitBreaker()))
+}
 
-	//TODO change logging to store in elastic search / hadoop
-	command, _ := http2curl.GetCurlCommand(req)
-	log.Printf(`
-	[Calling %s] 
-	curl: %v
-	response: %v 
-	`, c.ClientName, command.String(), response)
+// CallClientWithBaseURLGiven do call client with base url given
+func (c *HTTPClient) CallClientWithBaseURLGiven(ctx context.Context, url string, method Method, request interface{}, result interface{}, isAcknowledgeNeeded bool) *ResponseError {
+	return c.Execute(ctx, &Call{
+		Method:  method,
+		URL:     url,
+		Request: request,
+		Result:  result,
+	})
+}
 
-	if errDo != nil && (errDo.Error != nil || errDo.Message != "") {
+// CallClientWithRequestInBytes do call client with request in bytes and omit acknowledge process - specific case for consumer
+func (c *HTTPClient) CallClientWithRequestInBytes(ctx context.Context, path string, method Method, request []byte, result interface{}) *ResponseError {
+	urlPath, errDo := c.buildURL(path)
+	if errDo != nil {
 		return errDo
 	}
 
-	if response != "" && result != nil {
-		err = json.Unmarshal([]byte(response), result)
-		if err != nil {
-			errDo = &ResponseError{
-				Error: err,
-			}
-			return errDo
-		}
-
-		if errRedis = c.redisClient.Set(
-			fmt.Sprintf("%s:%s", "apicaching", urlPathToBeStored.String()),
-			response,
-			time.Second*time.Duration(durationInSecond),
-		).Err(); err != nil {
-			log.Printf(`
-			======================================================================
-			Error Storing Caching in "CallClientWithCachingInRedisWithDifferentKey":
-			"key": %s,
-			Error: %v,
-			======================================================================
-			`, "apicaching:"+urlPathToBeStored.String(), err)
-		}
-	}
-
-	return errDo
+	return c.Execute(ctx, &Call{
+		Method: method,
+		URL:    urlPath,
+		Body:   request,
+		Result: result,
+	})
 }
 
-// CallClientWithCircuitBreaker do call client with circuit breaker (async)
-func (c *HTTPClient) CallClientWithCircuitBreaker(ctx context.Context, path string, method Method, request interface{}, result interface{}, isAcknowledgeNeeded bool) *ResponseError {
-	var jsonData []byte
-	var err error
-	var response string
-	var errDo *ResponseError
-
-	Sethystrix(c.ClientName)
-	err = hystrix.Do(c.ClientName, func() error {
-		if request != nil {
-			jsonData, err = json.Marshal(request)
-			if err != nil {
-				errDo = &ResponseError{
-					Error: err,
-				}
-				return errDo.Error
-			}
-		}
-
-		urlPath, err := url.Parse(fmt.Sprintf("%s/%s", c.APIURL, path))
-		if err != nil {
-			errDo = &ResponseError{
-				Error: err,
-			}
-			return errDo.Error
-		}
-
-		req, err := http.NewRequest(string(method), urlPath.String(), bytes.NewBuffer(jsonData))
-		if err != nil {
-			errDo = &ResponseError{
-				Error: err,
-			}
-			return errDo.Error
-		}
-
-		for _, authorizationType := range c.AuthorizationTypes {
-			if authorizationType.HeaderType != "APIKey" {
-				req.Header.Add(authorizationType.HeaderName, fmt.Sprintf("%s%s", authorizationType.HeaderTypeValue, authorizationType.Token))
-			}
-		}
-		req.Header.Add("Content-Type", "application/json")
-
-		response, errDo = c.Do(req)
-
-		//TODO change logging to store in elastic search / hadoop
-		command, _ := http2curl.GetCurlCommand(req)
-		log.Printf(`
-	[Calling %s] 
-	curl: %v
-	response: %v 
-	`, c.ClientName, command.String(), response)
-
-		if errDo != nil && (errDo.Error != nil || errDo.Message != "") {
-			return errDo.Error
-		}
+// AddAuthentication do add authentication.
+//
+// NewHTTPClient copies the AuthorizationTypes of the config, the authorizations added afterwards are kept by the client
+// and the exported field is left as given.
+// It is safe for concurrent use on the clients created by NewHTTPClient, but the authentication is shared by all
+// the calls of the client: tokens which expire or depend on the caller should be given with a CredentialProvider instead.
+func (c *HTTPClient) AddAuthentication(ctx context.Context, authorizationType AuthorizationType) {
+	if c.authorizations == nil {
+		c.AuthorizationTypes = withAuthorizationType(c.AuthorizationTypes, authorizationType)
+		return
+	}
 
-		if response != "" && result != nil {
-			err = json.Unmarshal([]byte(response), result)
-			if err != nil {
-				errDo = &ResponseError{
-					Error: err,
-				}
-				return errDo.Error
-			}
-		}
-		return nil
-	}, nil)
+	c.authorizations.mutex.Lock()
+	defer c.authorizations.mutex.Unlock()
 
-	return errDo
+	c.authorizations.types = withAuthorizationType(c.authorizations.types, authorizationType)
 }
 
-// CallClientWithBaseURLGiven do call client with base url given
-func (c *HTTPClient) CallClientWithBaseURLGiven(ctx context.Context, url string, method Method, request interface{}, result interface{}, isAcknowledgeNeeded bool) *ResponseError {
-	var jsonData []byte
-	var err error
-	var response string
-	var errDo *ResponseError
-
-	if request != nil && request != "" {
-		jsonData, err = json.Marshal(request)
-		if err != nil {
-			errDo = &ResponseError{
-				Error: err,
-			}
-			return errDo
-		}
-	}
-
-	req, err := http.NewRequest(string(method), url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		errDo = &ResponseError{
-			Error: err,
-		}
-		return errDo
+// authorizationTypes returns a snapshot of the authorization types of the client
+func (c *HTTPClient) authorizationTypes() []AuthorizationType {
+	if c.authorizations == nil {
+		return c.AuthorizationTypes
 	}
 
-	for _, authorizationType := range c.AuthorizationTypes {
-		if authorizationType.HeaderType != "APIKey" {
-			req.Header.Add(authorizationType.HeaderName, fmt.Sprintf("%s%s", authorizationType.HeaderTypeValue, authorizationType.Token))
-		}
-	}
-	req.Header.Add("Content-Type", "application/json")
+	c.authorizations.mutex.RLock()
+	defer c.authorizations.mutex.RUnlock()
 
-	response, errDo = c.Do(req)
+	return c.authorizations.types
+}
 
-	//TODO change logging to store in elastic search / hadoop
-	command, _ := http2curl.GetCurlCommand(req)
-	log.Printf(`
-	[Calling %s] 
-	curl: %v
-	response: %v 
-	`, c.ClientName, command.String(), response)
+// authorizations represents the authorization types of a client, updated by AddAuthentication while the calls read them
+type authorizations struct {
+	mutex sync.RWMutex
+	types []AuthorizationType
+}
 
-	if errDo != nil && (errDo.Error != nil || errDo.Message != "") {
-		return errDo
-	}
+// withAuthorizationType returns a copy of the authorization types with the token of the authorization type updated,
+// or with the authorization type added, so that the snapshots held by the running calls are never mutated
+func withAuthorizationType(authorizationTypes []AuthorizationType, authorizationType AuthorizationType) []AuthorizationType {
+	updated := make([]AuthorizationType, len(authorizationTypes), len(authorizationTypes)+1)
+	copy(updated, authorizationTypes)
 
-	if response != "" && result != nil {
-		err = json.Unmarshal([]byte(response), result)
-		if err != nil {
-			errDo = &ResponseError{
-				Error: err,
-			}
-			return errDo
+	for key, singleAuthorizationType := range updated {
+		if singleAuthorizationType.sameAs(authorizationType) {
+			updated[key].Token = authorizationType.Token
+			return updated
 		}
 	}
 
-	return errDo
+	return append(updated, authorizationType)
 }
 
-// CallClientWithRequestInBytes do call client with request in bytes and omit acknowledge process - specific case for consumer
-func (c *HTTPClient) CallClientWithRequestInBytes(ctx context.Context, path string, method Method, request []byte, result interface{}) *ResponseError {
-	var jsonData []byte = request
-	var err error
-	var response string
-	var errDo *ResponseError
-
-	urlPath, err := url.Parse(fmt.Sprintf("%s/%s", c.APIURL, path))
-	if err != nil {
-		errDo = &ResponseError{
-			Error: err,
-		}
-		return errDo
+// NewHTTPClient creates the new http client
+func NewHTTPClient(
+	config HTTPClient,
+	redisClient *redis.Client,
+) *HTTPClient {
+	if config.HTTPClient == nil {
+		config.HTTPClient = httpClient
 	}
 
-	req, err := http.NewRequest(string(method), urlPath.String(), bytes.NewBuffer(jsonData))
-	if err != nil {
-		errDo = &ResponseError{
-			Error: err,
+	var errTLS error
+	if config.TLS != nil {
+		client := *config.HTTPClient
+		client.Transport, errTLS = NewTLSTransport(*config.TLS)
+		if errTLS != nil {
+			client.Transport = errorTransport{err: errTLS}
 		}
-		return errDo
+		config.HTTPClient = &client
 	}
 
-	for _, authorizationType := range c.AuthorizationTypes {
-		if authorizationType.HeaderType != "APIKey" {
-			req.Header.Add(authorizationType.HeaderName, fmt.Sprintf("%s%s", authorizationType.HeaderTypeValue, authorizationType.Token))
-		}
+	if config.APIURL == "" && config.LoadBalancing != nil && len(config.LoadBalancing.Endpoints) > 0 {
+		config.APIURL = config.LoadBalancing.Endpoints[0].URL
+	}
+	if config.APIURL == "" {
+		config.APIURL = apiURL
 	}
-	req.Header.Add("Content-Type", "application/json")
-
-	response, errDo = c.Do(req)
-
-	//TODO change logging to store in elastic search / hadoop
-	command, _ := http2curl.GetCurlCommand(req)
-	log.Printf(`
-	[Calling %s] 
-	curl: %v
-	response: %v 
-	`, c.ClientName, command.String(), response)
 
-	if errDo != nil && (errDo.Error != nil || errDo.Message != "") {
-		return errDo
+	circuitBreakerConfig := CircuitBreakerConfig{}
+	if config.CircuitBreaker != nil {
+		circuitBreakerConfig = *config.CircuitBreaker
 	}
+	configureCircuitBreaker(config.ClientName, circuitBreakerConfig)
 
-	if response != "" && result != nil {
-		err = json.Unmarshal([]byte(response), result)
-		if err != nil {
-			errDo = &ResponseError{
-				Error: err,
-			}
-			return errDo
+	if config.Cache == nil {
+		config.Cache = NoopCache{}
+		if redisClient != nil {
+			config.Cache = NewRedisCache(redisClient, DefaultRedisCachePrefix)
 		}
 	}
 
-	return errDo
-}
-
-// AddAuthentication do add authentication
-func (c *HTTPClient) AddAuthentication(ctx context.Context, authorizationType AuthorizationType) {
-	isExist := false
-	for key, singleAuthorizationType := range c.AuthorizationTypes {
-		if singleAuthorizationType.HeaderType == authorizationType.HeaderType {
-			c.AuthorizationTypes[key].Token = authorizationType.Token
-			isExist = true
-			break
-		}
+	var instrumentation *instrumentation
+	if config.Telemetry != nil {
+		instrumentation = newInstrumentation(*config.Telemetry)
 	}
 
-	if isExist == false {
-		c.AuthorizationTypes = append(c.AuthorizationTypes, authorizationType)
+	var credentialCache *credentialCache
+	if config.CredentialProvider != nil {
+		credentialCache = newCredentialCache(config.CredentialProvider)
 	}
-}
 
-// NewHTTPClient creates the new http client
-func NewHTTPClient(
-	config HTTPClient,
-	redisClient *redis.Client,
-) *HTTPClient {
-	if config.HTTPClient == nil {
-		config.HTTPClient = httpClient
+	var rateLimiters []*rateLimiter
+	if config.RateLimit != nil {
+		rateLimiters = newRateLimiters(config.ClientName, *config.RateLimit)
 	}
 
-	if config.APIURL == "" {
-		config.APIURL = apiURL
+	var balancer *balancer
+	if config.LoadBalancing != nil {
+		balancer = newBalancer(config.APIURL, *config.LoadBalancing)
 	}
 
-	return &HTTPClient{
+	client := &HTTPClient{
 		APIURL:             config.APIURL,
 		HTTPClient:         config.HTTPClient,
 		MaxNetworkRetries:  config.MaxNetworkRetries,
+		RetryPolicy:        config.RetryPolicy,
 		UseNormalSleep:     config.UseNormalSleep,
 		AuthorizationTypes: config.AuthorizationTypes,
 		ClientName:         config.ClientName,
+		Middlewares:        config.Middlewares,
+		CircuitBreaker:     config.CircuitBreaker,
+		Cache:              config.Cache,
+		HTTPCaching:        config.HTTPCaching,
+		StampedeProtection: config.StampedeProtection,
+		CacheKey:           config.CacheKey,
+		Logging:            config.Logging,
+		Telemetry:          config.Telemetry,
+		CredentialProvider: config.CredentialProvider,
+		Signer:             config.Signer,
+		TLS:                config.TLS,
+		Codecs:             config.Codecs,
+		RateLimit:          config.RateLimit,
+		LoadBalancing:      config.LoadBalancing,
+		Envelope:           config.Envelope,
+		IdempotencyKeys:    config.IdempotencyKeys,
+		credentialCache:    credentialCache,
+		rateLimiters:       rateLimiters,
+		balancer:           balancer,
+		cachingFlights:     &singleflight.Group{},
+		authorizations:     &authorizations{types: append([]AuthorizationType{}, config.AuthorizationTypes...)},
 		redisClient:        redisClient,
+		instrumentation:    instrumentation,
+		err:                errTLS,
+	}
+	if errTLS != nil {
+		client.log(context.Background(), LogLevelError, "Error configuring tls", LogFields{"client": config.ClientName, "error": errTLS})
 	}
+
+	return client
 }
 
-// Sethystrix setting for client
+// Err returns the error of the configuration of the client, such as an invalid TLS configuration,
+// with which every call of the client fails
+func (c *HTTPClient) Err() error {
+	return c.err
+}
+
+// Sethystrix setting for client with the default circuit breaker config
 func Sethystrix(nameClient string) {
-	hystrix.ConfigureCommand(nameClient, hystrix.CommandConfig{
-		Timeout:               5000,
-		MaxConcurrentRequests: 100,
-		ErrorPercentThreshold: 20,
-	})
+	configureCircuitBreaker(nameClient, CircuitBreakerConfig{})
 }
@@ -0,0 +1,202 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCallDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("slow") != "" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(2 * time.Second):
+			}
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, server.URL, HTTPClient{})
+
+	calls := map[string]func(ctx context.Context, path string, opts ...CallOption) *ResponseError{
+		"CallClient": func(ctx context.Context, path string, opts ...CallOption) *ResponseError {
+			return client.CallClient(WithCallOptions(ctx, opts...), path, GET, nil, &map[string]interface{}{}, false)
+		},
+		"CallClientWithCachingInRedis": func(ctx context.Context, path string, opts ...CallOption) *ResponseError {
+			return client.CallClientWithCachingInRedis(WithCallOptions(ctx, opts...), 60, path, GET, nil, &map[string]interface{}{}, false)
+		},
+		"CallClientWithCachingInRedisWithDifferentKey": func(ctx context.Context, path string, opts ...CallOption) *ResponseError {
+			return client.CallClientWithCachingInRedisWithDifferentKey(WithCallOptions(ctx, opts...), 60, path, "key", GET, nil, &map[string]interface{}{}, false)
+		},
+		"CallClientWithCircuitBreaker": func(ctx context.Context, path string, opts ...CallOption) *ResponseError {
+			return client.CallClientWithCircuitBreaker(WithCallOptions(ctx, opts...), path, GET, nil, &map[string]interface{}{}, false)
+		},
+		"CallClientWithBaseURLGiven": func(ctx context.Context, path string, opts ...CallOption) *ResponseError {
+			return client.CallClientWithBaseURLGiven(WithCallOptions(ctx, opts...), server.URL+"/"+path, GET, nil, &map[string]interface{}{}, false)
+		},
+		"CallClientWithRequestInBytes": func(ctx context.Context, path string, opts ...CallOption) *ResponseError {
+			return client.CallClientWithRequestInBytes(WithCallOptions(ctx, opts...), path, GET, nil, &map[string]interface{}{})
+		},
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		path    string
+		opts    []CallOption
+		wantErr error
+	}{
+		{name: "completed", ctx: context.Background(), path: "fast"},
+		{name: "per call timeout", ctx: context.Background(), path: "slow?slow=1", opts: []CallOption{WithTimeout(50 * time.Millisecond)}, wantErr: context.DeadlineExceeded},
+		{name: "canceled context", ctx: canceled, path: "fast", wantErr: context.Canceled},
+	}
+
+	for function, call := range calls {
+		for _, test := range tests {
+			t.Run(function+" "+test.name, func(t *testing.T) {
+				start := time.Now()
+				err := call(test.ctx, test.path, test.opts...).Err()
+
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("error = %v, want %v", err, test.wantErr)
+				}
+				if elapsed := time.Since(start); elapsed > time.Second {
+					t.Errorf("call returned after %s", elapsed)
+				}
+			})
+		}
+	}
+}
+
+// the interfaces implemented by the client
+var _ GenericHTTPClient = (*HTTPClient)(nil)
+var _ StreamingHTTPClient = (*HTTPClient)(nil)
+
+// baselineClient implements GenericHTTPClient with the method set it always had, without Stream nor call options
+type baselineClient struct {
+	ctx context.Context
+}
+
+func (b *baselineClient) Do(req *http.Request) (string, *ResponseError) {
+	return "", nil
+}
+
+func (b *baselineClient) CallClient(ctx context.Context, path string, method Method, request interface{}, result interface{}, isAcknowledgeNeeded bool) *ResponseError {
+	b.ctx = ctx
+	return nil
+}
+
+func (b *baselineClient) CallClientWithCachingInRedis(ctx context.Context, durationInSecond int, path string, method Method, request interface{}, result interface{}, isAcknowledgeNeeded bool) *ResponseError {
+	return nil
+}
+
+func (b *baselineClient) CallClientWithCachingInRedisWithDifferentKey(ctx context.Context, durationInSecond int, path string, pathToBeStoredAsKey string, method Method, request interface{}, result interface{}, isAcknowledgeNeeded bool) *ResponseError {
+	return nil
+}
+
+func (b *baselineClient) CallClientWithCircuitBreaker(ctx context.Context, path string, method Method, request interface{}, result interface{}, isAcknowledgeNeeded bool) *ResponseError {
+	return nil
+}
+
+func (b *baselineClient) CallClientWithBaseURLGiven(ctx context.Context, url string, method Method, request interface{}, result interface{}, isAcknowledgeNeeded bool) *ResponseError {
+	return nil
+}
+
+func (b *baselineClient) CallClientWithRequestInBytes(ctx context.Context, path string, method Method, request []byte, result interface{}) *ResponseError {
+	return nil
+}
+
+func (b *baselineClient) AddAuthentication(ctx context.Context, authorizationType AuthorizationType) {
+}
+
+func TestGenericHTTPClientImplementers(t *testing.T) {
+	var generic GenericHTTPClient = &baselineClient{}
+	if _, ok := generic.(StreamingHTTPClient); ok {
+		t.Fatalf("baseline client implements StreamingHTTPClient")
+	}
+
+	// Invoke passes its options to the implementers by the context
+	if _, err := Invoke[*invokeRequest, invokeResponse](context.Background(), generic, "drugs", GET, nil, WithRoute("/drugs")); err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	options := callOptions{}
+	for _, opt := range contextCallOptions(generic.(*baselineClient).ctx) {
+		opt(&options)
+	}
+	if options.route != "/drugs" {
+		t.Errorf("route = %q, want /drugs", options.route)
+	}
+}
+
+func TestWithCallOptions(t *testing.T) {
+	base := WithCallOptions(context.Background(), WithRoute("/first"), WithTimeout(time.Second))
+
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		opts        []CallOption
+		wantRoute   string
+		wantTimeout time.Duration
+	}{
+		{
+			name: "no options",
+			ctx:  context.Background(),
+		},
+		{
+			name:        "options of the context",
+			ctx:         base,
+			wantRoute:   "/first",
+			wantTimeout: time.Second,
+		},
+		{
+			name:        "options accumulated",
+			ctx:         WithCallOptions(base, WithRoute("/second")),
+			wantRoute:   "/second",
+			wantTimeout: time.Second,
+		},
+		{
+			name:        "options of the call applied last",
+			ctx:         base,
+			opts:        []CallOption{WithTimeout(2 * time.Second)},
+			wantRoute:   "/first",
+			wantTimeout: 2 * time.Second,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := newTestClient(t, "http://localhost", HTTPClient{})
+			call := &Call{Method: GET, URL: "http://localhost/drugs"}
+			// the canceled context stops the call before it is sent
+			ctx, cancel := context.WithCancel(test.ctx)
+			cancel()
+			_ = client.Execute(ctx, call, test.opts...)
+
+			if call.options.route != test.wantRoute {
+				t.Errorf("route = %q, want %q", call.options.route, test.wantRoute)
+			}
+			if call.options.timeout != test.wantTimeout {
+				t.Errorf("timeout = %s, want %s", call.options.timeout, test.wantTimeout)
+			}
+		})
+	}
+
+	// the accumulated options never share their backing array
+	first := WithCallOptions(base, WithRoute("/a"))
+	_ = WithCallOptions(base, WithRoute("/b"))
+	options := callOptions{}
+	for _, opt := range contextCallOptions(first) {
+		opt(&options)
+	}
+	if options.route != "/a" {
+		t.Errorf("route = %q, want /a", options.route)
+	}
+}
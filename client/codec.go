@@ -0,0 +1,299 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Codec encodes the requests and decodes the responses of a content type
+type Codec interface {
+	// Marshal encodes the request and returns its content type, which may carry parameters such as a boundary
+	Marshal(v interface{}) ([]byte, string, error)
+	// Unmarshal decodes the response into v
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec encodes and decodes application/json
+type JSONCodec struct{}
+
+// Marshal encodes v into json
+func (JSONCodec) Marshal(v interface{}) ([]byte, string, error) {
+	data, err := json.Marshal(v)
+	return data, "application/json", err
+}
+
+// Unmarshal decodes the json into v
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// XMLCodec encodes and decodes application/xml
+type XMLCodec struct{}
+
+// Marshal encodes v into xml
+func (XMLCodec) Marshal(v interface{}) ([]byte, string, error) {
+	data, err := xml.Marshal(v)
+	return data, "application/xml", err
+}
+
+// Unmarshal decodes the xml into v
+func (XMLCodec) Unmarshal(data []byte, v interface{}) error {
+	return xml.Unmarshal(data, v)
+}
+
+// FormCodec encodes and decodes application/x-www-form-urlencoded.
+//
+// The requests can be url.Values, map[string]string, map[string][]string, or any value encoded to a json object
+// whose fields become the form fields; the responses are decoded into *url.Values, *map[string]string
+// or *map[string][]string.
+type FormCodec struct{}
+
+// Marshal encodes v into a form
+func (FormCodec) Marshal(v interface{}) ([]byte, string, error) {
+	values, err := formValues(v)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return []byte(values.Encode()), "application/x-www-form-urlencoded", nil
+}
+
+// Unmarshal decodes the form into v
+func (FormCodec) Unmarshal(data []byte, v interface{}) error {
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+
+	switch result := v.(type) {
+	case *url.Values:
+		*result = values
+	case *map[string][]string:
+		*result = values
+	case *map[string]string:
+		*result = map[string]string{}
+		for key := range values {
+			(*result)[key] = values.Get(key)
+		}
+	default:
+		return fmt.Errorf("form codec cannot decode into %T", v)
+	}
+
+	return nil
+}
+
+// formValues converts the request into form values
+func formValues(v interface{}) (url.Values, error) {
+	switch request := v.(type) {
+	case url.Values:
+		return request, nil
+	case map[string][]string:
+		return request, nil
+	case map[string]string:
+		values := url.Values{}
+		for key, value := range request {
+			values.Set(key, value)
+		}
+		return values, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := map[string]interface{}{}
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("form codec cannot encode %T: %w", v, err)
+	}
+
+	values := url.Values{}
+	for key, field := range fields {
+		switch value := field.(type) {
+		case nil:
+		case []interface{}:
+			for _, item := range value {
+				values.Add(key, formValue(item))
+			}
+		default:
+			values.Set(key, formValue(value))
+		}
+	}
+
+	return values, nil
+}
+
+// formValue formats a json value as form value, objects are kept as json
+func formValue(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(value)
+		return string(data)
+	}
+
+	return fmt.Sprint(value)
+}
+
+// RawCodec sends and receives the bodies as they are.
+//
+// The requests can be []byte, string or io.Reader; the responses are decoded into *[]byte, *string or io.Writer.
+type RawCodec struct {
+	// ContentType is the content type of the requests, application/octet-stream by default
+	ContentType string
+}
+
+// Marshal returns the bytes of v
+func (r RawCodec) Marshal(v interface{}) ([]byte, string, error) {
+	contentType := r.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	switch request := v.(type) {
+	case []byte:
+		return request, contentType, nil
+	case string:
+		return []byte(request), contentType, nil
+	case io.Reader:
+		data, err := ioutil.ReadAll(request)
+		return data, contentType, err
+	}
+
+	return nil, "", fmt.Errorf("raw codec cannot encode %T", v)
+}
+
+// Unmarshal copies the bytes into v
+func (RawCodec) Unmarshal(data []byte, v interface{}) error {
+	switch result := v.(type) {
+	case *[]byte:
+		*result = append([]byte{}, data...)
+	case *string:
+		*result = string(data)
+	case io.Writer:
+		_, err := io.Copy(result, bytes.NewReader(data))
+		return err
+	default:
+		return fmt.Errorf("raw codec cannot decode into %T", v)
+	}
+
+	return nil
+}
+
+//
+// Private variables
+//
+
+// defaultCodecs are the codecs of the responses by media type, "+json" and "+xml" being suffixes
+var defaultCodecs = map[string]Codec{
+	"application/json":                  JSONCodec{},
+	"+json":                             JSONCodec{},
+	"application/xml":                   XMLCodec{},
+	"text/xml":                          XMLCodec{},
+	"+xml":                              XMLCodec{},
+	"application/x-www-form-urlencoded": FormCodec{},
+	"text/plain":                        RawCodec{},
+	"application/octet-stream":          RawCodec{},
+}
+
+// requestCodec returns the codec encoding the request of the call: the codec given as option,
+// the multipart, form or raw codec depending on the request type, and json otherwise
+func (call *Call) requestCodec() Codec {
+	if call.options.codec != nil {
+		return call.options.codec
+	}
+
+	switch call.Request.(type) {
+	case *MultipartForm, MultipartForm:
+		return MultipartCodec{}
+	case url.Values:
+		return FormCodec{}
+	case io.Reader:
+		return RawCodec{}
+	}
+
+	return JSONCodec{}
+}
+
+// responseCodec returns the codec decoding the response of the call: the codec given as option,
+// the raw codec for *[]byte and io.Writer results, the codec of the response content type, and json otherwise
+func (call *Call) responseCodec() Codec {
+	if call.options.responseCodec != nil {
+		return call.options.responseCodec
+	}
+
+	switch call.Result.(type) {
+	case *[]byte, io.Writer:
+		return RawCodec{}
+	}
+
+	mediaType, _, err := mime.ParseMediaType(call.ResponseHeader.Get("Content-Type"))
+	if err != nil {
+		return JSONCodec{}
+	}
+
+	for _, codecs := range []map[string]Codec{call.codecs, defaultCodecs} {
+		if codec, ok := codecs[mediaType]; ok {
+			return rawOrJSON(codec, call.Result)
+		}
+	}
+
+	// the suffixes are matched from the longest, e.g. application/problem+json
+	for _, codecs := range []map[string]Codec{call.codecs, defaultCodecs} {
+		suffixes := []string{}
+		for suffix := range codecs {
+			if strings.HasPrefix(suffix, "+") && strings.HasSuffix(mediaType, suffix) {
+				suffixes = append(suffixes, suffix)
+			}
+		}
+		sort.Slice(suffixes, func(i, j int) bool { return len(suffixes[i]) > len(suffixes[j]) })
+		if len(suffixes) > 0 {
+			return rawOrJSON(codecs[suffixes[0]], call.Result)
+		}
+	}
+
+	return JSONCodec{}
+}
+
+// rawOrJSON keeps decoding the text responses as json when the result cannot receive the raw body,
+// as the responses were decoded before the codecs
+func rawOrJSON(codec Codec, result interface{}) Codec {
+	if _, ok := codec.(RawCodec); !ok {
+		return codec
+	}
+
+	switch result.(type) {
+	case *[]byte, *string, io.Writer:
+		return codec
+	}
+
+	return JSONCodec{}
+}
+
+// encodeRequest encodes the request of the call into its body when the body is not given
+func (call *Call) encodeRequest() *ResponseError {
+	if call.Body != nil || call.Request == nil || call.Request == "" {
+		return nil
+	}
+
+	body, contentType, err := call.requestCodec().Marshal(call.Request)
+	if err != nil {
+		return &ResponseError{
+			Error: err,
+		}
+	}
+
+	call.Body = body
+	if call.Header.Get("Content-Type") == "" && contentType != "" {
+		call.Header.Set("Content-Type", contentType)
+	}
+
+	return nil
+}
@@ -0,0 +1,236 @@
+package client
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type labResult struct {
+	XMLName xml.Name `xml:"result" json:"-"`
+	Code    string   `xml:"code" json:"code"`
+	Value   int      `xml:"value" json:"value"`
+}
+
+// csvCodec decodes the first line of a csv into a *[]string
+type csvCodec struct{}
+
+func (csvCodec) Marshal(v interface{}) ([]byte, string, error) {
+	return []byte(strings.Join(v.([]string), ",")), "text/csv", nil
+}
+
+func (csvCodec) Unmarshal(data []byte, v interface{}) error {
+	result, ok := v.(*[]string)
+	if !ok {
+		return fmt.Errorf("csv codec cannot decode into %T", v)
+	}
+	*result = strings.Split(strings.SplitN(string(data), "\n", 2)[0], ",")
+	return nil
+}
+
+func TestCodecs(t *testing.T) {
+	tests := []struct {
+		name            string
+		request         interface{}
+		opts            []CallOption
+		codecs          map[string]Codec
+		wantContentType string
+		wantBody        string
+		contentType     string
+		response        string
+		result          func() interface{}
+		want            interface{}
+		wantErr         bool
+	}{
+		{
+			name:            "json by default",
+			request:         labResult{Code: "HB", Value: 13},
+			wantContentType: "application/json",
+			wantBody:        `{"code":"HB","value":13}`,
+			contentType:     "application/json; charset=utf-8",
+			response:        `{"code":"HB","value":14}`,
+			result:          func() interface{} { return &labResult{} },
+			want:            &labResult{Code: "HB", Value: 14},
+		},
+		{
+			name:            "xml",
+			request:         labResult{Code: "HB", Value: 13},
+			opts:            []CallOption{WithCodec(XMLCodec{})},
+			wantContentType: "application/xml",
+			wantBody:        `<result><code>HB</code><value>13</value></result>`,
+			contentType:     "text/xml",
+			response:        `<result><code>HB</code><value>14</value></result>`,
+			result:          func() interface{} { return &labResult{} },
+			want:            &labResult{XMLName: xml.Name{Local: "result"}, Code: "HB", Value: 14},
+		},
+		{
+			name:            "form values",
+			request:         url.Values{"code": {"HB"}, "tags": {"a", "b"}},
+			wantContentType: "application/x-www-form-urlencoded",
+			wantBody:        `code=HB&tags=a&tags=b`,
+			contentType:     "application/x-www-form-urlencoded",
+			response:        `status=accepted`,
+			result:          func() interface{} { return &url.Values{} },
+			want:            &url.Values{"status": {"accepted"}},
+		},
+		{
+			name:            "struct as form",
+			request:         labResult{Code: "HB", Value: 13},
+			opts:            []CallOption{WithCodec(FormCodec{})},
+			wantContentType: "application/x-www-form-urlencoded",
+			wantBody:        `code=HB&value=13`,
+			contentType:     "application/x-www-form-urlencoded",
+			response:        `status=accepted`,
+			result:          func() interface{} { return &map[string]string{} },
+			want:            &map[string]string{"status": "accepted"},
+		},
+		{
+			name:            "raw bytes",
+			request:         []byte("HB;13"),
+			opts:            []CallOption{WithCodec(RawCodec{ContentType: "text/plain"})},
+			wantContentType: "text/plain",
+			wantBody:        `HB;13`,
+			contentType:     "application/pdf",
+			response:        `%PDF-1.4`,
+			result:          func() interface{} { return &[]byte{} },
+			want:            &[]byte{'%', 'P', 'D', 'F', '-', '1', '.', '4'},
+		},
+		{
+			name:        "json suffix",
+			contentType: "application/problem+json",
+			response:    `{"code":"HB","value":14}`,
+			result:      func() interface{} { return &labResult{} },
+			want:        &labResult{Code: "HB", Value: 14},
+		},
+		{
+			name:        "text decoded as json into a struct",
+			contentType: "text/plain",
+			response:    `{"code":"HB","value":14}`,
+			result:      func() interface{} { return &labResult{} },
+			want:        &labResult{Code: "HB", Value: 14},
+		},
+		{
+			name:        "text into a string",
+			contentType: "text/plain",
+			response:    `HB 14`,
+			result:      func() interface{} { s := ""; return &s },
+			want:        func() *string { s := "HB 14"; return &s }(),
+		},
+		{
+			name:            "codec of the client",
+			request:         []string{"HB", "13"},
+			opts:            []CallOption{WithCodec(csvCodec{})},
+			codecs:          map[string]Codec{"text/csv": csvCodec{}},
+			wantContentType: "text/csv",
+			wantBody:        `HB,13`,
+			contentType:     "text/csv",
+			response:        "HB,14\nLDL,100",
+			result:          func() interface{} { return &[]string{} },
+			want:            &[]string{"HB", "14"},
+		},
+		{
+			name:        "response codec given per call",
+			opts:        []CallOption{WithResponseCodec(XMLCodec{})},
+			contentType: "application/octet-stream",
+			response:    `<result><code>HB</code></result>`,
+			result:      func() interface{} { return &labResult{} },
+			want:        &labResult{XMLName: xml.Name{Local: "result"}, Code: "HB"},
+		},
+		{
+			name:        "invalid xml",
+			contentType: "application/xml",
+			response:    `<result><code>`,
+			result:      func() interface{} { return &labResult{} },
+			wantErr:     true,
+		},
+		{
+			name:        "form into a struct",
+			contentType: "application/x-www-form-urlencoded",
+			response:    `status=accepted`,
+			result:      func() interface{} { return &labResult{} },
+			wantErr:     true,
+		},
+		{
+			name:    "request the codec cannot encode",
+			request: labResult{},
+			opts:    []CallOption{WithCodec(RawCodec{})},
+			result:  func() interface{} { return &labResult{} },
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				// the calls without request still send the json content type
+				wantContentType := test.wantContentType
+				if wantContentType == "" {
+					wantContentType = "application/json"
+				}
+				if contentType := r.Header.Get("Content-Type"); contentType != wantContentType {
+					t.Errorf("content type = %q, want %q", contentType, wantContentType)
+				}
+				if string(body) != test.wantBody {
+					t.Errorf("body = %q, want %q", body, test.wantBody)
+				}
+				w.Header().Set("Content-Type", test.contentType)
+				_, _ = w.Write([]byte(test.response))
+			}))
+			defer server.Close()
+
+			client := newTestClient(t, server.URL, HTTPClient{Codecs: test.codecs})
+			result := test.result()
+			errDo := client.CallClient(WithCallOptions(context.Background(), test.opts...), "results", POST, test.request, result, false)
+			if (errDo.Err() != nil) != test.wantErr {
+				t.Fatalf("error = %v, want error %v", errDo.Err(), test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(result, test.want) {
+				t.Errorf("result = %#v, want %#v", result, test.want)
+			}
+		})
+	}
+}
+
+func TestMultipartCodec(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType != "multipart/form-data" {
+			t.Errorf("content type = %q", r.Header.Get("Content-Type"))
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatalf("parse error = %v", err)
+		}
+		file, header, err := r.FormFile("report")
+		if err != nil {
+			t.Fatalf("file error = %v", err)
+		}
+		content, _ := ioutil.ReadAll(file)
+		_, _ = fmt.Fprintf(w, `{"patient":%q,"file":%q,"type":%q,"content":%q}`,
+			r.FormValue("patient"), header.Filename, header.Header.Get("Content-Type"), content)
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, server.URL, HTTPClient{})
+	form := &MultipartForm{
+		Fields: url.Values{"patient": {"patient-1"}},
+		Files:  []MultipartFile{{FieldName: "report", FileName: `lab "2024".pdf`, ContentType: "application/pdf", Content: strings.NewReader("%PDF")}},
+	}
+
+	result := map[string]string{}
+	if errDo := client.CallClient(context.Background(), "reports", POST, form, &result, false); errDo.Err() != nil {
+		t.Fatalf("error = %v", errDo.Err())
+	}
+	want := map[string]string{"patient": "patient-1", "file": `lab "2024".pdf`, "type": "application/pdf", "content": "%PDF"}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("received %v, want %v", result, want)
+	}
+}
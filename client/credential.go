@@ -0,0 +1,303 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+//
+// Private constants
+//
+
+const defaultCredentialHeaderName = "Authorization"
+const defaultCredentialRefreshBefore = 30 * time.Second
+
+// Token represents a credential sent in a header of the calls
+type Token struct {
+	// HeaderName is the header carrying the token, Authorization by default
+	HeaderName string
+	// Type prefixes the value in the header when not empty, e.g. "Bearer"
+	Type string
+	// Value is the token itself
+	Value string
+	// ExpiresAt is the expiration of the token, the token never expires when zero
+	ExpiresAt time.Time
+}
+
+// headerName returns the header carrying the token
+func (t *Token) headerName() string {
+	if t.HeaderName == "" {
+		return defaultCredentialHeaderName
+	}
+
+	return t.HeaderName
+}
+
+// headerValue returns the value of the header carrying the token
+func (t *Token) headerValue() string {
+	if t.Type == "" {
+		return t.Value
+	}
+
+	return t.Type + " " + t.Value
+}
+
+// CredentialProvider fetches the token of the client.
+//
+// The tokens are cached by the client, which calls the provider again shortly before their expiration,
+// or right away when the upstream answers 401.
+type CredentialProvider interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// CredentialProviderFunc is an adapter to use an ordinary function as CredentialProvider
+type CredentialProviderFunc func(ctx context.Context) (*Token, error)
+
+// Token calls f(ctx)
+func (f CredentialProviderFunc) Token(ctx context.Context) (*Token, error) {
+	return f(ctx)
+}
+
+// StaticCredentialProvider provides a token which never changes
+type StaticCredentialProvider struct {
+	token Token
+}
+
+// Token returns the static token
+func (s *StaticCredentialProvider) Token(ctx context.Context) (*Token, error) {
+	token := s.token
+	return &token, nil
+}
+
+// NewStaticCredentialProvider creates the provider of the static token
+func NewStaticCredentialProvider(token Token) *StaticCredentialProvider {
+	return &StaticCredentialProvider{
+		token: token,
+	}
+}
+
+// OAuth2ClientCredentialsConfig represents the configuration of the OAuth2 client credentials grant
+type OAuth2ClientCredentialsConfig struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// EndpointParams are the additional parameters sent to the token endpoint, e.g. audience
+	EndpointParams url.Values
+	// AuthInBody sends the client id and secret as form parameters instead of the basic authorization header
+	AuthInBody bool
+	// HTTPClient sends the token requests, the default http client of the package by default
+	HTTPClient *http.Client
+}
+
+// OAuth2ClientCredentialsProvider fetches the tokens from an OAuth2 token endpoint with the client credentials grant
+type OAuth2ClientCredentialsProvider struct {
+	config OAuth2ClientCredentialsConfig
+}
+
+// oauth2TokenResponse represents the response of the token endpoint, following RFC 6749
+type oauth2TokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Token requests a new access token
+func (o *OAuth2ClientCredentialsProvider) Token(ctx context.Context) (*Token, error) {
+	form := url.Values{}
+	for key, values := range o.config.EndpointParams {
+		form[key] = values
+	}
+	form.Set("grant_type", "client_credentials")
+	if len(o.config.Scopes) > 0 {
+		form.Set("scope", strings.Join(o.config.Scopes, " "))
+	}
+	if o.config.AuthInBody {
+		form.Set("client_id", o.config.ClientID)
+		form.Set("client_secret", o.config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if !o.config.AuthInBody {
+		req.SetBasicAuth(url.QueryEscape(o.config.ClientID), url.QueryEscape(o.config.ClientSecret))
+	}
+
+	client := o.config.HTTPClient
+	if client == nil {
+		client = httpClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	response := oauth2TokenResponse{}
+	if err = json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("Error while parsing token of [%s] with status %d: %w", o.config.TokenURL, res.StatusCode, err)
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 || response.AccessToken == "" {
+		return nil, fmt.Errorf("Error while requesting token of [%s] with status %d: %s", o.config.TokenURL, res.StatusCode, strings.TrimSpace(response.Error+" "+response.ErrorDescription))
+	}
+
+	token := &Token{
+		Type:  "Bearer",
+		Value: response.AccessToken,
+	}
+	if response.TokenType != "" && !strings.EqualFold(response.TokenType, "bearer") {
+		token.Type = response.TokenType
+	}
+	if response.ExpiresIn > 0 {
+		token.ExpiresAt = time.Now().Add(time.Duration(response.ExpiresIn) * time.Second)
+	}
+
+	return token, nil
+}
+
+// NewOAuth2ClientCredentialsProvider creates the provider of the OAuth2 client credentials grant
+func NewOAuth2ClientCredentialsProvider(config OAuth2ClientCredentialsConfig) *OAuth2ClientCredentialsProvider {
+	return &OAuth2ClientCredentialsProvider{
+		config: config,
+	}
+}
+
+// credentialCache caches the token of the provider and refreshes it before its expiration
+type credentialCache struct {
+	mutex         sync.Mutex
+	refreshes     singleflight.Group
+	provider      CredentialProvider
+	refreshBefore time.Duration
+	token         *Token
+}
+
+// get returns the cached token, refreshed when it expires soon or when it is the rejected one.
+// The rejected token avoids refreshing again when another call already did.
+//
+// The concurrent refreshes are coalesced into a single call of the provider, detached from the context
+// of the call starting it, and every call waits for it on its own context.
+func (c *credentialCache) get(ctx context.Context, rejected *Token) (*Token, error) {
+	c.mutex.Lock()
+	token := c.token
+	c.mutex.Unlock()
+
+	if token != nil && token != rejected {
+		if token.ExpiresAt.IsZero() || time.Now().Add(c.refreshBefore).Before(token.ExpiresAt) {
+			return token, nil
+		}
+	}
+
+	refresh := c.refreshes.DoChan("token", func() (interface{}, error) {
+		refreshCtx, cancel := context.WithTimeout(detachedContext{ctx}, defaultHTTPTimeout)
+		defer cancel()
+
+		token, err := c.provider.Token(refreshCtx)
+		if err != nil {
+			return nil, err
+		}
+		if token == nil {
+			return nil, fmt.Errorf("credential provider returned no token")
+		}
+
+		c.mutex.Lock()
+		c.token = token
+		c.mutex.Unlock()
+
+		return token, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-refresh:
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		return result.Val.(*Token), nil
+	}
+}
+
+// headerName returns the header carrying the cached token, empty before the first token
+func (c *credentialCache) headerName() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.token == nil {
+		return ""
+	}
+
+	return c.token.headerName()
+}
+
+func newCredentialCache(provider CredentialProvider) *credentialCache {
+	return &credentialCache{
+		provider:      provider,
+		refreshBefore: defaultCredentialRefreshBefore,
+	}
+}
+
+// credentials adds the token of the credential provider to the call,
+// and sends the call once again with a refreshed token when the upstream answers 401 and the body can be sent again
+func (c *HTTPClient) credentials() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) *ResponseError {
+			token, errDo := c.credentialToken(ctx, nil)
+			if errDo != nil {
+				return errDo
+			}
+			call.Header.Set(token.headerName(), token.headerValue())
+
+			errDo = next(ctx, call)
+			if call.StatusCode != http.StatusUnauthorized || !call.replayable() {
+				return errDo
+			}
+
+			refreshed, errRefresh := c.credentialToken(ctx, token)
+			if errRefresh != nil {
+				return errDo
+			}
+			call.Header.Del(token.headerName())
+			call.Header.Set(refreshed.headerName(), refreshed.headerValue())
+			call.Response = ""
+			call.StatusCode = 0
+			call.ResponseHeader = nil
+
+			return next(ctx, call)
+		}
+	}
+}
+
+// credentialToken returns the token of the credential provider as response error when it fails
+func (c *HTTPClient) credentialToken(ctx context.Context, rejected *Token) (*Token, *ResponseError) {
+	token, err := c.credentialCache.get(ctx, rejected)
+	if err != nil {
+		return nil, &ResponseError{
+			Message: "Error while collecting credential",
+			Error:   err,
+			Info:    fmt.Sprintf("Error when collecting credential of [%s]", c.ClientName),
+		}
+	}
+
+	return token, nil
+}
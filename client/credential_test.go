@@ -0,0 +1,255 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestOAuth2ClientCredentialsProvider(t *testing.T) {
+	tests := []struct {
+		name       string
+		authInBody bool
+		status     int
+		response   string
+		want       Token
+		wantErr    bool
+	}{
+		{
+			name:     "token with basic authentication",
+			status:   http.StatusOK,
+			response: `{"access_token":"abc","token_type":"bearer","expires_in":3600}`,
+			want:     Token{Type: "Bearer", Value: "abc"},
+		},
+		{
+			name:       "token with credentials in the body",
+			authInBody: true,
+			status:     http.StatusOK,
+			response:   `{"access_token":"abc","token_type":"MAC"}`,
+			want:       Token{Type: "MAC", Value: "abc"},
+		},
+		{
+			name:     "rejected credentials",
+			status:   http.StatusUnauthorized,
+			response: `{"error":"invalid_client","error_description":"unknown client"}`,
+			wantErr:  true,
+		},
+		{
+			name:     "response without token",
+			status:   http.StatusOK,
+			response: `{"token_type":"bearer"}`,
+			wantErr:  true,
+		},
+		{
+			name:     "response not json",
+			status:   http.StatusBadGateway,
+			response: `<html>bad gateway</html>`,
+			wantErr:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_ = r.ParseForm()
+				clientID, clientSecret, basic := r.BasicAuth()
+				if !basic {
+					clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+				}
+				if basic == test.authInBody || clientID != "medicplus" || clientSecret != "s3cret" {
+					t.Errorf("credentials %q %q sent in the body %v", clientID, clientSecret, !basic)
+				}
+				if r.PostForm.Get("grant_type") != "client_credentials" || r.PostForm.Get("scope") != "drugs:read drugs:write" || r.PostForm.Get("audience") != "drugs" {
+					t.Errorf("form = %v", r.PostForm)
+				}
+				w.WriteHeader(test.status)
+				_, _ = w.Write([]byte(test.response))
+			}))
+			defer server.Close()
+
+			provider := NewOAuth2ClientCredentialsProvider(OAuth2ClientCredentialsConfig{
+				TokenURL:       server.URL,
+				ClientID:       "medicplus",
+				ClientSecret:   "s3cret",
+				Scopes:         []string{"drugs:read", "drugs:write"},
+				EndpointParams: map[string][]string{"audience": {"drugs"}},
+				AuthInBody:     test.authInBody,
+			})
+
+			token, err := provider.Token(context.Background())
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error = %v, want error %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			if token.Type != test.want.Type || token.Value != test.want.Value {
+				t.Errorf("token = %+v, want %+v", token, test.want)
+			}
+		})
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	tests := []struct {
+		name          string
+		tokens        []string
+		providerErr   error
+		wantProvider  int32
+		wantUpstream  int32
+		wantErr       bool
+		wantLastToken string
+	}{
+		{
+			name:          "valid token",
+			tokens:        []string{"valid"},
+			wantProvider:  1,
+			wantUpstream:  1,
+			wantLastToken: "Bearer valid",
+		},
+		{
+			name:          "rejected token refreshed once",
+			tokens:        []string{"expired", "valid"},
+			wantProvider:  2,
+			wantUpstream:  2,
+			wantLastToken: "Bearer valid",
+		},
+		{
+			name:          "refreshed token rejected again",
+			tokens:        []string{"expired", "revoked"},
+			wantProvider:  2,
+			wantUpstream:  2,
+			wantErr:       true,
+			wantLastToken: "Bearer revoked",
+		},
+		{
+			name:         "provider failure",
+			providerErr:  errors.New("vault unavailable"),
+			wantProvider: 1,
+			wantErr:      true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var upstream int32
+			lastToken := ""
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&upstream, 1)
+				lastToken = r.Header.Get("Authorization")
+				if lastToken != "Bearer valid" {
+					w.WriteHeader(http.StatusUnauthorized)
+				}
+				_, _ = w.Write([]byte(`{}`))
+			}))
+			defer server.Close()
+
+			var provided int32
+			provider := CredentialProviderFunc(func(ctx context.Context) (*Token, error) {
+				i := atomic.AddInt32(&provided, 1)
+				if test.providerErr != nil {
+					return nil, test.providerErr
+				}
+				return &Token{Type: "Bearer", Value: test.tokens[i-1]}, nil
+			})
+			client := newTestClient(t, server.URL, HTTPClient{CredentialProvider: provider})
+
+			errDo := client.CallClient(context.Background(), "drugs", POST, map[string]string{"name": "aspirin"}, nil, false)
+			if (errDo.Err() != nil) != test.wantErr {
+				t.Fatalf("error = %v, want error %v", errDo.Err(), test.wantErr)
+			}
+			if test.providerErr != nil && !errors.Is(errDo.Err(), test.providerErr) {
+				t.Errorf("error = %v, want the error of the provider", errDo.Err())
+			}
+			if got := atomic.LoadInt32(&provided); got != test.wantProvider {
+				t.Errorf("provider called %d times, want %d", got, test.wantProvider)
+			}
+			if got := atomic.LoadInt32(&upstream); got != test.wantUpstream {
+				t.Errorf("upstream called %d times, want %d", got, test.wantUpstream)
+			}
+			if lastToken != test.wantLastToken {
+				t.Errorf("upstream received %q, want %q", lastToken, test.wantLastToken)
+			}
+		})
+	}
+}
+
+func TestCredentialsRefresh(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	var provided int32
+	expiresAt := time.Now().Add(time.Hour)
+	provider := CredentialProviderFunc(func(ctx context.Context) (*Token, error) {
+		i := atomic.AddInt32(&provided, 1)
+		time.Sleep(50 * time.Millisecond)
+		return &Token{Value: fmt.Sprint("token-", i), ExpiresAt: expiresAt}, nil
+	})
+	client := newTestClient(t, server.URL, HTTPClient{CredentialProvider: provider})
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if errDo := client.CallClient(context.Background(), "drugs", GET, nil, nil, false); errDo.Err() != nil {
+				t.Errorf("error = %v", errDo.Err())
+			}
+		}()
+	}
+	wg.Wait()
+	if got := atomic.LoadInt32(&provided); got != 1 {
+		t.Fatalf("provider called %d times by the concurrent calls, want 1", got)
+	}
+
+	// a token expiring within the refresh margin is refreshed by the next call
+	expiresAt = time.Now().Add(time.Second)
+	client.credentialCache.token.ExpiresAt = expiresAt
+	_ = client.CallClient(context.Background(), "drugs", GET, nil, nil, false)
+	if got := atomic.LoadInt32(&provided); got != 2 {
+		t.Errorf("provider called %d times once the token expires soon, want 2", got)
+	}
+}
+
+func TestAddAuthentication(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	initial := []AuthorizationType{Bearer}
+	client := newTestClient(t, server.URL, HTTPClient{AuthorizationTypes: initial})
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			authorizationType := Bearer
+			authorizationType.Token = fmt.Sprint("token-", i)
+			client.AddAuthentication(context.Background(), authorizationType)
+		}(i)
+		go func() {
+			defer wg.Done()
+			_ = client.CallClient(context.Background(), "drugs", GET, nil, nil, false)
+		}()
+	}
+	wg.Wait()
+
+	client.AddAuthentication(context.Background(), Secret)
+	authorizationTypes := client.authorizationTypes()
+	if len(authorizationTypes) != 2 || authorizationTypes[0].Token == "" {
+		t.Errorf("authorization types = %+v, want the updated bearer and the secret", authorizationTypes)
+	}
+	if len(initial) != 1 || initial[0].Token != "" || len(client.AuthorizationTypes) != 1 {
+		t.Errorf("authorization types of the config updated to %+v", initial)
+	}
+}
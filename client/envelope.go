@@ -0,0 +1,75 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+// envelope represents the ResolveStructure of the kit wrapping the successful responses
+type envelope struct {
+	Data     json.RawMessage        `json:"data"`
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+// responseErrorBody represents the error bodies, the ones of ResponseError as well as the ones written by
+// the EncodeError of the kit ({"error": "...", "code": 404, "message": "..."}) or its RejectStructure
+type responseErrorBody struct {
+	Code       json.RawMessage `json:"code"`
+	Message    string          `json:"message"`
+	StatusCode int             `json:"statusCode"`
+	Error      json.RawMessage `json:"error"`
+	Info       string          `json:"info"`
+}
+
+// UnmarshalJSON decodes the error body of a failed call, the code being a string or a number
+// and the error a string; the errors encoded as objects are ignored
+func (e *ResponseError) UnmarshalJSON(data []byte) error {
+	var body responseErrorBody
+	if err := json.Unmarshal(data, &body); err != nil {
+		return err
+	}
+
+	var code string
+	if err := json.Unmarshal(body.Code, &code); err == nil {
+		e.Code = code
+	} else if number, err := strconv.Atoi(string(body.Code)); err == nil {
+		e.Code = strconv.Itoa(number)
+	}
+
+	var message string
+	if err := json.Unmarshal(body.Error, &message); err == nil && message != "" {
+		e.Error = errors.New(message)
+	}
+
+	if body.Message != "" {
+		e.Message = body.Message
+	}
+	if body.StatusCode != 0 {
+		e.StatusCode = body.StatusCode
+	}
+	if body.Info != "" {
+		e.Info = body.Info
+	}
+
+	return nil
+}
+
+// decodeEnvelope unwraps the `data` of the json response into the call result and keeps its `metadata`
+func (call *Call) decodeEnvelope() error {
+	var body envelope
+	if err := json.Unmarshal([]byte(call.Response), &body); err != nil {
+		return err
+	}
+
+	call.Metadata = body.Metadata
+	if call.options.metadata != nil {
+		*call.options.metadata = body.Metadata
+	}
+
+	if call.Result == nil || len(body.Data) == 0 || string(body.Data) == "null" {
+		return nil
+	}
+
+	return json.Unmarshal(body.Data, call.Result)
+}
@@ -0,0 +1,224 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	libError "github.com/medicplus-inc/medicplus-kit/error"
+	"github.com/medicplus-inc/medicplus-kit/net/http/encoding"
+	"github.com/medicplus-inc/medicplus-kit/net/structure"
+)
+
+type envelopedPatient struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestEnvelope(t *testing.T) {
+	tests := []struct {
+		name         string
+		envelope     bool
+		opts         []CallOption
+		response     interface{}
+		contentType  string
+		want         envelopedPatient
+		wantMetadata map[string]interface{}
+		wantErr      bool
+	}{
+		{
+			name:         "data unwrapped by the client",
+			envelope:     true,
+			response:     structure.ResolveStructure{Data: envelopedPatient{ID: 1, Name: "Budi"}, Metadata: map[string]interface{}{"request_took": "1ms"}},
+			want:         envelopedPatient{ID: 1, Name: "Budi"},
+			wantMetadata: map[string]interface{}{"request_took": "1ms"},
+		},
+		{
+			name:         "data unwrapped by the call",
+			opts:         []CallOption{WithEnvelope()},
+			response:     structure.ResolveStructure{Data: envelopedPatient{ID: 2}, Metadata: map[string]interface{}{"page": "1"}},
+			want:         envelopedPatient{ID: 2},
+			wantMetadata: map[string]interface{}{"page": "1"},
+		},
+		{
+			name:     "null data",
+			envelope: true,
+			response: structure.ResolveStructure{},
+		},
+		{
+			name:     "response kept whole without envelope",
+			response: envelopedPatient{ID: 3},
+			want:     envelopedPatient{ID: 3},
+		},
+		{
+			name:        "responses of other codecs not unwrapped",
+			envelope:    true,
+			response:    `<envelopedPatient><ID>4</ID></envelopedPatient>`,
+			contentType: "application/xml",
+			want:        envelopedPatient{ID: 4},
+		},
+		{
+			name:     "invalid envelope",
+			envelope: true,
+			response: `[1]`,
+			wantErr:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if raw, ok := test.response.(string); ok {
+					w.Header().Set("Content-Type", test.contentType)
+					_, _ = w.Write([]byte(raw))
+					return
+				}
+				_ = encoding.Encode()(r.Context(), w, test.response)
+			}))
+			defer server.Close()
+
+			client := newTestClient(t, server.URL, HTTPClient{Envelope: test.envelope})
+			metadata := map[string]interface{}{}
+			opts := append(test.opts, WithMetadata(&metadata))
+			if !test.envelope && len(test.opts) == 0 {
+				opts = nil
+			}
+
+			result := envelopedPatient{}
+			call := &Call{Method: GET, URL: server.URL + "/patients/1", Result: &result}
+			err := client.Execute(context.Background(), call, opts...).Err()
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error = %v, want error %t", err, test.wantErr)
+			}
+			if result != test.want {
+				t.Errorf("result = %+v, want %+v", result, test.want)
+			}
+			for key, value := range test.wantMetadata {
+				if call.Metadata[key] != value || metadata[key] != value {
+					t.Errorf("metadata = %v and %v, want %v", call.Metadata, metadata, test.wantMetadata)
+				}
+			}
+		})
+	}
+}
+
+func TestResponseErrorBody(t *testing.T) {
+	cause := errors.New("patient not found")
+
+	tests := []struct {
+		name        string
+		write       func(w http.ResponseWriter, r *http.Request)
+		wantCode    string
+		wantMessage string
+		wantStatus  int
+		wantCause   string
+	}{
+		{
+			name: "EncodeError of a kit error",
+			write: func(w http.ResponseWriter, r *http.Request) {
+				encoding.EncodeError(r.Context(), libError.New(cause, http.StatusNotFound, "Patient not found"), w)
+			},
+			wantCode:    "404",
+			wantMessage: "Patient not found",
+			wantStatus:  http.StatusNotFound,
+			wantCause:   "patient not found",
+		},
+		{
+			name: "EncodeError of another error",
+			write: func(w http.ResponseWriter, r *http.Request) {
+				encoding.EncodeError(r.Context(), errors.New("database down"), w)
+			},
+			wantCode:    "500",
+			wantMessage: "Something Went Wrong",
+			wantStatus:  http.StatusInternalServerError,
+			wantCause:   "database down",
+		},
+		{
+			name: "response error body",
+			write: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusConflict)
+				_, _ = w.Write([]byte(`{"code":"DUPLICATE","message":"duplicate","statusCode":409,"info":"Patient already exists"}`))
+			},
+			wantCode:    "DUPLICATE",
+			wantMessage: "Patient already exists",
+			wantStatus:  http.StatusConflict,
+		},
+		{
+			name: "error encoded as object ignored",
+			write: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"code":400,"message":"invalid","error":{"field":"name"}}`))
+			},
+			wantCode:    "400",
+			wantMessage: "invalid",
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name: "body which is not json",
+			write: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadGateway)
+				_, _ = w.Write([]byte(`<html>bad gateway</html>`))
+			},
+			wantCode:   "502",
+			wantStatus: http.StatusBadGateway,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(test.write))
+			defer server.Close()
+
+			client := newTestClient(t, server.URL, HTTPClient{})
+			errDo := client.CallClient(context.Background(), "patients/1", POST, nil, nil, false)
+
+			if errDo.Code != test.wantCode || errDo.Message != test.wantMessage || errDo.StatusCode != test.wantStatus {
+				t.Errorf("error = %q %q %d, want %q %q %d", errDo.Code, errDo.Message, errDo.StatusCode,
+					test.wantCode, test.wantMessage, test.wantStatus)
+			}
+			if errDo.Err() == nil {
+				t.Fatalf("no error")
+			}
+			if test.wantCause != "" && (errors.Unwrap(errDo.Error) == nil || errors.Unwrap(errDo.Error).Error() != test.wantCause) {
+				t.Errorf("cause of %v, want %q", errDo.Error, test.wantCause)
+			}
+		})
+	}
+}
+
+func TestResponseErrorUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		body      string
+		want      ResponseError
+		wantError string
+		wantErr   bool
+	}{
+		{body: `{"code":"E1","message":"m","statusCode":400,"info":"i"}`, want: ResponseError{Code: "E1", Message: "m", StatusCode: 400, Info: "i"}},
+		{body: `{"code":404,"error":"not found"}`, want: ResponseError{Code: "404"}, wantError: "not found"},
+		{body: `{"code":{"nested":true},"error":""}`},
+		{body: `[]`, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.body, func(t *testing.T) {
+			got := ResponseError{}
+			err := json.Unmarshal([]byte(test.body), &got)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error = %v, want error %t", err, test.wantErr)
+			}
+
+			cause := ""
+			if got.Error != nil {
+				cause = got.Error.Error()
+			}
+			got.Error = nil
+			if got != test.want || cause != test.wantError || strings.Contains(cause, "{") {
+				t.Errorf("decoded = %+v with %q, want %+v with %q", got, cause, test.want, test.wantError)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Sentinel errors matched by errors.Is against the status code of a failed call
+var (
+	ErrBadRequest      = errors.New("bad request")
+	ErrUnauthorized    = errors.New("unauthorized")
+	ErrForbidden       = errors.New("forbidden")
+	ErrNotFound        = errors.New("not found")
+	ErrConflict        = errors.New("conflict")
+	ErrTooManyRequests = errors.New("too many requests")
+	ErrServerError     = errors.New("server error")
+
+	// ErrCircuitBreakerRejected matches the calls rejected by the circuit breaker (open, timeout, max concurrency)
+	ErrCircuitBreakerRejected = errors.New("circuit breaker rejected")
+
+	// ErrRateLimited matches the calls rejected by the rate limits of the client
+	ErrRateLimited = errors.New("rate limited")
+)
+
+// CallError represents a failed client call as a go error
+type CallError struct {
+	Response *ResponseError
+}
+
+// Error returns the message of the failed call
+func (e *CallError) Error() string {
+	if e.Response.Error != nil {
+		return e.Response.Error.Error()
+	}
+
+	return e.Response.Message
+}
+
+// Unwrap returns the underlying error of the failed call
+func (e *CallError) Unwrap() error {
+	return e.Response.Error
+}
+
+// Is matches the sentinel errors against the status code of the failed call
+func (e *CallError) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.Response.StatusCode == http.StatusBadRequest
+	case ErrUnauthorized:
+		return e.Response.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.Response.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.Response.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.Response.StatusCode == http.StatusConflict
+	case ErrTooManyRequests:
+		return e.Response.StatusCode == http.StatusTooManyRequests
+	case ErrServerError:
+		return e.Response.StatusCode >= http.StatusInternalServerError
+	case ErrCircuitBreakerRejected:
+		return e.Response.Code == CodeCircuitBreakerRejected
+	case ErrRateLimited:
+		return e.Response.Code == CodeRateLimited
+	}
+
+	return false
+}
+
+// Err returns the response error as a go error, or nil when the call succeeded
+func (e *ResponseError) Err() error {
+	if !isFailure(e) {
+		return nil
+	}
+
+	return &CallError{Response: e}
+}
@@ -0,0 +1,242 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//
+// Private constants
+//
+
+// defaultHTTPCacheRetention is how long a stale response having validators is kept for revalidation
+const defaultHTTPCacheRetention = 24 * time.Hour
+
+const httpCacheKeySuffix = "|http"
+
+// cachedResponse represents a response stored by the caching of the client
+type cachedResponse struct {
+	Body         string            `json:"body"`
+	ContentType  string            `json:"contentType,omitempty"`
+	ETag         string            `json:"etag,omitempty"`
+	LastModified string            `json:"lastModified,omitempty"`
+	Vary         map[string]string `json:"vary,omitempty"`
+	NoCache      bool              `json:"noCache,omitempty"`
+	StoredAt     time.Time         `json:"storedAt"`
+	ExpiredAt    time.Time         `json:"expiredAt"`
+	Delta        time.Duration     `json:"delta,omitempty"`
+}
+
+// isFresh reports whether the response can be served without revalidation
+func (r *cachedResponse) isFresh() bool {
+	return !r.NoCache && time.Now().Before(r.ExpiredAt)
+}
+
+// matches reports whether the request headers match the ones the response varies on
+func (r *cachedResponse) matches(header http.Header) bool {
+	for name, value := range r.Vary {
+		if header.Get(name) != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// httpCaching caches the GET responses following the Cache-Control, Expires, ETag, Last-Modified and Vary headers
+// of the upstream. A stale response is revalidated with If-None-Match / If-Modified-Since and a 304 serves it again.
+func (c *HTTPClient) httpCaching() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) *ResponseError {
+			if call.Method != GET {
+				return next(ctx, call)
+			}
+
+			cache := c.cache(call)
+			key := c.cacheKey(call, "") + httpCacheKeySuffix
+
+			var cached *cachedResponse
+			if val, errCache := cache.Get(ctx, key); errCache == nil {
+				cached = &cachedResponse{}
+				if errJSON := json.Unmarshal([]byte(val), cached); errJSON != nil || !cached.matches(call.Header) {
+					cached = nil
+				}
+			} else if errCache != ErrCacheMiss {
+				c.log(ctx, LogLevelWarn, "Error collecting http caching", LogFields{"client": c.ClientName, "key": key, "error": errCache})
+			}
+
+			if cached != nil {
+				if cached.isFresh() {
+					c.recordCacheLookup(ctx, "http", true)
+					return c.serveCachedResponse(call, cached)
+				}
+
+				if cached.ETag != "" {
+					call.Header.Set("If-None-Match", cached.ETag)
+				}
+				if cached.LastModified != "" {
+					call.Header.Set("If-Modified-Since", cached.LastModified)
+				}
+			}
+
+			errDo := next(ctx, call)
+			call.Header.Del("If-None-Match")
+			call.Header.Del("If-Modified-Since")
+
+			c.recordCacheLookup(ctx, "http", cached != nil && call.StatusCode == http.StatusNotModified)
+			if cached != nil && call.StatusCode == http.StatusNotModified {
+				c.storeCachedResponse(ctx, cache, key, call, cached.Body, cached)
+				return c.serveCachedResponse(call, cached)
+			}
+			if isFailure(errDo) {
+				return errDo
+			}
+
+			c.storeCachedResponse(ctx, cache, key, call, call.Response, nil)
+
+			return errDo
+		}
+	}
+}
+
+// serveCachedResponse decodes the cached response into the call result
+func (c *HTTPClient) serveCachedResponse(call *Call, cached *cachedResponse) *ResponseError {
+	call.Response = cached.Body
+	call.StatusCode = http.StatusOK
+	if cached.ContentType != "" {
+		call.ResponseHeader = http.Header{"Content-Type": []string{cached.ContentType}}
+	}
+	if err := call.decode(); err != nil {
+		return &ResponseError{
+			Error: err,
+		}
+	}
+
+	return nil
+}
+
+// storeCachedResponse stores the response of the call when its headers allow it,
+// the validators of the previous response are kept when a 304 does not repeat them
+func (c *HTTPClient) storeCachedResponse(ctx context.Context, cache Cache, key string, call *Call, body string, previous *cachedResponse) {
+	header := call.ResponseHeader
+	if header == nil {
+		return
+	}
+
+	directives := parseCacheControl(header.Get("Cache-Control"))
+	if _, ok := directives["no-store"]; ok {
+		return
+	}
+
+	vary := map[string]string{}
+	for _, values := range header.Values("Vary") {
+		for _, name := range strings.Split(values, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return
+			}
+			if name != "" {
+				vary[http.CanonicalHeaderKey(name)] = call.Header.Get(name)
+			}
+		}
+	}
+
+	now := time.Now()
+	cached := &cachedResponse{
+		Body:         body,
+		ContentType:  header.Get("Content-Type"),
+		ETag:         header.Get("ETag"),
+		LastModified: header.Get("Last-Modified"),
+		Vary:         vary,
+		StoredAt:     now,
+		ExpiredAt:    now.Add(freshnessLifetime(header, directives)),
+	}
+	_, cached.NoCache = directives["no-cache"]
+	if previous != nil {
+		if cached.ETag == "" {
+			cached.ETag = previous.ETag
+		}
+		if cached.LastModified == "" {
+			cached.LastModified = previous.LastModified
+		}
+		if cached.ContentType == "" {
+			cached.ContentType = previous.ContentType
+		}
+		if len(header.Values("Vary")) == 0 {
+			cached.Vary = previous.Vary
+		}
+	}
+
+	ttl := cached.ExpiredAt.Sub(now)
+	if cached.ETag != "" || cached.LastModified != "" {
+		ttl += defaultHTTPCacheRetention
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	val, err := json.Marshal(cached)
+	if err != nil {
+		return
+	}
+	if err = cache.Set(ctx, key, string(val), ttl); err != nil {
+		c.log(ctx, LogLevelWarn, "Error storing http caching", LogFields{"client": c.ClientName, "key": key, "error": err})
+		return
+	}
+	c.tagCachedResponse(ctx, cache, key, call, ttl)
+}
+
+// freshnessLifetime computes how long the response is fresh from max-age or Expires, minus its Age
+func freshnessLifetime(header http.Header, directives map[string]string) time.Duration {
+	var lifetime time.Duration
+
+	if maxAge, ok := directives["max-age"]; ok {
+		seconds, err := strconv.Atoi(maxAge)
+		if err != nil {
+			return 0
+		}
+		lifetime = time.Duration(seconds) * time.Second
+	} else if expires := header.Get("Expires"); expires != "" {
+		expiredAt, err := http.ParseTime(expires)
+		if err != nil {
+			return 0
+		}
+		date, err := http.ParseTime(header.Get("Date"))
+		if err != nil {
+			date = time.Now()
+		}
+		lifetime = expiredAt.Sub(date)
+	}
+
+	if age, err := strconv.Atoi(header.Get("Age")); err == nil {
+		lifetime -= time.Duration(age) * time.Second
+	}
+	if lifetime < 0 {
+		return 0
+	}
+
+	return lifetime
+}
+
+// parseCacheControl parses the directives of a Cache-Control header, directive names are lower cased
+func parseCacheControl(value string) map[string]string {
+	directives := map[string]string{}
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, val := part, ""
+		if i := strings.Index(part, "="); i >= 0 {
+			name, val = part[:i], strings.Trim(part[i+1:], `"`)
+		}
+		directives[strings.ToLower(strings.TrimSpace(name))] = val
+	}
+
+	return directives
+}
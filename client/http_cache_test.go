@@ -0,0 +1,135 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+type logEntry struct {
+	level   LogLevel
+	message string
+	fields  LogFields
+}
+
+// recordLogs returns a logger appending the entries to the logs
+func recordLogs(logs *[]logEntry) Logger {
+	mutex := &sync.Mutex{}
+	return LoggerFunc(func(ctx context.Context, level LogLevel, message string, fields LogFields) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		*logs = append(*logs, logEntry{level: level, message: message, fields: fields})
+	})
+}
+
+func TestHTTPCaching(t *testing.T) {
+	tests := []struct {
+		name         string
+		cacheControl string
+		etag         string
+		lastModified string
+		status       int
+		wantUpstream int32
+		wantRevalid  int32
+		wantErr      bool
+	}{
+		{
+			name:         "fresh response served from the cache",
+			cacheControl: "max-age=60",
+			status:       http.StatusOK,
+			wantUpstream: 1,
+		},
+		{
+			name:         "stale response revalidated by etag",
+			cacheControl: "no-cache",
+			etag:         `"v1"`,
+			status:       http.StatusOK,
+			wantUpstream: 2,
+			wantRevalid:  1,
+		},
+		{
+			name:         "stale response revalidated by last modified",
+			cacheControl: "max-age=0",
+			lastModified: "Mon, 02 Jan 2006 15:04:05 GMT",
+			status:       http.StatusOK,
+			wantUpstream: 2,
+			wantRevalid:  1,
+		},
+		{
+			name:         "no-store response not cached",
+			cacheControl: "no-store",
+			etag:         `"v1"`,
+			status:       http.StatusOK,
+			wantUpstream: 2,
+		},
+		{
+			name:         "failed response not cached",
+			cacheControl: "max-age=60",
+			status:       http.StatusInternalServerError,
+			wantUpstream: 2,
+			wantErr:      true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var upstream, revalidated int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&upstream, 1)
+				if (test.etag != "" && r.Header.Get("If-None-Match") == test.etag) ||
+					(test.lastModified != "" && r.Header.Get("If-Modified-Since") == test.lastModified) {
+					atomic.AddInt32(&revalidated, 1)
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+
+				w.Header().Set("Cache-Control", test.cacheControl)
+				if test.etag != "" {
+					w.Header().Set("ETag", test.etag)
+				}
+				if test.lastModified != "" {
+					w.Header().Set("Last-Modified", test.lastModified)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(test.status)
+				_, _ = w.Write([]byte(`{"name":"aspirin"}`))
+			}))
+			defer server.Close()
+
+			logs := []logEntry{}
+			client := newTestClient(t, server.URL, HTTPClient{
+				Cache:       NewLRUCache(10, 0),
+				HTTPCaching: true,
+				Logging:     &LoggingConfig{Logger: recordLogs(&logs)},
+			})
+
+			for i := 0; i < 2; i++ {
+				result := map[string]interface{}{}
+				errDo := client.CallClient(context.Background(), "drugs", GET, nil, &result, false)
+				if (errDo.Err() != nil) != test.wantErr {
+					t.Fatalf("call %d error = %v, want error %v", i, errDo.Err(), test.wantErr)
+				}
+				if !test.wantErr && result["name"] != "aspirin" {
+					t.Errorf("call %d result = %v", i, result)
+				}
+			}
+
+			if got := atomic.LoadInt32(&upstream); got != test.wantUpstream {
+				t.Errorf("upstream called %d times, want %d", got, test.wantUpstream)
+			}
+			if got := atomic.LoadInt32(&revalidated); got != test.wantRevalid {
+				t.Errorf("upstream revalidated %d times, want %d", got, test.wantRevalid)
+			}
+			if !test.wantErr {
+				for _, entry := range logs {
+					if entry.level >= LogLevelWarn {
+						t.Errorf("logged %s %q %v", entry.level, entry.message, entry.fields)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package client
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// HeaderIdempotencyKey is the header identifying the logical call across its retries
+const HeaderIdempotencyKey = "Idempotency-Key"
+
+// setIdempotencyKey attaches the idempotency key of the call to its mutating requests, given with
+// WithIdempotencyKey or generated when the client sends idempotency keys, unless the header is already set.
+// The key being set once per call, it is reused by all the retries of the call.
+func (c *HTTPClient) setIdempotencyKey(method string, header http.Header, key string) {
+	if header.Get(HeaderIdempotencyKey) != "" || method != string(POST) && method != string(PATCH) {
+		return
+	}
+
+	if key == "" && c.IdempotencyKeys {
+		key = uuid.New().String()
+	}
+	if key != "" {
+		header.Set(HeaderIdempotencyKey, key)
+	}
+}
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	tests := []struct {
+		name            string
+		idempotencyKeys bool
+		method          Method
+		header          http.Header
+		opts            []CallOption
+		wantKey         string
+		wantGenerated   bool
+		wantAttempts    int
+	}{
+		{
+			name:         "key given to the call reused by the retries",
+			method:       POST,
+			opts:         []CallOption{WithIdempotencyKey("order-1")},
+			wantKey:      "order-1",
+			wantAttempts: 3,
+		},
+		{
+			name:            "key generated by the client reused by the retries",
+			idempotencyKeys: true,
+			method:          PATCH,
+			wantGenerated:   true,
+			wantAttempts:    3,
+		},
+		{
+			name:            "key of the header kept",
+			idempotencyKeys: true,
+			method:          POST,
+			header:          http.Header{HeaderIdempotencyKey: []string{"order-2"}},
+			opts:            []CallOption{WithIdempotencyKey("order-1")},
+			wantKey:         "order-2",
+			wantAttempts:    3,
+		},
+		{
+			name:         "call without key not retried",
+			method:       POST,
+			wantAttempts: 1,
+		},
+		{
+			name:            "key not sent for the other methods",
+			idempotencyKeys: true,
+			method:          PUT,
+			opts:            []CallOption{WithIdempotencyKey("order-1")},
+			wantAttempts:    3,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mutex := sync.Mutex{}
+			keys := []string{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				keys = append(keys, r.Header.Get(HeaderIdempotencyKey))
+				if len(keys) < 3 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.WriteHeader(http.StatusCreated)
+			}))
+			defer server.Close()
+
+			client := newTestClient(t, server.URL, HTTPClient{
+				IdempotencyKeys: test.idempotencyKeys,
+				RetryPolicy:     &RetryPolicy{MaxRetries: 2, MinDelay: time.Millisecond, MaxDelay: time.Millisecond},
+			})
+			call := &Call{Method: test.method, URL: server.URL + "/orders", Header: test.header}
+			errDo := client.Execute(context.Background(), call, test.opts...)
+
+			if (errDo.Err() != nil) != (test.wantAttempts < 3) {
+				t.Errorf("error = %v after %d attempts", errDo.Err(), call.Attempts)
+			}
+			if len(keys) != test.wantAttempts {
+				t.Fatalf("attempts = %d, want %d", len(keys), test.wantAttempts)
+			}
+			for _, key := range keys {
+				if key != keys[0] {
+					t.Errorf("keys = %v, want the same key for every attempt", keys)
+				}
+			}
+			if test.wantGenerated {
+				if keys[0] == "" {
+					t.Errorf("no key generated")
+				}
+			} else if keys[0] != test.wantKey {
+				t.Errorf("key = %q, want %q", keys[0], test.wantKey)
+			}
+		})
+	}
+}
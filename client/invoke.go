@@ -0,0 +1,40 @@
+package client
+
+import (
+	"context"
+	"reflect"
+)
+
+// Invoke calls the client with a typed request and returns the decoded typed response.
+//
+// A nil request (including a nil pointer, map or slice) is sent without body.
+// A failed call is returned as a *CallError. The options are passed to the client by the context (see WithCallOptions).
+func Invoke[Req any, Resp any](ctx context.Context, c GenericHTTPClient, path string, method Method, request Req, opts ...CallOption) (Resp, error) {
+	var result Resp
+
+	var body interface{} = request
+	if isNil(body) {
+		body = nil
+	}
+
+	if err := c.CallClient(WithCallOptions(ctx, opts...), path, method, body, &result, false).Err(); err != nil {
+		var empty Resp
+		return empty, err
+	}
+
+	return result, nil
+}
+
+// isNil reports whether v is nil or a nil pointer, map, slice or interface
+func isNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		return rv.IsNil()
+	}
+
+	return false
+}
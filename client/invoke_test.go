@@ -0,0 +1,83 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type invokeRequest struct {
+	Name string `json:"name"`
+}
+
+type invokeResponse struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestInvoke(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  *invokeRequest
+		status   int
+		response string
+		wantBody string
+		want     invokeResponse
+		wantErr  error
+	}{
+		{
+			name:     "decoded response",
+			request:  &invokeRequest{Name: "aspirin"},
+			status:   http.StatusCreated,
+			response: `{"id":1,"name":"aspirin"}`,
+			wantBody: `{"name":"aspirin"}`,
+			want:     invokeResponse{ID: 1, Name: "aspirin"},
+		},
+		{
+			name:     "nil request sent without body",
+			status:   http.StatusOK,
+			response: `{"id":2}`,
+			want:     invokeResponse{ID: 2},
+		},
+		{
+			name:     "status matched by the sentinel errors",
+			request:  &invokeRequest{Name: "unknown"},
+			status:   http.StatusNotFound,
+			response: `{"code":"404","message":"drug not found"}`,
+			wantBody: `{"name":"unknown"}`,
+			wantErr:  ErrNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				if string(body) != test.wantBody {
+					t.Errorf("body = %q, want %q", body, test.wantBody)
+				}
+				w.WriteHeader(test.status)
+				_, _ = w.Write([]byte(test.response))
+			}))
+			defer server.Close()
+
+			client := newTestClient(t, server.URL, HTTPClient{})
+			got, err := Invoke[*invokeRequest, invokeResponse](context.Background(), client, "drugs", POST, test.request)
+
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("error = %v, want %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("response = %+v, want %+v", got, test.want)
+			}
+
+			var callErr *CallError
+			if test.wantErr != nil && (!errors.As(err, &callErr) || callErr.Response.StatusCode != test.status) {
+				t.Errorf("error %v is not a *CallError of status %d", err, test.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// LogLevel represents the enum for the level of the client logs
+type LogLevel int
+
+// Enum value for the level of the client logs, the zero value is LogLevelInfo
+const (
+	LogLevelDebug LogLevel = iota - 1
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+	LogLevelOff
+)
+
+// String returns the name of the level
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevelDebug:
+		return "DEBUG"
+	case LogLevelInfo:
+		return "INFO"
+	case LogLevelWarn:
+		return "WARN"
+	case LogLevelError:
+		return "ERROR"
+	case LogLevelOff:
+		return "OFF"
+	}
+
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
+
+// LogFields represents the structured fields of a log entry
+type LogFields map[string]interface{}
+
+// Logger represents the destination of the client logs, it can be implemented to forward the entries to any
+// structured logging library
+type Logger interface {
+	Log(ctx context.Context, level LogLevel, message string, fields LogFields)
+}
+
+// LoggerFunc is an adapter to use an ordinary function as Logger
+type LoggerFunc func(ctx context.Context, level LogLevel, message string, fields LogFields)
+
+// Log calls f(ctx, level, message, fields)
+func (f LoggerFunc) Log(ctx context.Context, level LogLevel, message string, fields LogFields) {
+	f(ctx, level, message, fields)
+}
+
+// StdLogger writes the entries with the standard log package as "LEVEL message key=value ...", keys being sorted
+type StdLogger struct {
+	logger *log.Logger
+}
+
+// Log writes the entry
+func (s *StdLogger) Log(ctx context.Context, level LogLevel, message string, fields LogFields) {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	entry := strings.Builder{}
+	entry.WriteString(level.String())
+	entry.WriteString(" ")
+	entry.WriteString(message)
+	for _, key := range keys {
+		fmt.Fprintf(&entry, " %s=%q", key, fmt.Sprint(fields[key]))
+	}
+
+	if s.logger == nil {
+		log.Print(entry.String())
+		return
+	}
+	s.logger.Print(entry.String())
+}
+
+// NewStdLogger creates the logger writing into the given standard logger, the default standard logger is used when nil
+func NewStdLogger(logger *log.Logger) *StdLogger {
+	return &StdLogger{
+		logger: logger,
+	}
+}
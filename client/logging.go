@@ -0,0 +1,307 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/medicplus-inc/medicplus-kit/net/authentication/signature"
+	"moul.io/http2curl"
+)
+
+//
+// Private constants
+//
+
+const defaultMaxLoggedBodySize = 2048
+const redactedValue = "[REDACTED]"
+
+//
+// Private variables
+//
+
+var defaultRedactedHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"Secret",
+	"X-Api-Key",
+	"Api-Key",
+	signature.HeaderSignature,
+	signature.HeaderKeyID,
+	signature.HeaderNonce,
+	signature.HeaderContentSHA256,
+}
+
+var defaultLogger Logger = NewStdLogger(nil)
+
+// LoggingConfig represents the logging configuration of the client, zero values fall back to the defaults.
+//
+// Every call is logged once with the client name, method, url, status, latency and number of attempts:
+// at error level when it failed, warn level for 4xx responses and info level otherwise.
+// Headers, bodies and curl commands are only logged when enabled, always redacted.
+type LoggingConfig struct {
+	// Logger receives the entries, the standard log package by default
+	Logger Logger
+	// Level is the min level of the logged entries, LogLevelInfo by default
+	Level LogLevel
+	// RedactHeaders are the headers redacted in addition to the authorization and credential headers of the client,
+	// Authorization, Proxy-Authorization, Cookie, Set-Cookie, Secret, X-Api-Key, Api-Key and the signature headers
+	// carrying the signature, key id, nonce and body digest
+	RedactHeaders []string
+	// RedactQueryParams are the query parameters redacted from the logged url in addition to the api keys of the client
+	RedactQueryParams []string
+	// RedactJSONPaths are the fields redacted from the json bodies, given as dot separated paths
+	// where "*" matches any field or array element, e.g. "patient.name" or "items.*.nik"
+	RedactJSONPaths []string
+	// LogHeaders adds the request and response headers to the entries
+	LogHeaders bool
+	// LogBodies adds the request and response bodies to the entries
+	LogBodies bool
+	// MaxBodySize is the max number of bytes of a logged body, 2048 by default and unlimited when negative
+	MaxBodySize int
+	// CurlDump adds the curl command of the request to the entries, for debugging
+	CurlDump bool
+}
+
+// loggingConfig returns the logging config of the client with the defaults applied
+func (c *HTTPClient) loggingConfig() LoggingConfig {
+	config := LoggingConfig{}
+	if c.Logging != nil {
+		config = *c.Logging
+	}
+
+	if config.Logger == nil {
+		config.Logger = defaultLogger
+	}
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = defaultMaxLoggedBodySize
+	}
+
+	return config
+}
+
+// log writes the entry with the logger of the client when its level is enabled
+func (c *HTTPClient) log(ctx context.Context, level LogLevel, message string, fields LogFields) {
+	config := c.loggingConfig()
+	if level < config.Level || config.Level == LogLevelOff {
+		return
+	}
+
+	config.Logger.Log(ctx, level, message, fields)
+}
+
+// logging logs the call once it was sent, with its headers and bodies redacted
+func (c *HTTPClient) logging() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) *ResponseError {
+			start := time.Now()
+			errDo := next(ctx, call)
+			if call.HTTPRequest == nil {
+				return errDo
+			}
+
+			config := c.loggingConfig()
+			level := LogLevelInfo
+			switch {
+			case isFailure(errDo) && call.StatusCode >= 400 && call.StatusCode < 500:
+				level = LogLevelWarn
+			case isFailure(errDo):
+				level = LogLevelError
+			}
+			if level < config.Level || config.Level == LogLevelOff {
+				return errDo
+			}
+
+			redactedURL := redactURL(call.URL, c.redactedQueryParams(config))
+			redactedHeaders := c.redactedHeaders(config)
+			fields := LogFields{
+				"client":   c.ClientName,
+				"method":   string(call.Method),
+				"url":      redactedURL,
+				"status":   call.StatusCode,
+				"latency":  time.Since(start).String(),
+				"attempts": call.Attempts,
+			}
+			if isFailure(errDo) {
+				fields["code"] = errDo.Code
+				fields["error"] = errDo.Message
+				if errDo.Error != nil {
+					fields["error"] = redactURLs(errDo.Error.Error(), call.URL, redactedURL)
+				}
+			}
+			if config.LogHeaders {
+				// the headers sent, with the ones added by the signing of the request
+				fields["requestHeaders"] = redactHeaders(call.HTTPRequest.Header, redactedHeaders)
+				fields["responseHeaders"] = redactHeaders(call.ResponseHeader, redactedHeaders)
+			}
+			if config.LogBodies {
+				fields["requestBody"] = truncateBody(redactJSON(call.Body, config.RedactJSONPaths), config.MaxBodySize)
+				fields["responseBody"] = truncateBody(redactJSON([]byte(call.Response), config.RedactJSONPaths), config.MaxBodySize)
+			}
+			if config.CurlDump {
+				fields["curl"] = curlCommand(ctx, call, redactedURL, redactedHeaders, config)
+			}
+
+			config.Logger.Log(ctx, level, "client call", fields)
+
+			return errDo
+		}
+	}
+}
+
+// redactedHeaders returns the canonical names of the headers to redact
+func (c *HTTPClient) redactedHeaders(config LoggingConfig) map[string]bool {
+	names := map[string]bool{}
+	for _, name := range defaultRedactedHeaders {
+		names[http.CanonicalHeaderKey(name)] = true
+	}
+	for _, name := range config.RedactHeaders {
+		names[http.CanonicalHeaderKey(name)] = true
+	}
+	for _, authorizationType := range c.authorizationTypes() {
+		names[http.CanonicalHeaderKey(authorizationType.HeaderName)] = true
+	}
+	if c.credentialCache != nil {
+		if name := c.credentialCache.headerName(); name != "" {
+			names[http.CanonicalHeaderKey(name)] = true
+		}
+	}
+
+	return names
+}
+
+// redactedQueryParams returns the names of the query parameters to redact, the authorizations included
+func (c *HTTPClient) redactedQueryParams(config LoggingConfig) []string {
+	params := append([]string{}, config.RedactQueryParams...)
+	return append(params, c.authorizationQueryParams()...)
+}
+
+// redactHeaders returns a copy of the headers with the values of the redacted ones replaced
+func redactHeaders(header http.Header, names map[string]bool) http.Header {
+	redacted := http.Header{}
+	for name, values := range header {
+		if names[http.CanonicalHeaderKey(name)] {
+			redacted[name] = []string{redactedValue}
+			continue
+		}
+		redacted[name] = values
+	}
+
+	return redacted
+}
+
+// redactURL replaces the values of the redacted query parameters, names are case insensitive
+func redactURL(rawURL string, params []string) string {
+	if len(params) == 0 {
+		return rawURL
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	query := u.Query()
+	for name := range query {
+		for _, param := range params {
+			if strings.EqualFold(name, param) {
+				query[name] = []string{redactedValue}
+			}
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// redactURLs replaces the url of the call inside an error message with its redacted version
+func redactURLs(message string, rawURL string, redactedURL string) string {
+	if rawURL == redactedURL {
+		return message
+	}
+
+	return strings.ReplaceAll(message, rawURL, redactedURL)
+}
+
+// redactJSON replaces the fields of the json paths, bodies which are not json are kept as is
+func redactJSON(body []byte, paths []string) []byte {
+	if len(paths) == 0 || len(body) == 0 {
+		return body
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return body
+	}
+
+	for _, path := range paths {
+		value = redactJSONPath(value, strings.Split(path, "."))
+	}
+
+	redacted, err := json.Marshal(value)
+	if err != nil {
+		return body
+	}
+
+	return redacted
+}
+
+func redactJSONPath(value interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return redactedValue
+	}
+
+	switch node := value.(type) {
+	case map[string]interface{}:
+		for key, child := range node {
+			if path[0] == "*" || path[0] == key {
+				node[key] = redactJSONPath(child, path[1:])
+			}
+		}
+	case []interface{}:
+		for i, child := range node {
+			if path[0] == "*" || path[0] == fmt.Sprint(i) {
+				node[i] = redactJSONPath(child, path[1:])
+			}
+		}
+	}
+
+	return value
+}
+
+// truncateBody cuts the body to the max size, a negative max size keeps the whole body
+func truncateBody(body []byte, maxSize int) string {
+	if maxSize < 0 || len(body) <= maxSize {
+		return string(body)
+	}
+
+	return fmt.Sprintf("%s...(%d bytes truncated)", body[:maxSize], len(body)-maxSize)
+}
+
+// curlCommand builds the curl command of the call with its url, headers and body redacted
+func curlCommand(ctx context.Context, call *Call, redactedURL string, redactedHeaders map[string]bool, config LoggingConfig) string {
+	req := call.HTTPRequest.Clone(ctx)
+	if u, err := url.Parse(redactedURL); err == nil {
+		req.URL = u
+	}
+	req.Header = redactHeaders(call.HTTPRequest.Header, redactedHeaders)
+	req.Body = ioutil.NopCloser(bytes.NewReader(redactJSON(call.Body, config.RedactJSONPaths)))
+
+	command, err := http2curl.GetCurlCommand(req)
+	if err != nil {
+		return ""
+	}
+
+	return command.String()
+}
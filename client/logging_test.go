@@ -0,0 +1,137 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/medicplus-inc/medicplus-kit/net/authentication/signature"
+)
+
+func TestLoggingLevels(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		level     LogLevel
+		wantLevel LogLevel
+		wantLog   bool
+	}{
+		{name: "success", status: http.StatusOK, wantLevel: LogLevelInfo, wantLog: true},
+		{name: "client error", status: http.StatusNotFound, wantLevel: LogLevelWarn, wantLog: true},
+		{name: "server error", status: http.StatusInternalServerError, wantLevel: LogLevelError, wantLog: true},
+		{name: "success below the level", status: http.StatusOK, level: LogLevelWarn},
+		{name: "server error above the level", status: http.StatusInternalServerError, level: LogLevelWarn, wantLevel: LogLevelError, wantLog: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.status)
+				_, _ = w.Write([]byte(`{}`))
+			}))
+			defer server.Close()
+
+			logs := []logEntry{}
+			client := newTestClient(t, server.URL, HTTPClient{Logging: &LoggingConfig{Logger: recordLogs(&logs), Level: test.level}})
+			_ = client.CallClient(context.Background(), "drugs", GET, nil, nil, false)
+
+			if !test.wantLog {
+				if len(logs) != 0 {
+					t.Errorf("logged %v", logs)
+				}
+				return
+			}
+			if len(logs) != 1 {
+				t.Fatalf("logged %d entries, want 1", len(logs))
+			}
+			entry := logs[0]
+			if entry.level != test.wantLevel || entry.fields["status"] != test.status || entry.fields["client"] != client.ClientName {
+				t.Errorf("logged %s %v, want %s with the status %d", entry.level, entry.fields, test.wantLevel, test.status)
+			}
+		})
+	}
+}
+
+func TestLoggingRedaction(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Set-Cookie", "session=server-secret")
+		_, _ = w.Write([]byte(`{"patient":{"name":"Budi","nik":"3171"}}`))
+	}))
+	defer server.Close()
+
+	logs := []logEntry{}
+	client := newTestClient(t, server.URL, HTTPClient{
+		Signer: signature.NewSigner("service-1", []byte("signing-secret")),
+		Logging: &LoggingConfig{
+			Logger:            recordLogs(&logs),
+			RedactHeaders:     []string{"X-Patient-Id"},
+			RedactQueryParams: []string{"nik"},
+			RedactJSONPaths:   []string{"patient.*", "items.*.nik"},
+			LogHeaders:        true,
+			LogBodies:         true,
+			CurlDump:          true,
+		},
+		Middlewares: []Middleware{func(next Handler) Handler {
+			return func(ctx context.Context, call *Call) *ResponseError {
+				call.Header.Set("Authorization", "Bearer caller-secret")
+				call.Header.Set("X-Patient-Id", "patient-secret")
+				return next(ctx, call)
+			}
+		}},
+	})
+
+	request := map[string]interface{}{"items": []map[string]string{{"nik": "3172"}}}
+	if errDo := client.CallClient(context.Background(), "patients?nik=3173", POST, request, nil, false); errDo.Err() != nil {
+		t.Fatalf("error = %v", errDo.Err())
+	}
+	if len(logs) != 1 {
+		t.Fatalf("logged %d entries, want 1", len(logs))
+	}
+	fields := logs[0].fields
+	logged := fmt.Sprint(fields)
+
+	sent := fields["requestHeaders"].(http.Header)
+	for _, name := range []string{"Authorization", "X-Patient-Id", signature.HeaderSignature, signature.HeaderKeyID, signature.HeaderNonce, signature.HeaderContentSHA256} {
+		if value := sent.Get(name); value != redactedValue {
+			t.Errorf("request header %s = %q, want it redacted", name, value)
+		}
+	}
+	if value := fields["responseHeaders"].(http.Header).Get("Set-Cookie"); value != redactedValue {
+		t.Errorf("response header Set-Cookie = %q, want it redacted", value)
+	}
+
+	for _, secret := range []string{"caller-secret", "patient-secret", "server-secret", "service-1", "Budi", "3171", "3172", "3173"} {
+		if strings.Contains(logged, secret) {
+			t.Errorf("logged %q in %s", secret, logged)
+		}
+	}
+	if !strings.Contains(fmt.Sprint(fields["curl"]), "curl") {
+		t.Errorf("curl = %v", fields["curl"])
+	}
+}
+
+func TestRedactJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		paths []string
+		want  string
+	}{
+		{name: "field", body: `{"name":"Budi","age":30}`, paths: []string{"name"}, want: `{"age":30,"name":"[REDACTED]"}`},
+		{name: "nested field", body: `{"patient":{"name":"Budi"}}`, paths: []string{"patient.name"}, want: `{"patient":{"name":"[REDACTED]"}}`},
+		{name: "array elements", body: `[{"nik":"1"},{"nik":"2"}]`, paths: []string{"*.nik"}, want: `[{"nik":"[REDACTED]"},{"nik":"[REDACTED]"}]`},
+		{name: "numbers kept", body: `{"id":12345678901234567890}`, paths: []string{"name"}, want: `{"id":12345678901234567890}`},
+		{name: "body not json", body: `name=Budi`, paths: []string{"name"}, want: `name=Budi`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := string(redactJSON([]byte(test.body), test.paths)); got != test.want {
+				t.Errorf("redactJSON(%s) = %s, want %s", test.body, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package client
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LRUCache is the in-process cache evicting the least recently used entries once its limits are reached
+type LRUCache struct {
+	mutex      sync.Mutex
+	maxEntries int
+	maxBytes   int
+	bytes      int
+	entries    *list.List
+	items      map[string]*list.Element
+	tags       map[string]map[string]struct{}
+}
+
+type lruEntry struct {
+	key       string
+	value     string
+	expiredAt time.Time
+	tags      []string
+}
+
+// Get collects the value of the key when it is not expired
+func (l *LRUCache) Get(ctx context.Context, key string) (string, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	element, ok := l.items[key]
+	if !ok {
+		return "", ErrCacheMiss
+	}
+
+	entry := element.Value.(*lruEntry)
+	if !entry.expiredAt.IsZero() && time.Now().After(entry.expiredAt) {
+		l.remove(element)
+		return "", ErrCacheMiss
+	}
+	l.entries.MoveToFront(element)
+
+	return entry.value, nil
+}
+
+// Set stores the value of the key for the ttl duration, a zero ttl never expires
+func (l *LRUCache) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if element, ok := l.items[key]; ok {
+		l.remove(element)
+	}
+
+	if l.maxBytes > 0 && len(key)+len(value) > l.maxBytes {
+		return nil
+	}
+
+	entry := &lruEntry{
+		key:   key,
+		value: value,
+	}
+	if ttl > 0 {
+		entry.expiredAt = time.Now().Add(ttl)
+	}
+	l.items[key] = l.entries.PushFront(entry)
+	l.bytes += len(key) + len(value)
+
+	for (l.maxEntries > 0 && l.entries.Len() > l.maxEntries) || (l.maxBytes > 0 && l.bytes > l.maxBytes) {
+		l.remove(l.entries.Back())
+	}
+
+	return nil
+}
+
+// Delete removes the key from the cache
+func (l *LRUCache) Delete(ctx context.Context, key string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if element, ok := l.items[key]; ok {
+		l.remove(element)
+	}
+
+	return nil
+}
+
+// DeletePrefix removes all the keys starting with the prefix
+func (l *LRUCache) DeletePrefix(ctx context.Context, prefix string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for key, element := range l.items {
+		if strings.HasPrefix(key, prefix) {
+			l.remove(element)
+		}
+	}
+
+	return nil
+}
+
+// AddTags attaches the tags to the key, the tags live as long as the entry
+func (l *LRUCache) AddTags(ctx context.Context, key string, tags []string, ttl time.Duration) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	element, ok := l.items[key]
+	if !ok {
+		return nil
+	}
+
+	entry := element.Value.(*lruEntry)
+	for _, tag := range tags {
+		if _, ok := l.tags[tag]; !ok {
+			l.tags[tag] = map[string]struct{}{}
+		}
+		l.tags[tag][key] = struct{}{}
+		entry.tags = append(entry.tags, tag)
+	}
+
+	return nil
+}
+
+// DeleteTag removes all the keys having the tag
+func (l *LRUCache) DeleteTag(ctx context.Context, tag string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for key := range l.tags[tag] {
+		if element, ok := l.items[key]; ok {
+			l.remove(element)
+		}
+	}
+	delete(l.tags, tag)
+
+	return nil
+}
+
+func (l *LRUCache) remove(element *list.Element) {
+	entry := l.entries.Remove(element).(*lruEntry)
+	delete(l.items, entry.key)
+	l.bytes -= len(entry.key) + len(entry.value)
+
+	for _, tag := range entry.tags {
+		delete(l.tags[tag], entry.key)
+		if len(l.tags[tag]) == 0 {
+			delete(l.tags, tag)
+		}
+	}
+}
+
+// NewLRUCache creates a new in-process cache limited to maxEntries entries and maxBytes bytes of keys and values,
+// a zero limit is unlimited
+func NewLRUCache(maxEntries int, maxBytes int) *LRUCache {
+	return &LRUCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		entries:    list.New(),
+		items:      map[string]*list.Element{},
+		tags:       map[string]map[string]struct{}{},
+	}
+}
@@ -0,0 +1,149 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLRUCache(t *testing.T) {
+	ctx := context.Background()
+
+	type entry struct {
+		key   string
+		value string
+		ttl   time.Duration
+	}
+
+	tests := []struct {
+		name       string
+		maxEntries int
+		maxBytes   int
+		entries    []entry
+		get        []string
+		wait       time.Duration
+		want       map[string]string
+	}{
+		{
+			name:    "stored values",
+			entries: []entry{{key: "a", value: "1"}, {key: "b", value: "2"}},
+			want:    map[string]string{"a": "1", "b": "2"},
+		},
+		{
+			name:    "overwritten value",
+			entries: []entry{{key: "a", value: "1"}, {key: "a", value: "2"}},
+			want:    map[string]string{"a": "2"},
+		},
+		{
+			name:    "expired value",
+			entries: []entry{{key: "a", value: "1", ttl: 10 * time.Millisecond}, {key: "b", value: "2"}},
+			wait:    20 * time.Millisecond,
+			want:    map[string]string{"a": "", "b": "2"},
+		},
+		{
+			name:       "least recently used evicted by the max entries",
+			maxEntries: 2,
+			entries:    []entry{{key: "a", value: "1"}, {key: "b", value: "2"}},
+			get:        []string{"a"},
+			want:       map[string]string{"a": "1", "b": "", "c": "3"},
+		},
+		{
+			name:     "least recently used evicted by the max bytes",
+			maxBytes: 6,
+			entries:  []entry{{key: "a", value: "11"}, {key: "b", value: "22"}},
+			want:     map[string]string{"a": "", "b": "22", "c": "3"},
+		},
+		{
+			name:     "value larger than the max bytes not stored",
+			maxBytes: 4,
+			entries:  []entry{{key: "a", value: "1"}, {key: "b", value: "2222"}},
+			want:     map[string]string{"a": "1", "b": ""},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cache := NewLRUCache(test.maxEntries, test.maxBytes)
+			for _, entry := range test.entries {
+				if err := cache.Set(ctx, entry.key, entry.value, entry.ttl); err != nil {
+					t.Fatalf("Set(%q) error = %v", entry.key, err)
+				}
+			}
+			for _, key := range test.get {
+				_, _ = cache.Get(ctx, key)
+			}
+			if _, ok := test.want["c"]; ok {
+				_ = cache.Set(ctx, "c", "3", 0)
+			}
+			time.Sleep(test.wait)
+
+			for key, want := range test.want {
+				got, err := cache.Get(ctx, key)
+				if want == "" {
+					if err != ErrCacheMiss {
+						t.Errorf("Get(%q) = %q, %v, want a cache miss", key, got, err)
+					}
+					continue
+				}
+				if err != nil || got != want {
+					t.Errorf("Get(%q) = %q, %v, want %q", key, got, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLRUCacheDeletion(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		delete func(cache *LRUCache) error
+		want   map[string]bool
+	}{
+		{
+			name:   "key",
+			delete: func(cache *LRUCache) error { return cache.Delete(ctx, "drugs:1") },
+			want:   map[string]bool{"drugs:1": false, "drugs:2": true, "users:1": true},
+		},
+		{
+			name:   "prefix",
+			delete: func(cache *LRUCache) error { return cache.DeletePrefix(ctx, "drugs:") },
+			want:   map[string]bool{"drugs:1": false, "drugs:2": false, "users:1": true},
+		},
+		{
+			name:   "tag",
+			delete: func(cache *LRUCache) error { return cache.DeleteTag(ctx, "patient-1") },
+			want:   map[string]bool{"drugs:1": false, "drugs:2": true, "users:1": false},
+		},
+		{
+			name:   "unknown tag",
+			delete: func(cache *LRUCache) error { return cache.DeleteTag(ctx, "patient-2") },
+			want:   map[string]bool{"drugs:1": true, "drugs:2": true, "users:1": true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cache := NewLRUCache(0, 0)
+			for key := range test.want {
+				_ = cache.Set(ctx, key, "value", 0)
+			}
+			_ = cache.AddTags(ctx, "drugs:1", []string{"patient-1"}, 0)
+			_ = cache.AddTags(ctx, "users:1", []string{"patient-1"}, 0)
+
+			if err := test.delete(cache); err != nil {
+				t.Fatalf("delete error = %v", err)
+			}
+
+			for key, want := range test.want {
+				if _, err := cache.Get(ctx, key); (err == nil) != want {
+					t.Errorf("Get(%q) error = %v, want stored %v", key, err, want)
+				}
+			}
+			if test.name == "tag" && len(cache.tags) != 0 {
+				t.Errorf("tags = %v left after the deletion", cache.tags)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// MultipartForm represents a multipart/form-data request with its fields and files
+type MultipartForm struct {
+	Fields url.Values
+	Files  []MultipartFile
+}
+
+// MultipartFile represents a file part of a multipart form
+type MultipartFile struct {
+	FieldName string
+	FileName  string
+	// ContentType is the content type of the file, application/octet-stream by default
+	ContentType string
+	Content     io.Reader
+}
+
+// MultipartCodec encodes the *MultipartForm requests into multipart/form-data, it does not decode responses
+type MultipartCodec struct{}
+
+// Marshal encodes the form, the content type carries the boundary of the parts
+func (MultipartCodec) Marshal(v interface{}) ([]byte, string, error) {
+	var form *MultipartForm
+	switch request := v.(type) {
+	case *MultipartForm:
+		form = request
+	case MultipartForm:
+		form = &request
+	default:
+		return nil, "", fmt.Errorf("multipart codec cannot encode %T", v)
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	keys := make([]string, 0, len(form.Fields))
+	for key := range form.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range form.Fields[key] {
+			if err := writer.WriteField(key, value); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+
+	for _, file := range form.Files {
+		contentType := file.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+			escapeQuotes(file.FieldName), escapeQuotes(file.FileName)))
+		header.Set("Content-Type", contentType)
+
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, "", err
+		}
+		if file.Content != nil {
+			if _, err = io.Copy(part, file.Content); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+
+	return body.Bytes(), writer.FormDataContentType(), nil
+}
+
+// Unmarshal is not supported
+func (MultipartCodec) Unmarshal(data []byte, v interface{}) error {
+	return errors.New("multipart codec cannot decode responses")
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
@@ -0,0 +1,126 @@
+package client
+
+import (
+	"context"
+	"time"
+)
+
+// callOptions represents the options of a single client call
+type callOptions struct {
+	timeout        time.Duration
+	middlewares    []Middleware
+	cache          Cache
+	httpCaching    bool
+	cacheTags      []string
+	route          string
+	codec          Codec
+	responseCodec  Codec
+	envelope       bool
+	metadata       *map[string]interface{}
+	idempotencyKey string
+}
+
+// CallOption represents an option overriding the client behavior for a single call
+type CallOption func(*callOptions)
+
+// callOptionsKey is the key of the call options carried by a context
+type callOptionsKey struct{}
+
+// WithCallOptions returns a copy of the context carrying the options, applied to the calls made with it
+// before the options given to the call itself. It passes the options through the methods of GenericHTTPClient,
+// which take none.
+func WithCallOptions(ctx context.Context, opts ...CallOption) context.Context {
+	if len(opts) == 0 {
+		return ctx
+	}
+
+	carried := contextCallOptions(ctx)
+	return context.WithValue(ctx, callOptionsKey{}, append(carried[:len(carried):len(carried)], opts...))
+}
+
+// contextCallOptions returns the call options carried by the context
+func contextCallOptions(ctx context.Context) []CallOption {
+	opts, _ := ctx.Value(callOptionsKey{}).([]CallOption)
+	return opts
+}
+
+// WithTimeout sets the deadline of the call, retries included
+func WithTimeout(timeout time.Duration) CallOption {
+	return func(o *callOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithMiddlewares adds middlewares to the pipeline of the call, after the client middlewares
+func WithMiddlewares(middlewares ...Middleware) CallOption {
+	return func(o *callOptions) {
+		o.middlewares = append(o.middlewares, middlewares...)
+	}
+}
+
+// WithCache sets the cache used by the caching calls instead of the cache of the client
+func WithCache(cache Cache) CallOption {
+	return func(o *callOptions) {
+		o.cache = cache
+	}
+}
+
+// WithHTTPCaching enables the http caching of the call, following the caching headers of the upstream
+func WithHTTPCaching() CallOption {
+	return func(o *callOptions) {
+		o.httpCaching = true
+	}
+}
+
+// WithCacheTags tags the cached response of the call, so it can be removed with InvalidateCacheTag
+func WithCacheTags(tags ...string) CallOption {
+	return func(o *callOptions) {
+		o.cacheTags = append(o.cacheTags, tags...)
+	}
+}
+
+// WithRoute sets the route template of the call used by the telemetry, e.g. "/patients/{id}",
+// to keep the paths carrying ids out of the span names and the metric attributes
+func WithRoute(route string) CallOption {
+	return func(o *callOptions) {
+		o.route = route
+	}
+}
+
+// WithCodec sets the codec encoding the request of the call, e.g. XMLCodec{} or FormCodec{}
+func WithCodec(codec Codec) CallOption {
+	return func(o *callOptions) {
+		o.codec = codec
+	}
+}
+
+// WithResponseCodec sets the codec decoding the response of the call whatever its content type
+func WithResponseCodec(codec Codec) CallOption {
+	return func(o *callOptions) {
+		o.responseCodec = codec
+	}
+}
+
+// WithEnvelope unwraps the `data` of the json response in the ResolveStructure of the kit into the result
+func WithEnvelope() CallOption {
+	return func(o *callOptions) {
+		o.envelope = true
+	}
+}
+
+// WithMetadata unwraps the envelope of the json response like WithEnvelope and stores its `metadata`,
+// e.g. the paging info or request_took
+func WithMetadata(metadata *map[string]interface{}) CallOption {
+	return func(o *callOptions) {
+		o.envelope = true
+		o.metadata = metadata
+	}
+}
+
+// WithIdempotencyKey sets the Idempotency-Key header of the POST or PATCH call, e.g. derived from the id
+// of the created resource so that the key survives the restarts of the caller
+func WithIdempotencyKey(key string) CallOption {
+	return func(o *callOptions) {
+		o.idempotencyKey = key
+	}
+}
@@ -0,0 +1,500 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// PaginationStyle represents the enum for the way a list endpoint is paginated
+type PaginationStyle string
+
+// Enum value for pagination style
+const (
+	// PagePagination sends the page number and the page size, e.g. ?page=2&limit=20
+	PagePagination PaginationStyle = "page"
+	// OffsetPagination sends the offset of the first item and the page size, e.g. ?offset=40&limit=20
+	OffsetPagination PaginationStyle = "offset"
+	// CursorPagination sends the cursor returned in the metadata of the previous page, e.g. ?cursor=abc&limit=20
+	CursorPagination PaginationStyle = "cursor"
+	// LinkPagination follows the url of the rel="next" link of the Link header of the previous page,
+	// on the scheme and host of the previous page only (see ErrCrossOriginLink)
+	LinkPagination PaginationStyle = "link"
+)
+
+// ErrCrossOriginLink is returned by the iteration of the link style when the next link leaves the scheme and host
+// of the page, so that the authorizations of the client are never sent to another host
+var ErrCrossOriginLink = errors.New("client: next link to another origin")
+
+//
+// Private constants
+//
+
+const defaultPaginationLimit = 20
+const defaultPageParam = "page"
+const defaultLimitParam = "limit"
+const defaultOffsetParam = "offset"
+const defaultCursorParam = "cursor"
+const defaultNextCursorKey = "next_cursor"
+
+// PaginationConfig represents the pagination of a list endpoint, zero values fall back to the defaults.
+//
+// The pages are responses in the ResolveStructure of the kit, the items being the `data` array and the paging info
+// the `metadata`, or bare json arrays. The iteration ends with the first page shorter than Limit for the page and
+// offset styles, or once the TotalKey count of items is reached; with the first page without next cursor or link
+// for the cursor and link styles.
+type PaginationConfig struct {
+	// Style is the way the endpoint is paginated, PagePagination by default
+	Style PaginationStyle
+	// Limit is the page size, 20 by default
+	Limit int
+	// FirstPage is the number of the first page of the page style, 1 by default
+	FirstPage int
+	// PageParam is the query param of the page number, "page" by default
+	PageParam string
+	// LimitParam is the query param of the page size, "limit" by default
+	LimitParam string
+	// OffsetParam is the query param of the offset, "offset" by default
+	OffsetParam string
+	// CursorParam is the query param of the cursor, "cursor" by default
+	CursorParam string
+	// NextCursorKey is the metadata key of the cursor of the next page, "next_cursor" by default
+	NextCursorKey string
+	// TotalKey is the metadata key of the total count of items, e.g. "total"; ignored when empty
+	TotalKey string
+	// Prefetch is the number of pages fetched ahead of the iterated one, concurrently for the page and offset styles;
+	// the pages are fetched one by one as they are iterated when zero
+	Prefetch int
+}
+
+// PageIterator iterates over the items of a paginated list endpoint, it must be closed when the iteration
+// stops before its end
+type PageIterator[T any] struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	client *HTTPClient
+	path   string
+	config PaginationConfig
+	opts   []CallOption
+
+	item     T
+	items    []T
+	metadata map[string]interface{}
+	err      error
+	done     bool
+	started  bool
+
+	// state of the sequential iteration
+	number int
+	next   string
+
+	// pages prefetched in order
+	pages    chan chan page[T]
+	lastPage int64
+}
+
+// page represents a fetched page
+type page[T any] struct {
+	items    []T
+	metadata map[string]interface{}
+	next     string
+	last     bool
+	// err stops the iteration, after the items of the page when there are some
+	err error
+}
+
+// pageBody represents the response of a page, either in the ResolveStructure of the kit or a bare array
+type pageBody[T any] struct {
+	Data     []T
+	Metadata map[string]interface{}
+}
+
+// UnmarshalJSON decodes the `data` and `metadata` of the response, or the items of a bare array
+func (p *pageBody[T]) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		return json.Unmarshal(data, &p.Data)
+	}
+
+	var envelope struct {
+		Data     []T                    `json:"data"`
+		Metadata map[string]interface{} `json:"metadata"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return err
+	}
+	p.Data, p.Metadata = envelope.Data, envelope.Metadata
+
+	return nil
+}
+
+// Paginate returns an iterator over the items of the paginated list endpoint of the path, fetched with GET:
+//
+//	patients := client.Paginate[Patient](ctx, c, "patients?status=active", client.PaginationConfig{Limit: 50})
+//	defer patients.Close()
+//	for patients.Next() {
+//		patient := patients.Item()
+//	}
+//	if err := patients.Err(); err != nil {
+//		return err
+//	}
+//
+// The iteration stops at the first failed page, returned by Err as a *CallError, or when the context is done.
+func Paginate[T any](ctx context.Context, c *HTTPClient, path string, config PaginationConfig, opts ...CallOption) *PageIterator[T] {
+	if config.Style == "" {
+		config.Style = PagePagination
+	}
+	if config.Limit == 0 {
+		config.Limit = defaultPaginationLimit
+	}
+	if config.FirstPage == 0 {
+		config.FirstPage = 1
+	}
+	if config.PageParam == "" {
+		config.PageParam = defaultPageParam
+	}
+	if config.LimitParam == "" {
+		config.LimitParam = defaultLimitParam
+	}
+	if config.OffsetParam == "" {
+		config.OffsetParam = defaultOffsetParam
+	}
+	if config.CursorParam == "" {
+		config.CursorParam = defaultCursorParam
+	}
+	if config.NextCursorKey == "" {
+		config.NextCursorKey = defaultNextCursorKey
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	return &PageIterator[T]{
+		ctx:      ctx,
+		cancel:   cancel,
+		client:   c,
+		path:     path,
+		config:   config,
+		opts:     opts,
+		lastPage: -1,
+	}
+}
+
+// Next advances to the next item, false once the items are exhausted or the iteration failed (see Err)
+func (it *PageIterator[T]) Next() bool {
+	for len(it.items) == 0 {
+		if it.done {
+			return false
+		}
+		if err := it.ctx.Err(); err != nil {
+			it.stop(err)
+			return false
+		}
+
+		p := it.fetchPage()
+		if p.err != nil && len(p.items) == 0 {
+			it.stop(p.err)
+			return false
+		}
+		it.items, it.metadata = p.items, p.metadata
+		if p.err != nil || p.last {
+			it.stop(p.err)
+		}
+	}
+
+	it.item = it.items[0]
+	it.items = it.items[1:]
+
+	return true
+}
+
+// Item returns the current item
+func (it *PageIterator[T]) Item() T {
+	return it.item
+}
+
+// Metadata returns the metadata of the page of the current item
+func (it *PageIterator[T]) Metadata() map[string]interface{} {
+	return it.metadata
+}
+
+// Err returns the error which stopped the iteration, nil when the items were exhausted
+func (it *PageIterator[T]) Err() error {
+	return it.err
+}
+
+// Close stops the iteration and cancels the pages being prefetched
+func (it *PageIterator[T]) Close() {
+	it.items = nil
+	it.stop(nil)
+}
+
+// stop ends the iteration with the error
+func (it *PageIterator[T]) stop(err error) {
+	if it.err == nil {
+		it.err = err
+	}
+	it.done = true
+	it.cancel()
+}
+
+// fetchPage returns the next page, fetched now or prefetched
+func (it *PageIterator[T]) fetchPage() page[T] {
+	if it.config.Prefetch <= 0 {
+		return it.fetchNext(it.ctx)
+	}
+
+	if !it.started {
+		it.started = true
+		it.pages = make(chan chan page[T], it.config.Prefetch)
+		if it.config.Style == PagePagination || it.config.Style == OffsetPagination {
+			go it.prefetchNumbered()
+		} else {
+			go it.prefetchSequential()
+		}
+	}
+
+	select {
+	case future, ok := <-it.pages:
+		if !ok {
+			return page[T]{last: true, err: it.ctx.Err()}
+		}
+		select {
+		case p := <-future:
+			return p
+		case <-it.ctx.Done():
+			return page[T]{err: it.ctx.Err()}
+		}
+	case <-it.ctx.Done():
+		return page[T]{err: it.ctx.Err()}
+	}
+}
+
+// prefetchNumbered fetches the pages of the page and offset styles concurrently, until the last page is known
+func (it *PageIterator[T]) prefetchNumbered() {
+	defer close(it.pages)
+
+	for number := 0; ; number++ {
+		if last := atomic.LoadInt64(&it.lastPage); last >= 0 && int64(number) > last {
+			return
+		}
+
+		future := make(chan page[T], 1)
+		select {
+		case it.pages <- future:
+		case <-it.ctx.Done():
+			return
+		}
+
+		go func(number int) {
+			p := it.fetch(it.ctx, it.numberedURL(number), number)
+			if p.last {
+				atomic.CompareAndSwapInt64(&it.lastPage, -1, int64(number))
+			}
+			future <- p
+		}(number)
+	}
+}
+
+// prefetchSequential fetches the pages of the cursor and link styles one after the other ahead of the iteration
+func (it *PageIterator[T]) prefetchSequential() {
+	defer close(it.pages)
+
+	for {
+		future := make(chan page[T], 1)
+		p := it.fetchNext(it.ctx)
+		future <- p
+
+		select {
+		case it.pages <- future:
+		case <-it.ctx.Done():
+			return
+		}
+		if p.err != nil || p.last {
+			return
+		}
+	}
+}
+
+// fetchNext fetches the page following the last fetched one
+func (it *PageIterator[T]) fetchNext(ctx context.Context) page[T] {
+	var target string
+	switch it.config.Style {
+	case PagePagination, OffsetPagination:
+		target = it.numberedURL(it.number)
+	case CursorPagination, LinkPagination:
+		target = it.next
+		if it.number == 0 {
+			target = it.firstURL(it.config.Style == CursorPagination)
+		}
+	default:
+		return page[T]{err: fmt.Errorf("client: unknown pagination style %q", it.config.Style)}
+	}
+
+	p := it.fetch(ctx, target, it.number)
+	it.number++
+	it.next = p.next
+
+	return p
+}
+
+// firstURL returns the url of the first page of the cursor and link styles, with the page size
+func (it *PageIterator[T]) firstURL(withLimit bool) string {
+	urlPath, errDo := it.client.buildURL(it.path)
+	if errDo != nil {
+		return ""
+	}
+	if !withLimit {
+		return urlPath
+	}
+
+	return setQuery(urlPath, map[string]string{it.config.LimitParam: strconv.Itoa(it.config.Limit)})
+}
+
+// numberedURL returns the url of the page of the page and offset styles, numbered from zero
+func (it *PageIterator[T]) numberedURL(number int) string {
+	urlPath, errDo := it.client.buildURL(it.path)
+	if errDo != nil {
+		return ""
+	}
+
+	params := map[string]string{it.config.LimitParam: strconv.Itoa(it.config.Limit)}
+	if it.config.Style == OffsetPagination {
+		params[it.config.OffsetParam] = strconv.Itoa(number * it.config.Limit)
+	} else {
+		params[it.config.PageParam] = strconv.Itoa(it.config.FirstPage + number)
+	}
+
+	return setQuery(urlPath, params)
+}
+
+// fetch calls the url of the page numbered from zero and works out whether it is the last one
+func (it *PageIterator[T]) fetch(ctx context.Context, target string, number int) page[T] {
+	if target == "" {
+		return page[T]{err: fmt.Errorf("client: invalid url of the page %d of %s", number, it.path)}
+	}
+
+	var body pageBody[T]
+	call := &Call{
+		Method: GET,
+		URL:    target,
+		Result: &body,
+	}
+	if err := it.client.Execute(ctx, call, it.opts...).Err(); err != nil {
+		return page[T]{err: err}
+	}
+
+	// the envelope is already unwrapped in envelope mode
+	if body.Metadata == nil {
+		body.Metadata = call.Metadata
+	}
+
+	p := page[T]{
+		items:    body.Data,
+		metadata: body.Metadata,
+	}
+	switch it.config.Style {
+	case PagePagination, OffsetPagination:
+		p.last = len(body.Data) < it.config.Limit
+		if total, ok := metadataInt(body.Metadata, it.config.TotalKey); ok && (number+1)*it.config.Limit >= total {
+			p.last = true
+		}
+	case CursorPagination:
+		cursor, _ := body.Metadata[it.config.NextCursorKey].(string)
+		if cursor != "" && len(body.Data) > 0 {
+			p.next = setQuery(target, map[string]string{it.config.CursorParam: cursor})
+		}
+		p.last = p.next == ""
+	case LinkPagination:
+		next, err := nextLink(target, call.ResponseHeader)
+		if err != nil {
+			p.err = err
+		}
+		p.next = next
+		p.last = p.next == ""
+	}
+
+	return p
+}
+
+// setQuery sets the query params of the url
+func setQuery(rawURL string, params map[string]string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	query := parsed.Query()
+	for key, value := range params {
+		query.Set(key, value)
+	}
+	parsed.RawQuery = query.Encode()
+
+	return parsed.String()
+}
+
+// metadataInt returns the integer value of the metadata key
+func metadataInt(metadata map[string]interface{}, key string) (int, bool) {
+	if key == "" {
+		return 0, false
+	}
+
+	switch value := metadata[key].(type) {
+	case float64:
+		return int(value), true
+	case json.Number:
+		n, err := value.Int64()
+		return int(n), err == nil
+	case string:
+		n, err := strconv.Atoi(value)
+		return n, err == nil
+	}
+
+	return 0, false
+}
+
+// nextLink returns the url of the rel="next" link of the Link header, resolved against the url of the page,
+// ErrCrossOriginLink when its scheme or host differs from the ones of the page
+func nextLink(pageURL string, header http.Header) (string, error) {
+	for _, value := range header.Values("Link") {
+		for _, link := range strings.Split(value, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+
+			for _, param := range parts[1:] {
+				name, rel, ok := strings.Cut(strings.TrimSpace(param), "=")
+				if !ok || !strings.EqualFold(name, "rel") {
+					continue
+				}
+				for _, r := range strings.Fields(strings.Trim(rel, `"`)) {
+					if r != "next" {
+						continue
+					}
+
+					base, err := url.Parse(pageURL)
+					if err != nil {
+						return "", nil
+					}
+					next, err := base.Parse(strings.Trim(target, "<>"))
+					if err != nil {
+						return "", nil
+					}
+					if !strings.EqualFold(next.Scheme, base.Scheme) || !strings.EqualFold(next.Host, base.Host) {
+						return "", fmt.Errorf("%w: %s", ErrCrossOriginLink, next.Redacted())
+					}
+					return next.String(), nil
+				}
+			}
+		}
+	}
+
+	return "", nil
+}
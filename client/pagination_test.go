@@ -0,0 +1,268 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// paginatedServer serves the items 1 to total in pages of every style
+func paginatedServer(t *testing.T, total int, bare bool) (*httptest.Server, *[]string) {
+	t.Helper()
+
+	mutex := sync.Mutex{}
+	requests := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests = append(requests, r.URL.RequestURI())
+		mutex.Unlock()
+
+		query := r.URL.Query()
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		if limit == 0 {
+			limit = 2
+		}
+		start := 0
+		switch {
+		case query.Get("page") != "":
+			page, _ := strconv.Atoi(query.Get("page"))
+			start = (page - 1) * limit
+		case query.Get("offset") != "":
+			start, _ = strconv.Atoi(query.Get("offset"))
+		case query.Get("cursor") != "":
+			start, _ = strconv.Atoi(query.Get("cursor"))
+		case query.Get("after") != "":
+			start, _ = strconv.Atoi(query.Get("after"))
+		}
+		if r.URL.Path == "/failing" && start > 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		items := []int{}
+		for i := start + 1; i <= total && i <= start+limit; i++ {
+			items = append(items, i)
+		}
+		metadata := map[string]interface{}{"total": total}
+		if end := start + len(items); end < total {
+			metadata["next_cursor"] = strconv.Itoa(end)
+			next := fmt.Sprintf("%s?after=%d", r.URL.Path, end)
+			if r.URL.Path == "/cross-origin" {
+				next = "http://other.local" + next
+			}
+			w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next", <%s?after=0>; rel="first"`, next, r.URL.Path))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if bare {
+			_ = json.NewEncoder(w).Encode(items)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": items, "metadata": metadata})
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &requests
+}
+
+func TestPaginate(t *testing.T) {
+	tests := []struct {
+		name         string
+		path         string
+		total        int
+		bare         bool
+		config       PaginationConfig
+		want         []int
+		wantRequests int
+		wantErr      bool
+		wantErrIs    error
+	}{
+		{
+			name:         "page style",
+			path:         "items",
+			total:        5,
+			config:       PaginationConfig{Limit: 2},
+			want:         []int{1, 2, 3, 4, 5},
+			wantRequests: 3,
+		},
+		{
+			name:         "page style ending with the total",
+			path:         "items",
+			total:        4,
+			config:       PaginationConfig{Limit: 2, TotalKey: "total"},
+			want:         []int{1, 2, 3, 4},
+			wantRequests: 2,
+		},
+		{
+			name:         "page style of bare arrays",
+			path:         "items",
+			total:        3,
+			bare:         true,
+			config:       PaginationConfig{Limit: 2},
+			want:         []int{1, 2, 3},
+			wantRequests: 2,
+		},
+		{
+			name:         "offset style",
+			path:         "items",
+			total:        5,
+			config:       PaginationConfig{Style: OffsetPagination, Limit: 2},
+			want:         []int{1, 2, 3, 4, 5},
+			wantRequests: 3,
+		},
+		{
+			name:         "cursor style",
+			path:         "items",
+			total:        5,
+			config:       PaginationConfig{Style: CursorPagination, Limit: 2},
+			want:         []int{1, 2, 3, 4, 5},
+			wantRequests: 3,
+		},
+		{
+			name:         "link style",
+			path:         "items",
+			total:        5,
+			config:       PaginationConfig{Style: LinkPagination},
+			want:         []int{1, 2, 3, 4, 5},
+			wantRequests: 3,
+		},
+		{
+			name:      "link style to another origin",
+			path:      "cross-origin",
+			total:     5,
+			config:    PaginationConfig{Style: LinkPagination},
+			want:      []int{1, 2},
+			wantErr:   true,
+			wantErrIs: ErrCrossOriginLink,
+		},
+		{
+			name:      "failed page",
+			path:      "failing",
+			total:     5,
+			config:    PaginationConfig{Limit: 2},
+			want:      []int{1, 2},
+			wantErr:   true,
+			wantErrIs: ErrServerError,
+		},
+		{
+			name:    "unknown style",
+			path:    "items",
+			total:   5,
+			config:  PaginationConfig{Style: "unknown"},
+			want:    []int{},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		for _, prefetch := range []int{0, 2} {
+			t.Run(fmt.Sprintf("%s prefetching %d pages", test.name, prefetch), func(t *testing.T) {
+				server, requests := paginatedServer(t, test.total, test.bare)
+				client := newTestClient(t, server.URL, HTTPClient{})
+
+				config := test.config
+				config.Prefetch = prefetch
+				items := Paginate[int](context.Background(), client, test.path, config)
+				defer items.Close()
+
+				got := []int{}
+				for items.Next() {
+					got = append(got, items.Item())
+				}
+
+				err := items.Err()
+				if (err != nil) != test.wantErr {
+					t.Fatalf("error = %v, want error %t", err, test.wantErr)
+				}
+				if test.wantErrIs != nil && !errors.Is(err, test.wantErrIs) {
+					t.Fatalf("error = %v, want %v", err, test.wantErrIs)
+				}
+				if fmt.Sprint(got) != fmt.Sprint(test.want) {
+					t.Errorf("items = %v, want %v", got, test.want)
+				}
+				// the prefetching may fetch the pages following the last one concurrently
+				if test.wantRequests > 0 && prefetch == 0 && len(*requests) != test.wantRequests {
+					t.Errorf("requests = %v, want %d", *requests, test.wantRequests)
+				}
+			})
+		}
+	}
+}
+
+func TestPaginateMetadata(t *testing.T) {
+	server, requests := paginatedServer(t, 3, false)
+	client := newTestClient(t, server.URL, HTTPClient{})
+
+	items := Paginate[int](context.Background(), client, "items?status=active", PaginationConfig{Limit: 2, FirstPage: 1})
+	defer items.Close()
+
+	if !items.Next() {
+		t.Fatalf("no item, error = %v", items.Err())
+	}
+	if total, ok := metadataInt(items.Metadata(), "total"); !ok || total != 3 {
+		t.Errorf("metadata = %v, want the total", items.Metadata())
+	}
+	if (*requests)[0] != "/items?limit=2&page=1&status=active" {
+		t.Errorf("request = %q, want the query of the path kept", (*requests)[0])
+	}
+}
+
+func TestPaginateClose(t *testing.T) {
+	server, _ := paginatedServer(t, 100, false)
+	client := newTestClient(t, server.URL, HTTPClient{})
+
+	items := Paginate[int](context.Background(), client, "items", PaginationConfig{Limit: 2, Prefetch: 3})
+	if !items.Next() {
+		t.Fatalf("no item, error = %v", items.Err())
+	}
+	items.Close()
+
+	if items.Next() {
+		t.Errorf("item %d after the iterator was closed", items.Item())
+	}
+	if err := items.Err(); err != nil {
+		t.Errorf("error = %v after the iterator was closed", err)
+	}
+}
+
+func TestNextLink(t *testing.T) {
+	tests := []struct {
+		name    string
+		links   []string
+		want    string
+		wantErr error
+	}{
+		{name: "no link"},
+		{name: "absolute link", links: []string{`<http://api.local/items?after=2>; rel="next"`}, want: "http://api.local/items?after=2"},
+		{name: "relative link", links: []string{`</items?after=2>; rel=next`}, want: "http://api.local/items?after=2"},
+		{name: "next among the links", links: []string{`</items?after=0>; rel="first", </items?after=4>; rel="prev next"`}, want: "http://api.local/items?after=4"},
+		{name: "next in another header", links: []string{`</items?after=0>; rel="first"`, `</items?after=6>; REL="next"`}, want: "http://api.local/items?after=6"},
+		{name: "no next link", links: []string{`</items?after=0>; rel="first"`}},
+		{name: "malformed link", links: []string{`/items?after=2; rel="next"`}},
+		{name: "other host", links: []string{`<http://other.local/items?after=2>; rel="next"`}, wantErr: ErrCrossOriginLink},
+		{name: "other scheme", links: []string{`<https://api.local/items?after=2>; rel="next"`}, wantErr: ErrCrossOriginLink},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := http.Header{}
+			for _, link := range test.links {
+				header.Add("Link", link)
+			}
+
+			next, err := nextLink("http://api.local/items?limit=2", header)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("error = %v, want %v", err, test.wantErr)
+			}
+			if next != test.want {
+				t.Errorf("next = %q, want %q", next, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// Call represents a single client call travelling through the request pipeline
+type Call struct {
+	Method Method
+	URL    string
+	Header http.Header
+	// Request is encoded into Body by the codec of the call when Body is nil
+	Request interface{}
+	Body    []byte
+	// BodyReader is streamed as request body instead of Body when given (see Stream)
+	BodyReader  io.Reader
+	Result      interface{}
+	Response    string
+	HTTPRequest *http.Request
+
+	StatusCode     int
+	ResponseHeader http.Header
+	Attempts       int
+	// ResponseBody is the unread body of a successful streaming call, closed by the caller
+	ResponseBody io.ReadCloser
+	// Metadata is the metadata of the response in envelope mode
+	Metadata map[string]interface{}
+
+	options    callOptions
+	codecs     map[string]Codec
+	envelope   bool
+	streaming  bool
+	bodyOffset int64
+	bodySent   bool
+}
+
+// Handler executes a call and stores the raw response body into call.Response
+type Handler func(ctx context.Context, call *Call) *ResponseError
+
+// Middleware wraps a handler to add cross-cutting behavior (auth, logging, caching, tracing, etc.)
+type Middleware func(next Handler) Handler
+
+// Chain composes middlewares into one, the first middleware being the outermost
+func Chain(middlewares ...Middleware) Middleware {
+	return func(next Handler) Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			next = middlewares[i](next)
+		}
+		return next
+	}
+}
+
+// Execute runs the call through the client pipeline.
+//
+// The pipeline is composed (outermost first) of the tracing when enabled, the client middlewares, authentication,
+// the credential of the credential provider when given, the middlewares given
+// as option, http caching when enabled (except for the streaming calls), response decoding, logging
+// and the rate limits when given, and ends by sending the request with Do.
+// The request of the call is encoded beforehand with its codec (see WithCodec).
+// The options carried by the context (see WithCallOptions) are applied before the given ones.
+func (c *HTTPClient) Execute(ctx context.Context, call *Call, opts ...CallOption) *ResponseError {
+	for _, opt := range contextCallOptions(ctx) {
+		opt(&call.options)
+	}
+	for _, opt := range opts {
+		opt(&call.options)
+	}
+
+	if call.options.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, call.options.timeout)
+		defer func() {
+			// the timeout of a streaming call lasts until its response body is closed
+			if call.ResponseBody != nil {
+				call.ResponseBody = &cancelOnClose{ReadCloser: call.ResponseBody, cancel: cancel}
+				return
+			}
+			cancel()
+		}()
+	}
+
+	if call.Header == nil {
+		call.Header = http.Header{}
+	}
+	c.setIdempotencyKey(string(call.Method), call.Header, call.options.idempotencyKey)
+	call.codecs = c.Codecs
+	call.envelope = c.Envelope || call.options.envelope
+	if errDo := call.encodeRequest(); errDo != nil {
+		return errDo
+	}
+	if call.Header.Get("Content-Type") == "" {
+		call.Header.Set("Content-Type", "application/json")
+	}
+
+	pipeline := make([]Middleware, 0, len(c.Middlewares)+len(call.options.middlewares)+6)
+	if c.instrumentation != nil {
+		pipeline = append(pipeline, c.tracing())
+	}
+	pipeline = append(pipeline, c.Middlewares...)
+	pipeline = append(pipeline, c.authentication())
+	if c.credentialCache != nil {
+		pipeline = append(pipeline, c.credentials())
+	}
+	pipeline = append(pipeline, call.options.middlewares...)
+	if (c.HTTPCaching || call.options.httpCaching) && !call.streaming {
+		pipeline = append(pipeline, c.httpCaching())
+	}
+	pipeline = append(pipeline, decoding(), c.logging())
+	if len(c.rateLimiters) > 0 {
+		pipeline = append(pipeline, c.rateLimiting())
+	}
+
+	return Chain(pipeline...)(c.send)(ctx, call)
+}
+
+// send builds the http request of the call and sends it
+func (c *HTTPClient) send(ctx context.Context, call *Call) *ResponseError {
+	req, err := call.newRequest(ctx)
+	if err != nil {
+		return &ResponseError{
+			Error: err,
+		}
+	}
+	for key, values := range call.Header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	call.HTTPRequest = req
+
+	res, response, attempts, errDo := c.do(req, call.streaming)
+	call.Response = response
+	call.Attempts = attempts
+	if res != nil {
+		call.StatusCode = res.StatusCode
+		call.ResponseHeader = res.Header
+		if call.streaming && !isFailure(errDo) {
+			call.ResponseBody = res.Body
+		}
+	}
+
+	return errDo
+}
+
+// decode unmarshals the raw response of the call into its result with the codec of the response,
+// unwrapping the envelope of the json responses in envelope mode
+func (call *Call) decode() error {
+	if call.Response == "" {
+		return nil
+	}
+
+	codec := call.responseCodec()
+	if _, ok := codec.(JSONCodec); ok && call.envelope {
+		return call.decodeEnvelope()
+	}
+	if call.Result == nil {
+		return nil
+	}
+
+	return codec.Unmarshal([]byte(call.Response), call.Result)
+}
+
+// DecodeResponse decodes the successful response of the content type into the result like the calls do,
+// following the options carried by the context (see WithCallOptions) then the given ones,
+// e.g. WithEnvelope, WithMetadata or WithResponseCodec. It lets the doubles of GenericHTTPClient decode like the client.
+func DecodeResponse(ctx context.Context, response []byte, contentType string, result interface{}, opts ...CallOption) error {
+	call := &Call{
+		Result:         result,
+		Response:       string(response),
+		ResponseHeader: http.Header{},
+	}
+	if contentType != "" {
+		call.ResponseHeader.Set("Content-Type", contentType)
+	}
+	for _, opt := range contextCallOptions(ctx) {
+		opt(&call.options)
+	}
+	for _, opt := range opts {
+		opt(&call.options)
+	}
+	call.envelope = call.options.envelope
+
+	return call.decode()
+}
+
+// decoding decodes the response into the call result once the call succeeded
+func decoding() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) *ResponseError {
+			errDo := next(ctx, call)
+			if isFailure(errDo) {
+				return errDo
+			}
+
+			if err := call.decode(); err != nil {
+				return &ResponseError{
+					Error: err,
+				}
+			}
+
+			return errDo
+		}
+	}
+}
+
+// buildURL joins the api url of the client with the given path
+func (c *HTTPClient) buildURL(path string) (string, *ResponseError) {
+	urlPath, err := url.Parse(fmt.Sprintf("%s/%s", c.APIURL, path))
+	if err != nil {
+		return "", &ResponseError{
+			Error: err,
+		}
+	}
+
+	return urlPath.String(), nil
+}
+
+// newCall prepares a call for the given path of the client, the request being encoded by Execute
+func (c *HTTPClient) newCall(path string, method Method, request interface{}, result interface{}) (*Call, *ResponseError) {
+	urlPath, errDo := c.buildURL(path)
+	if errDo != nil {
+		return nil, errDo
+	}
+
+	return &Call{
+		Method:  method,
+		URL:     urlPath,
+		Request: request,
+		Result:  result,
+	}, nil
+}
+
+// isFailure reports whether the response error represents a failed call
+func isFailure(errDo *ResponseError) bool {
+	return errDo != nil && (errDo.Error != nil || errDo.Message != "")
+}
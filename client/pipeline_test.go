@@ -0,0 +1,210 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newTestClient creates a client of the server without logs, named after the test unless a name is given
+func newTestClient(t *testing.T, serverURL string, config HTTPClient) *HTTPClient {
+	t.Helper()
+
+	config.APIURL = serverURL
+	if config.ClientName == "" {
+		config.ClientName = strings.NewReplacer("/", "-", " ", "-").Replace(t.Name())
+	}
+	if config.Logging == nil {
+		config.Logging = &LoggingConfig{Level: LogLevelOff}
+	}
+
+	return NewHTTPClient(config, nil)
+}
+
+// tracing returns a middleware appending its name to the trace before and after the next handler
+func tracing(trace *[]string, name string) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) *ResponseError {
+			*trace = append(*trace, name)
+			errDo := next(ctx, call)
+			*trace = append(*trace, "/"+name)
+			return errDo
+		}
+	}
+}
+
+func TestChain(t *testing.T) {
+	trace := []string{}
+	handler := Chain(tracing(&trace, "a"), tracing(&trace, "b"))(func(ctx context.Context, call *Call) *ResponseError {
+		trace = append(trace, "send")
+		return nil
+	})
+
+	if errDo := handler(context.Background(), &Call{}); errDo != nil {
+		t.Fatalf("handler failed: %v", errDo.Error)
+	}
+	if got, want := strings.Join(trace, " "), "a b send /b /a"; got != want {
+		t.Errorf("trace = %q, want %q", got, want)
+	}
+}
+
+func TestExecutePipeline(t *testing.T) {
+	errRejected := errors.New("rejected")
+
+	tests := []struct {
+		name          string
+		middleware    Middleware
+		wantTrace     string
+		wantUpstream  int32
+		wantErr       error
+		wantHeader    string
+		wantResultKey string
+	}{
+		{
+			name: "call middleware sees the client middleware headers",
+			middleware: func(next Handler) Handler {
+				return func(ctx context.Context, call *Call) *ResponseError {
+					call.Header.Set("X-Call", call.Header.Get("X-Client")+"+call")
+					return next(ctx, call)
+				}
+			},
+			wantTrace:     "client /client",
+			wantUpstream:  1,
+			wantHeader:    "client+call",
+			wantResultKey: "value",
+		},
+		{
+			name: "call middleware short-circuits the upstream",
+			middleware: func(next Handler) Handler {
+				return func(ctx context.Context, call *Call) *ResponseError {
+					return &ResponseError{Message: "rejected", Error: errRejected}
+				}
+			},
+			wantTrace: "client /client",
+			wantErr:   errRejected,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var upstream int32
+			var header atomic.Value
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&upstream, 1)
+				header.Store(r.Header.Get("X-Call"))
+				_, _ = w.Write([]byte(`{"key":"value"}`))
+			}))
+			defer server.Close()
+
+			trace := []string{}
+			client := newTestClient(t, server.URL, HTTPClient{
+				Middlewares: []Middleware{
+					tracing(&trace, "client"),
+					func(next Handler) Handler {
+						return func(ctx context.Context, call *Call) *ResponseError {
+							call.Header.Set("X-Client", "client")
+							return next(ctx, call)
+						}
+					},
+				},
+			})
+
+			result := map[string]string{}
+			errDo := client.CallClient(WithCallOptions(context.Background(), WithMiddlewares(test.middleware)), "items", GET, nil, &result, false)
+
+			if err := errDo.Err(); !errors.Is(err, test.wantErr) {
+				t.Fatalf("error = %v, want %v", err, test.wantErr)
+			}
+			if got := strings.Join(trace, " "); got != test.wantTrace {
+				t.Errorf("trace = %q, want %q", got, test.wantTrace)
+			}
+			if got := atomic.LoadInt32(&upstream); got != test.wantUpstream {
+				t.Errorf("upstream called %d times, want %d", got, test.wantUpstream)
+			}
+			if test.wantUpstream > 0 && header.Load() != test.wantHeader {
+				t.Errorf("X-Call = %v, want %q", header.Load(), test.wantHeader)
+			}
+			if result["key"] != test.wantResultKey {
+				t.Errorf("result = %v, want key %q", result, test.wantResultKey)
+			}
+		})
+	}
+}
+
+func TestDecodeResponse(t *testing.T) {
+	type item struct {
+		ID int `json:"id" xml:"id"`
+	}
+
+	tests := []struct {
+		name         string
+		ctx          context.Context
+		response     string
+		contentType  string
+		opts         []CallOption
+		want         item
+		wantMetadata map[string]interface{}
+		wantErr      bool
+	}{
+		{
+			name:        "json",
+			ctx:         context.Background(),
+			response:    `{"id":1}`,
+			contentType: "application/json",
+			want:        item{ID: 1},
+		},
+		{
+			name:        "codec of the content type",
+			ctx:         context.Background(),
+			response:    `<item><id>2</id></item>`,
+			contentType: "application/xml; charset=utf-8",
+			want:        item{ID: 2},
+		},
+		{
+			name:         "envelope of the options of the context",
+			ctx:          WithCallOptions(context.Background(), WithEnvelope()),
+			response:     `{"data":{"id":3},"metadata":{"page":1}}`,
+			want:         item{ID: 3},
+			wantMetadata: map[string]interface{}{"page": float64(1)},
+		},
+		{
+			name:     "response codec of the given options",
+			ctx:      context.Background(),
+			response: `<item><id>4</id></item>`,
+			opts:     []CallOption{WithResponseCodec(XMLCodec{})},
+			want:     item{ID: 4},
+		},
+		{
+			name:     "invalid response",
+			ctx:      context.Background(),
+			response: `{`,
+			wantErr:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := item{}
+			metadata := map[string]interface{}{}
+			opts := append(test.opts, WithMetadata(&metadata))
+			if test.wantMetadata == nil {
+				opts = test.opts
+			}
+
+			err := DecodeResponse(test.ctx, []byte(test.response), test.contentType, &result, opts...)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error = %v, want error %t", err, test.wantErr)
+			}
+			if result != test.want {
+				t.Errorf("result = %+v, want %+v", result, test.want)
+			}
+			if test.wantMetadata != nil && metadata["page"] != test.wantMetadata["page"] {
+				t.Errorf("metadata = %v, want %v", metadata, test.wantMetadata)
+			}
+		})
+	}
+}
@@ -0,0 +1,373 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/time/rate"
+)
+
+// CodeRateLimited is the code of the response error returned when a call exceeds the rate limits of the client
+const CodeRateLimited = "Rate Limited"
+
+// DefaultRedisRateLimitPrefix is the prefix of the keys of the distributed rate limits
+const DefaultRedisRateLimitPrefix = "client:ratelimit:"
+
+//
+// Private constants
+//
+
+const defaultRateLimitInterval = time.Second
+const defaultRateLimitLeaseTimeout = time.Minute
+const rateLimitPollInterval = 50 * time.Millisecond
+
+// takeTokenScript takes a token of the bucket refilled at the rate of ARGV[1] tokens per ms up to the burst ARGV[2],
+// and returns 0 when taken or the number of ms until the next token
+const takeTokenScript = `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local bucket = redis.call("hmget", KEYS[1], "tokens", "ts")
+local tokens = tonumber(bucket[1])
+local ts = tonumber(bucket[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+if now > ts then
+	tokens = math.min(burst, tokens + (now - ts) * rate)
+	ts = now
+end
+if tokens < 1 then
+	return math.ceil((1 - tokens) / rate)
+end
+redis.call("hmset", KEYS[1], "tokens", tostring(tokens - 1), "ts", tostring(ts))
+redis.call("pexpire", KEYS[1], ARGV[4])
+return 0
+`
+
+// returnTokenScript gives a token back to the bucket of the burst ARGV[1], when the bucket still exists
+const returnTokenScript = `
+local tokens = tonumber(redis.call("hget", KEYS[1], "tokens"))
+if tokens ~= nil then
+	redis.call("hset", KEYS[1], "tokens", tostring(math.min(tonumber(ARGV[1]), tokens + 1)))
+end
+return 0
+`
+
+// acquireSlotScript adds the lease ARGV[4] expiring at ARGV[3] to the set of the in-flight calls
+// when it holds less than ARGV[2] leases which did not expire at ARGV[1]
+const acquireSlotScript = `
+redis.call("zremrangebyscore", KEYS[1], "-inf", ARGV[1])
+if redis.call("zcard", KEYS[1]) >= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call("zadd", KEYS[1], ARGV[3], ARGV[4])
+redis.call("pexpire", KEYS[1], ARGV[5])
+return 1
+`
+
+// RateLimitConfig represents the rate and concurrency limits of the client.
+//
+// The limits are enforced inside the client, after the caching, so that the calls served from the cache are
+// never limited. The retries of a call take a token of its rate limits as well, a retry which is not allowed
+// returns the last response instead.
+type RateLimitConfig struct {
+	// Limits are the limits of the calls, every limit matching the route of a call applies
+	Limits []RateLimit
+	// Distributed shares the limits between the replicas in redis under the client name,
+	// it requires the redis client given to NewHTTPClient; the limits fall back to local ones when redis fails
+	Distributed bool
+	// LeaseTimeout is how long an in-flight call is counted in redis when its replica dies before releasing it,
+	// 1 min by default
+	LeaseTimeout time.Duration
+}
+
+// RateLimit represents a token bucket rate limit and a max in-flight limit of the calls of a route pattern
+type RateLimit struct {
+	// Route is the pattern of the route of the limited calls (see WithRoute), matched with path.Match,
+	// e.g. "/messages/*"; all the calls are limited when empty
+	Route string
+	// Rate is the number of calls allowed per Interval, unlimited when zero
+	Rate int
+	// Interval is the period of the rate, 1s by default
+	Interval time.Duration
+	// Burst is the max number of calls sent at once, Rate by default
+	Burst int
+	// MaxInFlight is the max number of concurrent calls, unlimited when zero
+	MaxInFlight int
+	// Wait makes the calls wait for the limit, until their context is done, instead of failing fast with ErrRateLimited
+	Wait bool
+}
+
+// rateLimiter enforces a rate limit locally, and in redis when distributed
+type rateLimiter struct {
+	limit       RateLimit
+	key         string
+	tokens      *rate.Limiter
+	slots       chan struct{}
+	distributed bool
+}
+
+// rateLimitersKey is the context key of the rate limiters of the call, which the retries take a token of
+type rateLimitersKey struct{}
+
+// newRateLimiters creates the limiters of the rate limit config
+func newRateLimiters(clientName string, config RateLimitConfig) []*rateLimiter {
+	limiters := make([]*rateLimiter, 0, len(config.Limits))
+	for _, limit := range config.Limits {
+		if limit.Interval == 0 {
+			limit.Interval = defaultRateLimitInterval
+		}
+		if limit.Burst == 0 {
+			limit.Burst = limit.Rate
+		}
+
+		limiter := &rateLimiter{
+			limit:       limit,
+			key:         DefaultRedisRateLimitPrefix + clientName + ":" + limit.Route,
+			distributed: config.Distributed,
+		}
+		if limit.Rate > 0 {
+			limiter.tokens = rate.NewLimiter(rate.Limit(float64(limit.Rate)/limit.Interval.Seconds()), limit.Burst)
+		}
+		if limit.MaxInFlight > 0 {
+			limiter.slots = make(chan struct{}, limit.MaxInFlight)
+		}
+		limiters = append(limiters, limiter)
+	}
+
+	return limiters
+}
+
+// matches reports whether the limiter applies to the route
+func (l *rateLimiter) matches(route string) bool {
+	if l.limit.Route == "" {
+		return true
+	}
+
+	matched, err := path.Match(l.limit.Route, route)
+	return err == nil && matched
+}
+
+// rateLimiting holds the call until the rate limits matching its route allow it, or rejects it
+func (c *HTTPClient) rateLimiting() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) *ResponseError {
+			route := c.route(call)
+			limiters := []*rateLimiter{}
+			for _, limiter := range c.rateLimiters {
+				if limiter.matches(route) {
+					limiters = append(limiters, limiter)
+				}
+			}
+			if len(limiters) == 0 {
+				return next(ctx, call)
+			}
+
+			for _, limiter := range limiters {
+				release, err := c.acquireSlot(ctx, limiter)
+				if err != nil {
+					return c.rateLimitError(err)
+				}
+				defer release()
+			}
+			if err := c.takeTokens(ctx, limiters); err != nil {
+				return c.rateLimitError(err)
+			}
+
+			return next(context.WithValue(ctx, rateLimitersKey{}, limiters), call)
+		}
+	}
+}
+
+// allowRetry takes a token of the rate limits of the call for its retry, false when the retry is not allowed
+func (c *HTTPClient) allowRetry(ctx context.Context) bool {
+	limiters, _ := ctx.Value(rateLimitersKey{}).([]*rateLimiter)
+
+	return c.takeTokens(ctx, limiters) == nil
+}
+
+// takeTokens takes a token of each rate limit, waiting for it when the limit waits.
+// The tokens taken are given back when a limit rejects the call, so that the rejected calls do not use the rates.
+func (c *HTTPClient) takeTokens(ctx context.Context, limiters []*rateLimiter) error {
+	giveBacks := []func(){}
+	for _, limiter := range limiters {
+		if limiter.tokens == nil {
+			continue
+		}
+
+		giveBack, err := c.takeToken(ctx, limiter)
+		if err != nil {
+			for _, giveBack := range giveBacks {
+				giveBack()
+			}
+			return err
+		}
+		giveBacks = append(giveBacks, giveBack)
+	}
+
+	return nil
+}
+
+// takeToken takes a token of the rate limit, waiting for it when the limit waits, and returns its give back
+func (c *HTTPClient) takeToken(ctx context.Context, limiter *rateLimiter) (func(), error) {
+	if c.isDistributed(limiter) {
+		rejected, err := c.takeDistributedToken(ctx, limiter)
+		if err == nil {
+			if rejected != nil {
+				return nil, rejected
+			}
+			return func() { c.returnDistributedToken(ctx, limiter) }, nil
+		}
+		c.log(ctx, LogLevelWarn, "Error taking distributed rate limit", LogFields{"client": c.ClientName, "key": limiter.key, "error": err})
+	}
+
+	// the reservation is canceled at its own time, since canceling it later once it is due restores nothing
+	reservedAt := time.Now()
+	reservation := limiter.tokens.ReserveN(reservedAt, 1)
+	if !reservation.OK() {
+		return nil, ErrRateLimited
+	}
+	giveBack := func() { reservation.CancelAt(reservedAt) }
+
+	delay := reservation.DelayFrom(reservedAt)
+	if delay <= 0 {
+		return giveBack, nil
+	}
+	if !limiter.limit.Wait {
+		giveBack()
+		return nil, ErrRateLimited
+	}
+	if err := sleep(ctx, delay); err != nil {
+		giveBack()
+		return nil, fmt.Errorf("%w: %v", ErrRateLimited, err)
+	}
+
+	return giveBack, nil
+}
+
+// acquireSlot takes an in-flight slot of the limit, waiting for it when the limit waits, and returns its release
+func (c *HTTPClient) acquireSlot(ctx context.Context, limiter *rateLimiter) (func(), error) {
+	if limiter.slots == nil {
+		return func() {}, nil
+	}
+
+	if c.isDistributed(limiter) {
+		release, rejected, err := c.acquireDistributedSlot(ctx, limiter)
+		if err == nil {
+			return release, rejected
+		}
+		c.log(ctx, LogLevelWarn, "Error acquiring distributed rate limit", LogFields{"client": c.ClientName, "key": limiter.key, "error": err})
+	}
+
+	release := func() { <-limiter.slots }
+	if !limiter.limit.Wait {
+		select {
+		case limiter.slots <- struct{}{}:
+			return release, nil
+		default:
+			return nil, ErrRateLimited
+		}
+	}
+
+	select {
+	case limiter.slots <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%w: %v", ErrRateLimited, ctx.Err())
+	}
+}
+
+func (c *HTTPClient) isDistributed(limiter *rateLimiter) bool {
+	return limiter.distributed && c.redisClient != nil
+}
+
+// takeDistributedToken takes a token of the bucket of the limit in redis,
+// rejected is the rejection of the limit while err is the failure of redis
+func (c *HTTPClient) takeDistributedToken(ctx context.Context, limiter *rateLimiter) (rejected error, err error) {
+	perMillisecond := float64(limiter.limit.Rate) / (float64(limiter.limit.Interval) / float64(time.Millisecond))
+	ttl := int64(math.Ceil(float64(limiter.limit.Burst)/perMillisecond)) + time.Second.Milliseconds()
+
+	for {
+		wait, err := c.redisClient.WithContext(ctx).Eval(takeTokenScript, []string{limiter.key + ":tokens"},
+			perMillisecond, limiter.limit.Burst, time.Now().UnixNano()/int64(time.Millisecond), ttl).Int64()
+		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("%w: %v", ErrRateLimited, ctx.Err()), nil
+			}
+			return nil, err
+		}
+		if wait == 0 {
+			return nil, nil
+		}
+		if !limiter.limit.Wait {
+			return ErrRateLimited, nil
+		}
+		if err = sleep(ctx, time.Duration(wait)*time.Millisecond); err != nil {
+			return fmt.Errorf("%w: %v", ErrRateLimited, err), nil
+		}
+	}
+}
+
+// returnDistributedToken gives the token back to the bucket of the limit in redis
+func (c *HTTPClient) returnDistributedToken(ctx context.Context, limiter *rateLimiter) {
+	err := c.redisClient.WithContext(detachedContext{ctx}).Eval(returnTokenScript, []string{limiter.key + ":tokens"}, limiter.limit.Burst).Err()
+	if err != nil {
+		c.log(ctx, LogLevelWarn, "Error returning distributed rate limit", LogFields{"client": c.ClientName, "key": limiter.key, "error": err})
+	}
+}
+
+// acquireDistributedSlot adds a lease to the in-flight calls of the limit in redis,
+// polling until a lease is released or expires when the limit waits.
+// rejected is the rejection of the limit while err is the failure of redis.
+func (c *HTTPClient) acquireDistributedSlot(ctx context.Context, limiter *rateLimiter) (release func(), rejected error, err error) {
+	leaseTimeout := defaultRateLimitLeaseTimeout
+	if c.RateLimit != nil && c.RateLimit.LeaseTimeout > 0 {
+		leaseTimeout = c.RateLimit.LeaseTimeout
+	}
+	key := limiter.key + ":inflight"
+	lease := uuid.New().String()
+
+	for {
+		now := time.Now()
+		acquired, err := c.redisClient.WithContext(ctx).Eval(acquireSlotScript, []string{key},
+			now.UnixNano()/int64(time.Millisecond), limiter.limit.MaxInFlight,
+			now.Add(leaseTimeout).UnixNano()/int64(time.Millisecond), lease, leaseTimeout.Milliseconds()).Int64()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("%w: %v", ErrRateLimited, ctx.Err()), nil
+			}
+			return nil, nil, err
+		}
+		if acquired == 1 {
+			return func() {
+				if err := c.redisClient.ZRem(key, lease).Err(); err != nil {
+					c.log(ctx, LogLevelWarn, "Error releasing distributed rate limit", LogFields{"client": c.ClientName, "key": key, "error": err})
+				}
+			}, nil, nil
+		}
+		if !limiter.limit.Wait {
+			return nil, ErrRateLimited, nil
+		}
+		if err = sleep(ctx, rateLimitPollInterval); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrRateLimited, err), nil
+		}
+	}
+}
+
+// rateLimitError converts the rejection of the rate limits into the response error of the call
+func (c *HTTPClient) rateLimitError(err error) *ResponseError {
+	return &ResponseError{
+		Code:       CodeRateLimited,
+		Message:    "Rate limit exceeded",
+		StatusCode: http.StatusTooManyRequests,
+		Error:      err,
+		Info:       fmt.Sprintf("Rate limits of [%s] rejected the call", c.ClientName),
+	}
+}
@@ -0,0 +1,296 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+)
+
+func TestRateLimit(t *testing.T) {
+	tests := []struct {
+		name         string
+		limits       []RateLimit
+		route        string
+		timeout      time.Duration
+		calls        int
+		wantUpstream int32
+		wantErrors   int
+		wantElapsed  time.Duration
+	}{
+		{
+			name:         "calls within the rate",
+			limits:       []RateLimit{{Rate: 3}},
+			calls:        3,
+			wantUpstream: 3,
+		},
+		{
+			name:         "calls beyond the rate rejected",
+			limits:       []RateLimit{{Rate: 1, Interval: time.Minute}},
+			calls:        3,
+			wantUpstream: 1,
+			wantErrors:   2,
+		},
+		{
+			name:         "calls of another route not limited",
+			limits:       []RateLimit{{Route: "/messages/*", Rate: 1, Interval: time.Minute}},
+			route:        "/drugs",
+			calls:        3,
+			wantUpstream: 3,
+		},
+		{
+			name:         "calls of the route limited",
+			limits:       []RateLimit{{Route: "/messages/*", Rate: 1, Interval: time.Minute}},
+			route:        "/messages/send",
+			calls:        2,
+			wantUpstream: 1,
+			wantErrors:   1,
+		},
+		{
+			name:         "calls waiting for the rate",
+			limits:       []RateLimit{{Rate: 20, Burst: 1, Wait: true}},
+			calls:        3,
+			wantUpstream: 3,
+			wantElapsed:  90 * time.Millisecond,
+		},
+		{
+			name:         "waiting calls rejected once the context is done",
+			limits:       []RateLimit{{Rate: 1, Interval: time.Minute, Wait: true}},
+			timeout:      50 * time.Millisecond,
+			calls:        2,
+			wantUpstream: 1,
+			wantErrors:   1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var upstream int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&upstream, 1)
+				_, _ = w.Write([]byte(`{}`))
+			}))
+			defer server.Close()
+
+			client := newTestClient(t, server.URL, HTTPClient{RateLimit: &RateLimitConfig{Limits: test.limits}})
+
+			start := time.Now()
+			rejected := 0
+			for i := 0; i < test.calls; i++ {
+				ctx := context.Background()
+				if test.timeout > 0 {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithTimeout(ctx, test.timeout)
+					defer cancel()
+				}
+				if test.route != "" {
+					ctx = WithCallOptions(ctx, WithRoute(test.route))
+				}
+
+				errDo := client.CallClient(ctx, "drugs", GET, nil, nil, false)
+				if !isFailure(errDo) {
+					continue
+				}
+				rejected++
+				if errDo.Code != CodeRateLimited || errDo.StatusCode != http.StatusTooManyRequests || !errors.Is(errDo.Err(), ErrRateLimited) {
+					t.Errorf("error = %+v, want rate limited", errDo)
+				}
+			}
+
+			if got := atomic.LoadInt32(&upstream); got != test.wantUpstream {
+				t.Errorf("upstream called %d times, want %d", got, test.wantUpstream)
+			}
+			if rejected != test.wantErrors {
+				t.Errorf("%d calls rejected, want %d", rejected, test.wantErrors)
+			}
+			if elapsed := time.Since(start); elapsed < test.wantElapsed {
+				t.Errorf("calls completed in %s, want at least %s", elapsed, test.wantElapsed)
+			}
+		})
+	}
+}
+
+func TestRateLimitMaxInFlight(t *testing.T) {
+	tests := []struct {
+		name    string
+		wait    bool
+		wantErr error
+	}{
+		{name: "call rejected while the slot is taken", wantErr: ErrRateLimited},
+		{name: "call waiting for the slot", wait: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entered := make(chan struct{}, 2)
+			release := make(chan struct{})
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				entered <- struct{}{}
+				<-release
+				_, _ = w.Write([]byte(`{}`))
+			}))
+			defer server.Close()
+
+			client := newTestClient(t, server.URL, HTTPClient{
+				RateLimit: &RateLimitConfig{Limits: []RateLimit{{MaxInFlight: 1, Wait: test.wait}}},
+			})
+
+			first := make(chan *ResponseError, 1)
+			go func() { first <- client.CallClient(context.Background(), "drugs", GET, nil, nil, false) }()
+			<-entered
+
+			second := make(chan *ResponseError, 1)
+			go func() { second <- client.CallClient(context.Background(), "drugs", GET, nil, nil, false) }()
+			if test.wait {
+				select {
+				case <-entered:
+					t.Fatalf("second call sent while the slot is taken")
+				case <-time.After(50 * time.Millisecond):
+				}
+			}
+			close(release)
+
+			if err := (<-first).Err(); err != nil {
+				t.Fatalf("first call error = %v", err)
+			}
+			if err := (<-second).Err(); !errors.Is(err, test.wantErr) {
+				t.Errorf("second call error = %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestRateLimitRetries(t *testing.T) {
+	var upstream int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&upstream, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := newTestClient(t, server.URL, HTTPClient{
+		RetryPolicy: &RetryPolicy{MaxRetries: 3, MinDelay: time.Millisecond, MaxDelay: time.Millisecond},
+		RateLimit:   &RateLimitConfig{Limits: []RateLimit{{Rate: 2, Interval: time.Minute}}},
+	})
+
+	// the retry beyond the rate is not sent, the last response is returned
+	errDo := client.CallClient(context.Background(), "drugs", GET, nil, nil, false)
+	if errDo == nil || errDo.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("error = %+v, want the 503 of the upstream", errDo)
+	}
+	if got := atomic.LoadInt32(&upstream); got != 2 {
+		t.Errorf("upstream called %d times, want 2", got)
+	}
+}
+
+func TestDistributedRateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	redisServer := miniredis.RunT(t)
+	newClient := func(limits ...RateLimit) *HTTPClient {
+		return NewHTTPClient(HTTPClient{
+			APIURL:     server.URL,
+			ClientName: "distributed-rate-limit",
+			Logging:    &LoggingConfig{Level: LogLevelOff},
+			RateLimit:  &RateLimitConfig{Limits: limits, Distributed: true},
+		}, redis.NewClient(&redis.Options{Addr: redisServer.Addr()}))
+	}
+
+	t.Run("rate shared between the replicas", func(t *testing.T) {
+		redisServer.FlushAll()
+		limit := RateLimit{Rate: 1, Interval: time.Minute}
+		replica1, replica2 := newClient(limit), newClient(limit)
+
+		if err := replica1.CallClient(context.Background(), "drugs", GET, nil, nil, false).Err(); err != nil {
+			t.Fatalf("first call error = %v", err)
+		}
+		if err := replica2.CallClient(context.Background(), "drugs", GET, nil, nil, false).Err(); !errors.Is(err, ErrRateLimited) {
+			t.Errorf("call of the other replica error = %v, want ErrRateLimited", err)
+		}
+	})
+
+	t.Run("token given back when another limit rejects the call", func(t *testing.T) {
+		redisServer.FlushAll()
+		client := newClient(
+			RateLimit{Route: "/*", Rate: 5, Interval: time.Minute},
+			RateLimit{Route: "/drugs", Rate: 1, Interval: time.Minute},
+		)
+
+		for i := 0; i < 3; i++ {
+			_ = client.CallClient(context.Background(), "drugs", GET, nil, nil, false)
+		}
+
+		tokens, err := strconv.ParseFloat(redisServer.HGet(DefaultRedisRateLimitPrefix+"distributed-rate-limit:/*:tokens", "tokens"), 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tokens < 4 || tokens >= 4.5 {
+			t.Errorf("tokens = %v, want the 4 left by the single call sent", tokens)
+		}
+	})
+
+	t.Run("in-flight calls shared between the replicas", func(t *testing.T) {
+		redisServer.FlushAll()
+		entered := make(chan struct{})
+		release := make(chan struct{})
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(entered)
+			<-release
+		}))
+		defer slow.Close()
+
+		limit := RateLimit{MaxInFlight: 1}
+		replica1, replica2 := newClient(limit), newClient(limit)
+
+		first := make(chan *ResponseError, 1)
+		go func() {
+			first <- replica1.CallClientWithBaseURLGiven(context.Background(), slow.URL, GET, nil, nil, false)
+		}()
+		<-entered
+
+		if err := replica2.CallClient(context.Background(), "drugs", GET, nil, nil, false).Err(); !errors.Is(err, ErrRateLimited) {
+			t.Errorf("call of the other replica error = %v, want ErrRateLimited", err)
+		}
+		close(release)
+		<-first
+
+		if err := replica2.CallClient(context.Background(), "drugs", GET, nil, nil, false).Err(); err != nil {
+			t.Errorf("call once released error = %v", err)
+		}
+	})
+
+	t.Run("local limits when redis fails", func(t *testing.T) {
+		logs := []logEntry{}
+		client := NewHTTPClient(HTTPClient{
+			APIURL:     server.URL,
+			ClientName: "distributed-rate-limit-down",
+			Logging:    &LoggingConfig{Logger: recordLogs(&logs)},
+			RateLimit:  &RateLimitConfig{Limits: []RateLimit{{Rate: 1, Interval: time.Minute}}, Distributed: true},
+		}, redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1}))
+
+		if err := client.CallClient(context.Background(), "drugs", GET, nil, nil, false).Err(); err != nil {
+			t.Fatalf("first call error = %v", err)
+		}
+		if err := client.CallClient(context.Background(), "drugs", GET, nil, nil, false).Err(); !errors.Is(err, ErrRateLimited) {
+			t.Errorf("second call error = %v, want ErrRateLimited", err)
+		}
+
+		warned := false
+		for _, entry := range logs {
+			warned = warned || entry.level == LogLevelWarn && entry.message == "Error taking distributed rate limit"
+		}
+		if !warned {
+			t.Errorf("redis failure not logged, logs = %+v", logs)
+		}
+	})
+}
@@ -0,0 +1,141 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// DefaultRedisCachePrefix is the prefix of the keys stored by the redis cache
+const DefaultRedisCachePrefix = "apicaching:"
+
+//
+// Private constants
+//
+
+const redisScanCount = 1000
+
+//
+// Private variables
+//
+
+var redisPatternReplacer = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+// RedisCache is the cache storing the responses in redis
+type RedisCache struct {
+	redisClient *redis.Client
+	prefix      string
+}
+
+// Get collects the value of the key from redis
+func (r *RedisCache) Get(ctx context.Context, key string) (string, error) {
+	val, err := r.redisClient.WithContext(ctx).Get(r.prefix + key).Result()
+	if err == redis.Nil {
+		return "", ErrCacheMiss
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return val, nil
+}
+
+// Set stores the value of the key in redis for the ttl duration
+func (r *RedisCache) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
+	return r.redisClient.WithContext(ctx).Set(r.prefix+key, value, ttl).Err()
+}
+
+// Delete removes the key from redis
+func (r *RedisCache) Delete(ctx context.Context, key string) error {
+	return r.redisClient.WithContext(ctx).Del(r.prefix + key).Err()
+}
+
+// DeletePrefix removes all the keys starting with the prefix, scanning redis in batches
+func (r *RedisCache) DeletePrefix(ctx context.Context, prefix string) error {
+	redisClient := r.redisClient.WithContext(ctx)
+	match := escapeRedisPattern(r.prefix+prefix) + "*"
+
+	var cursor uint64
+	for {
+		keys, nextCursor, err := redisClient.Scan(cursor, match, redisScanCount).Result()
+		if err != nil {
+			return err
+		}
+
+		if len(keys) > 0 {
+			if err = redisClient.Del(keys...).Err(); err != nil {
+				return err
+			}
+		}
+
+		cursor = nextCursor
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// AddTags adds the key to the redis sets of the tags, extending their expiration to the ttl of the key
+func (r *RedisCache) AddTags(ctx context.Context, key string, tags []string, ttl time.Duration) error {
+	redisClient := r.redisClient.WithContext(ctx)
+
+	for _, tag := range tags {
+		tagKey := r.tagKey(tag)
+		if err := redisClient.SAdd(tagKey, key).Err(); err != nil {
+			return err
+		}
+
+		current, err := redisClient.TTL(tagKey).Result()
+		if err != nil {
+			return err
+		}
+		if current < ttl {
+			if err = redisClient.Expire(tagKey, ttl).Err(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// DeleteTag removes all the keys of the redis set of the tag, and the set itself
+func (r *RedisCache) DeleteTag(ctx context.Context, tag string) error {
+	redisClient := r.redisClient.WithContext(ctx)
+	tagKey := r.tagKey(tag)
+
+	keys, err := redisClient.SMembers(tagKey).Result()
+	if err != nil {
+		return err
+	}
+
+	keysToDelete := []string{tagKey}
+	for _, key := range keys {
+		keysToDelete = append(keysToDelete, r.prefix+key)
+	}
+
+	return redisClient.Del(keysToDelete...).Err()
+}
+
+func (r *RedisCache) tagKey(tag string) string {
+	return r.prefix + "#tag:" + tag
+}
+
+// escapeRedisPattern escapes the glob characters of a redis SCAN pattern
+func escapeRedisPattern(pattern string) string {
+	return redisPatternReplacer.Replace(pattern)
+}
+
+// NewRedisCache creates a new redis cache, keys are prefixed by DefaultRedisCachePrefix when prefix is empty
+func NewRedisCache(redisClient *redis.Client, prefix string) *RedisCache {
+	if prefix == "" {
+		prefix = DefaultRedisCachePrefix
+	}
+
+	return &RedisCache{
+		redisClient: redisClient,
+		prefix:      prefix,
+	}
+}
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+)
+
+func TestRedisCache(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	cache := NewRedisCache(redis.NewClient(&redis.Options{Addr: server.Addr()}), "")
+
+	_ = cache.Set(ctx, "drugs:1", "1", time.Minute)
+	_ = cache.Set(ctx, "drugs:2", "2", time.Minute)
+	_ = cache.Set(ctx, "drugs*:3", "3", time.Minute)
+	_ = cache.Set(ctx, "users:1", "4", time.Second)
+	_ = cache.AddTags(ctx, "users:1", []string{"patient-1"}, time.Second)
+
+	if !server.Exists(DefaultRedisCachePrefix + "drugs:1") {
+		t.Fatalf("keys not stored with the default prefix, keys = %v", server.Keys())
+	}
+
+	tests := []struct {
+		name    string
+		key     string
+		want    string
+		wantErr error
+	}{
+		{name: "stored value", key: "drugs:2", want: "2"},
+		{name: "missing value", key: "drugs:4", wantErr: ErrCacheMiss},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := cache.Get(ctx, test.key)
+			if err != test.wantErr || got != test.want {
+				t.Errorf("Get(%q) = %q, %v, want %q, %v", test.key, got, err, test.want, test.wantErr)
+			}
+		})
+	}
+
+	t.Run("glob characters of the prefix escaped", func(t *testing.T) {
+		if err := cache.DeletePrefix(ctx, "drugs*"); err != nil {
+			t.Fatalf("DeletePrefix() error = %v", err)
+		}
+		if _, err := cache.Get(ctx, "drugs:1"); err != nil {
+			t.Errorf("Get(drugs:1) error = %v after deleting the prefix drugs*", err)
+		}
+		if _, err := cache.Get(ctx, "drugs*:3"); err != ErrCacheMiss {
+			t.Errorf("Get(drugs*:3) error = %v, want a cache miss", err)
+		}
+	})
+
+	t.Run("tag", func(t *testing.T) {
+		if err := cache.DeleteTag(ctx, "patient-1"); err != nil {
+			t.Fatalf("DeleteTag() error = %v", err)
+		}
+		if _, err := cache.Get(ctx, "users:1"); err != ErrCacheMiss {
+			t.Errorf("Get(users:1) error = %v, want a cache miss", err)
+		}
+	})
+
+	t.Run("expired value", func(t *testing.T) {
+		server.FastForward(2 * time.Minute)
+		if _, err := cache.Get(ctx, "drugs:1"); err != ErrCacheMiss {
+			t.Errorf("Get(drugs:1) error = %v, want a cache miss", err)
+		}
+	})
+
+	t.Run("redis failure", func(t *testing.T) {
+		server.Close()
+		if _, err := cache.Get(ctx, "drugs:1"); err == nil || err == ErrCacheMiss {
+			t.Errorf("Get() error = %v, want the redis error", err)
+		}
+	})
+}
@@ -0,0 +1,216 @@
+package client
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+//
+// Private constants
+//
+
+const defaultMinRetryDelay = 500 * time.Millisecond
+const defaultMaxRetryDelay = 5000 * time.Millisecond
+
+//
+// Private variables
+//
+
+var defaultRetryableStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+var defaultRetryableMethods = []Method{GET, PUT, DELETE, "HEAD", "OPTIONS"}
+
+// RetryPolicy represents the retry configuration of the client.
+//
+// Transport errors are retried for every method, while retryable status codes are only retried
+// for retryable methods or for requests carrying an Idempotency-Key header.
+// Zero values fall back to the defaults.
+type RetryPolicy struct {
+	// MaxRetries is the max number of retries, MaxNetworkRetries of the client is used when zero
+	MaxRetries int
+	// MinDelay is the min delay between two attempts, 500ms by default
+	MinDelay time.Duration
+	// MaxDelay is the max backoff delay between two attempts, 5s by default
+	MaxDelay time.Duration
+	// MaxElapsedTime stops retrying once the next attempt would start after it, unlimited when zero
+	MaxElapsedTime time.Duration
+	// RetryableStatusCodes are the response status codes to retry, 429, 502, 503 and 504 by default
+	RetryableStatusCodes []int
+	// RetryableMethods are the methods whose responses can be retried, idempotent methods by default
+	RetryableMethods []Method
+	// IgnoreRetryAfter disables waiting for the Retry-After header of the response,
+	// a Retry-After longer than the MaxDelay stops retrying
+	IgnoreRetryAfter bool
+}
+
+// retryPolicy returns the retry policy of the client with the defaults applied
+func (c *HTTPClient) retryPolicy() RetryPolicy {
+	policy := RetryPolicy{}
+	if c.RetryPolicy != nil {
+		policy = *c.RetryPolicy
+	}
+
+	if policy.MaxRetries == 0 {
+		policy.MaxRetries = c.MaxNetworkRetries
+	}
+	if policy.MinDelay == 0 {
+		policy.MinDelay = defaultMinRetryDelay
+	}
+	if policy.MaxDelay == 0 {
+		policy.MaxDelay = defaultMaxRetryDelay
+	}
+	if policy.RetryableStatusCodes == nil {
+		policy.RetryableStatusCodes = defaultRetryableStatusCodes
+	}
+	if policy.RetryableMethods == nil {
+		policy.RetryableMethods = defaultRetryableMethods
+	}
+
+	return policy
+}
+
+func (c *HTTPClient) shouldRetry(policy RetryPolicy, req *http.Request, err error, res *http.Response, retry int) bool {
+	if retry >= policy.MaxRetries {
+		return false
+	}
+
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+
+	if err != nil {
+		return req.Context().Err() == nil
+	}
+
+	if res == nil || !policy.isRetryableStatusCode(res.StatusCode) {
+		return false
+	}
+
+	return policy.isRetryableMethod(Method(req.Method)) || req.Header.Get(HeaderIdempotencyKey) != ""
+}
+
+// sleepTime returns the delay before the next attempt, and false when the Retry-After of the response
+// is longer than the MaxDelay of the policy so that the call gives up
+func (c *HTTPClient) sleepTime(policy RetryPolicy, numRetries int, res *http.Response) (time.Duration, bool) {
+	if c.UseNormalSleep {
+		return 0, true
+	}
+
+	if !policy.IgnoreRetryAfter && res != nil {
+		if delay, ok := retryAfter(res); ok {
+			return delay, delay <= policy.MaxDelay
+		}
+	}
+
+	// exponentially backoff by 2^numOfRetries
+	delay := policy.MinDelay + policy.MinDelay*time.Duration(1<<uint(numRetries))
+	if delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+
+	// generate random jitter to prevent thundering herd problem
+	if delay >= 4 {
+		jitter := rand.Int63n(int64(delay / 4))
+		delay -= time.Duration(jitter)
+	}
+
+	if delay < policy.MinDelay {
+		delay = policy.MinDelay
+	}
+
+	return delay, true
+}
+
+func (p RetryPolicy) isRetryableStatusCode(statusCode int) bool {
+	for _, code := range p.RetryableStatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p RetryPolicy) isRetryableMethod(method Method) bool {
+	for _, m := range p.RetryableMethods {
+		if m == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+// retryAfter parses the Retry-After header, given either in seconds or as http date
+func retryAfter(res *http.Response) (time.Duration, bool) {
+	value := res.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		delay := time.Until(date)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+
+	return 0, false
+}
+
+// rewindBody resets the body of the request so it can be sent again
+func rewindBody(req *http.Request) error {
+	if req.GetBody == nil {
+		return nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return err
+	}
+	req.Body = body
+
+	return nil
+}
+
+// discardBody drains and closes the body of a response which will not be read
+func discardBody(res *http.Response) {
+	if res == nil || res.Body == nil {
+		return
+	}
+
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+}
+
+// sleep waits for the given duration and returns the context error when it is done before
+func sleep(ctx context.Context, duration time.Duration) error {
+	if duration <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,149 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       Method
+		statuses     []int
+		retryAfter   string
+		policy       RetryPolicy
+		wantAttempts int32
+		wantStatus   int
+	}{
+		{
+			name:         "retryable status retried until success",
+			method:       GET,
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK},
+			policy:       RetryPolicy{MaxRetries: 3},
+			wantAttempts: 3,
+			wantStatus:   http.StatusOK,
+		},
+		{
+			name:         "retries exhausted",
+			method:       GET,
+			statuses:     []int{http.StatusServiceUnavailable},
+			policy:       RetryPolicy{MaxRetries: 2},
+			wantAttempts: 3,
+			wantStatus:   http.StatusServiceUnavailable,
+		},
+		{
+			name:         "non retryable status",
+			method:       GET,
+			statuses:     []int{http.StatusBadRequest, http.StatusOK},
+			policy:       RetryPolicy{MaxRetries: 3},
+			wantAttempts: 1,
+			wantStatus:   http.StatusBadRequest,
+		},
+		{
+			name:         "non idempotent method",
+			method:       POST,
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusOK},
+			policy:       RetryPolicy{MaxRetries: 3},
+			wantAttempts: 1,
+			wantStatus:   http.StatusServiceUnavailable,
+		},
+		{
+			name:         "custom retryable status",
+			method:       GET,
+			statuses:     []int{http.StatusInternalServerError, http.StatusOK},
+			policy:       RetryPolicy{MaxRetries: 1, RetryableStatusCodes: []int{http.StatusInternalServerError}},
+			wantAttempts: 2,
+			wantStatus:   http.StatusOK,
+		},
+		{
+			name:         "retry after within the max delay",
+			method:       GET,
+			statuses:     []int{http.StatusTooManyRequests, http.StatusOK},
+			retryAfter:   "0",
+			policy:       RetryPolicy{MaxRetries: 1},
+			wantAttempts: 2,
+			wantStatus:   http.StatusOK,
+		},
+		{
+			name:         "retry after longer than the max delay",
+			method:       GET,
+			statuses:     []int{http.StatusTooManyRequests, http.StatusOK},
+			retryAfter:   "60",
+			policy:       RetryPolicy{MaxRetries: 1},
+			wantAttempts: 1,
+			wantStatus:   http.StatusTooManyRequests,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var attempts int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempt := int(atomic.AddInt32(&attempts, 1))
+				status := test.statuses[len(test.statuses)-1]
+				if attempt <= len(test.statuses) {
+					status = test.statuses[attempt-1]
+				}
+				if test.retryAfter != "" {
+					w.Header().Set("Retry-After", test.retryAfter)
+				}
+				w.WriteHeader(status)
+				_, _ = w.Write([]byte("{}"))
+			}))
+			defer server.Close()
+
+			policy := test.policy
+			policy.MinDelay = time.Millisecond
+			policy.MaxDelay = 10 * time.Millisecond
+			client := newTestClient(t, server.URL, HTTPClient{RetryPolicy: &policy})
+
+			call := &Call{Method: test.method, URL: server.URL + "/items"}
+			errDo := client.Execute(context.Background(), call)
+
+			if got := atomic.LoadInt32(&attempts); got != test.wantAttempts {
+				t.Errorf("upstream called %d times, want %d", got, test.wantAttempts)
+			}
+			if call.Attempts != int(test.wantAttempts) {
+				t.Errorf("call.Attempts = %d, want %d", call.Attempts, test.wantAttempts)
+			}
+			if call.StatusCode != test.wantStatus {
+				t.Errorf("status = %d, want %d", call.StatusCode, test.wantStatus)
+			}
+			if failed := errDo.Err() != nil; failed != (test.wantStatus >= 300) {
+				t.Errorf("error = %v for the status %d", errDo.Err(), test.wantStatus)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Duration
+		wantOk bool
+	}{
+		{name: "seconds", value: "3", want: 3 * time.Second, wantOk: true},
+		{name: "past date", value: "Mon, 02 Jan 2006 15:04:05 GMT", want: 0, wantOk: true},
+		{name: "missing", value: ""},
+		{name: "invalid", value: "soon"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := &http.Response{Header: http.Header{}}
+			if test.value != "" {
+				res.Header.Set("Retry-After", test.value)
+			}
+
+			got, ok := retryAfter(res)
+			if got != test.want || ok != test.wantOk {
+				t.Errorf("retryAfter(%q) = %s, %v, want %s, %v", test.value, got, ok, test.want, test.wantOk)
+			}
+		})
+	}
+}
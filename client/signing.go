@@ -0,0 +1,60 @@
+package client
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// transmit signs the request with the signer of the client when given, and sends it.
+// Each attempt is signed again so that its nonce and timestamp are never replayed.
+func (c *HTTPClient) transmit(req *http.Request) (*http.Response, error) {
+	if c.Signer != nil {
+		body, err := requestBody(req)
+		if err != nil {
+			return nil, err
+		}
+		c.Signer.Sign(req, body)
+	}
+
+	return c.HTTPClient.Do(req)
+}
+
+// requestBody returns the payload of the request without consuming it,
+// a body which cannot be read again is buffered and made rewindable
+func requestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	if req.GetBody == nil {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+		req.Body, _ = req.GetBody()
+		return body, nil
+	}
+
+	reader, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// the body is reset in case the reader of GetBody is the one of the request
+	if req.Body, err = req.GetBody(); err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
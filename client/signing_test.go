@@ -0,0 +1,62 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/medicplus-inc/medicplus-kit/net/authentication/signature"
+)
+
+func TestSigning(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       Method
+		request      interface{}
+		statuses     []int
+		wantAttempts int
+	}{
+		{name: "signed call", method: POST, request: map[string]string{"name": "aspirin"}, statuses: []int{http.StatusOK}, wantAttempts: 1},
+		{name: "call without body", method: GET, statuses: []int{http.StatusOK}, wantAttempts: 1},
+		{name: "retry signed again", method: PUT, request: map[string]string{"name": "aspirin"}, statuses: []int{http.StatusServiceUnavailable, http.StatusOK}, wantAttempts: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// the nonce store rejects a retry sent with the signature of the previous attempt
+			verifier := signature.NewVerifier(signature.VerifierConfig{
+				Keys:   signature.StaticKeyStore{"service-1": []byte("secret-1")},
+				Nonces: signature.NewMemoryNonceStore(),
+			})
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := verifier.ReadBody(w, r)
+				if err == nil {
+					err = verifier.Verify(r, body)
+				}
+				if err != nil {
+					t.Errorf("attempt %d: %v", attempts, err)
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				w.WriteHeader(test.statuses[attempts])
+				attempts++
+			}))
+			defer server.Close()
+
+			client := newTestClient(t, server.URL, HTTPClient{
+				Signer:      signature.NewSigner("service-1", []byte("secret-1")),
+				RetryPolicy: &RetryPolicy{MaxRetries: 1, MinDelay: time.Millisecond, MaxDelay: time.Millisecond},
+			})
+
+			if errDo := client.CallClient(context.Background(), "drugs?page=2", test.method, test.request, nil, false); errDo.Err() != nil {
+				t.Fatalf("error = %v", errDo.Err())
+			}
+			if attempts != test.wantAttempts {
+				t.Errorf("upstream verified %d attempts, want %d", attempts, test.wantAttempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package client
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+//
+// Private constants
+//
+
+const defaultCachingLockTimeout = 5 * time.Second
+const cachingLockPollInterval = 50 * time.Millisecond
+const cachingLockPrefix = "apicaching-lock:"
+
+// releaseCachingLockScript deletes the lock only when it is still owned by the caller
+const releaseCachingLockScript = `
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0
+`
+
+// StampedeProtection represents the protection of the cached calls against cache stampede.
+//
+// Identical calls missing the cache at the same time are coalesced into a single upstream call per client.
+type StampedeProtection struct {
+	// DistributedLock coordinates the replicas with a redis lock so only one of them refreshes an entry,
+	// it requires the redis client given to NewHTTPClient
+	DistributedLock bool
+	// LockTimeout is the expiration of the lock and the max duration waiting for another replica, 5s by default
+	LockTimeout time.Duration
+	// EarlyRefreshBeta enables the probabilistic early refresh of the entries before their expiration,
+	// 1 is the usual value and greater values refresh earlier
+	EarlyRefreshBeta float64
+	// StaleWhileRevalidate serves the expired entries for this duration while they are refreshed in background
+	StaleWhileRevalidate time.Duration
+}
+
+// fetchedResponse represents the response shared between coalesced calls
+type fetchedResponse struct {
+	response   string
+	statusCode int
+	header     http.Header
+	attempts   int
+	errDo      *ResponseError
+}
+
+// shouldRefreshEarly decides whether a fresh entry is refreshed now, following the XFetch algorithm
+func (r *cachedResponse) shouldRefreshEarly(beta float64) bool {
+	if beta <= 0 || r.Delta <= 0 {
+		return false
+	}
+
+	gap := time.Duration(float64(r.Delta) * beta * -math.Log(rand.Float64()))
+	return time.Now().Add(gap).After(r.ExpiredAt)
+}
+
+// coalesce shares a single upstream call between the identical calls running at the same time.
+// The shared call runs detached from the context of the first caller, with the timeout of the call,
+// so that the other callers do not fail when the first one is canceled; every caller waits on its own context.
+func (c *HTTPClient) coalesce(ctx context.Context, caller string, cache Cache, key string, ttl time.Duration, next Handler, call *Call) *ResponseError {
+	// the clients not created by NewHTTPClient have no flight group to share the calls
+	if c.cachingFlights == nil {
+		return c.fetchAndStore(ctx, caller, cache, key, ttl, next, call)
+	}
+
+	fetch := detachedCall(call)
+	flight := c.cachingFlights.DoChan(key, func() (interface{}, error) {
+		fetchCtx, cancel := context.WithTimeout(detachedContext{ctx}, fetchTimeout(call))
+		defer cancel()
+
+		errDo := c.fetchAndStore(fetchCtx, caller, cache, key, ttl, next, fetch)
+		return &fetchedResponse{
+			response:   fetch.Response,
+			statusCode: fetch.StatusCode,
+			header:     fetch.ResponseHeader,
+			attempts:   fetch.Attempts,
+			errDo:      errDo,
+		}, nil
+	})
+
+	var fetched *fetchedResponse
+	select {
+	case <-ctx.Done():
+		return &ResponseError{
+			Error: ctx.Err(),
+		}
+	case result := <-flight:
+		fetched = result.Val.(*fetchedResponse)
+	}
+
+	call.Response = fetched.response
+	call.StatusCode = fetched.statusCode
+	call.ResponseHeader = fetched.header
+	call.Attempts = fetched.attempts
+	if isFailure(fetched.errDo) {
+		return fetched.errDo
+	}
+	if err := call.decode(); err != nil {
+		return &ResponseError{
+			Error: err,
+		}
+	}
+
+	return fetched.errDo
+}
+
+// refreshInBackground refreshes the entry without blocking the call, at most once at a time per key,
+// bounded by the timeout of the call
+func (c *HTTPClient) refreshInBackground(ctx context.Context, caller string, cache Cache, key string, ttl time.Duration, next Handler, call *Call) {
+	if c.cachingFlights == nil {
+		return
+	}
+
+	refresh := detachedCall(call)
+	c.cachingFlights.DoChan(key, func() (interface{}, error) {
+		refreshCtx, cancel := context.WithTimeout(detachedContext{ctx}, fetchTimeout(call))
+		defer cancel()
+
+		errDo := c.fetchAndStore(refreshCtx, caller, cache, key, ttl, next, refresh)
+		return &fetchedResponse{
+			response:   refresh.Response,
+			statusCode: refresh.StatusCode,
+			header:     refresh.ResponseHeader,
+			attempts:   refresh.Attempts,
+			errDo:      errDo,
+		}, nil
+	})
+}
+
+// fetchTimeout returns the max duration of an upstream call detached from its caller,
+// the timeout of the call or the default timeout of the http client
+func fetchTimeout(call *Call) time.Duration {
+	if call.options.timeout > 0 {
+		return call.options.timeout
+	}
+
+	return defaultHTTPTimeout
+}
+
+// detachedCall copies the call for an upstream call outliving its caller, without the result and the metadata
+// of the caller which are only written by the caller itself
+func detachedCall(call *Call) *Call {
+	detached := *call
+	detached.Header = call.Header.Clone()
+	detached.Result = nil
+	detached.Response = ""
+	detached.Metadata = nil
+	detached.options.metadata = nil
+
+	return &detached
+}
+
+// acquireCachingLock takes the redis lock of the key, or waits for the replica holding it to store a fresh entry.
+// The lock is skipped when redis is unavailable so the caching never fails because of it.
+func (c *HTTPClient) acquireCachingLock(ctx context.Context, caller string, cache Cache, key string, ttl time.Duration) (func(), *cachedResponse) {
+	release := func() {}
+
+	protection := c.StampedeProtection
+	if protection == nil || !protection.DistributedLock || c.redisClient == nil {
+		return release, nil
+	}
+
+	lockTimeout := protection.LockTimeout
+	if lockTimeout == 0 {
+		lockTimeout = defaultCachingLockTimeout
+	}
+
+	lockKey := cachingLockPrefix + key
+	token := uuid.New().String()
+	acquired, err := c.redisClient.WithContext(ctx).SetNX(lockKey, token, lockTimeout).Result()
+	if err != nil {
+		c.log(ctx, LogLevelWarn, "Error acquiring caching lock", LogFields{"client": c.ClientName, "key": lockKey, "error": err})
+		return release, nil
+	}
+
+	if acquired {
+		return func() {
+			if err := c.redisClient.Eval(releaseCachingLockScript, []string{lockKey}, token).Err(); err != nil {
+				c.log(ctx, LogLevelWarn, "Error releasing caching lock", LogFields{"client": c.ClientName, "key": lockKey, "error": err})
+			}
+		}, nil
+	}
+
+	deadline := time.Now().Add(lockTimeout)
+	for time.Now().Before(deadline) {
+		if sleep(ctx, cachingLockPollInterval) != nil {
+			break
+		}
+
+		if cached := c.loadCachedResponse(ctx, caller, cache, key, ttl); cached != nil && cached.isFresh() {
+			return release, cached
+		}
+	}
+
+	return release, nil
+}
+
+// detachedContext keeps the values of its parent without its cancellation, for the background refreshes
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
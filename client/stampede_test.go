@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStampedeProtection(t *testing.T) {
+	tests := []struct {
+		name         string
+		clients      int
+		calls        int
+		protection   *StampedeProtection
+		wantUpstream int32
+	}{
+		{
+			name:         "concurrent calls coalesced",
+			clients:      1,
+			calls:        5,
+			protection:   &StampedeProtection{},
+			wantUpstream: 1,
+		},
+		{
+			name:         "calls not coalesced without protection",
+			clients:      1,
+			calls:        3,
+			wantUpstream: 3,
+		},
+		{
+			name:         "clients of the same name not sharing their calls",
+			clients:      2,
+			calls:        2,
+			protection:   &StampedeProtection{},
+			wantUpstream: 2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var upstream int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&upstream, 1)
+				time.Sleep(100 * time.Millisecond)
+				_, _ = w.Write([]byte(`{"name":"aspirin"}`))
+			}))
+			defer server.Close()
+
+			wg := sync.WaitGroup{}
+			for i := 0; i < test.clients; i++ {
+				client := newTestClient(t, server.URL, HTTPClient{Cache: NewLRUCache(10, 0), StampedeProtection: test.protection})
+				for j := 0; j < test.calls; j++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						result := map[string]interface{}{}
+						errDo := client.CallClientWithCachingInRedis(context.Background(), 60, "drugs", GET, nil, &result, false)
+						if errDo.Err() != nil || result["name"] != "aspirin" {
+							t.Errorf("result = %v, error = %v", result, errDo.Err())
+						}
+					}()
+				}
+			}
+			wg.Wait()
+
+			if got := atomic.LoadInt32(&upstream); got != test.wantUpstream {
+				t.Errorf("upstream called %d times, want %d", got, test.wantUpstream)
+			}
+		})
+	}
+}
+
+func TestRefreshInBackground(t *testing.T) {
+	var stale int32
+	canceled := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&stale) == 1 {
+			<-r.Context().Done()
+			close(canceled)
+			return
+		}
+		_, _ = w.Write([]byte(`{"name":"aspirin"}`))
+	}))
+	defer server.Close()
+
+	cache := NewLRUCache(10, 0)
+	client := newTestClient(t, server.URL, HTTPClient{Cache: cache, StampedeProtection: &StampedeProtection{StaleWhileRevalidate: time.Minute}})
+
+	result := map[string]interface{}{}
+	if errDo := client.CallClientWithCachingInRedis(context.Background(), 60, "drugs", GET, nil, &result, false); errDo.Err() != nil {
+		t.Fatalf("first call error = %v", errDo.Err())
+	}
+
+	// expire the stored entry, still within the stale while revalidate window
+	ctx := context.Background()
+	for key := range cache.items {
+		val, _ := cache.Get(ctx, key)
+		cached := cachedResponse{}
+		if err := json.Unmarshal([]byte(val), &cached); err != nil {
+			t.Fatalf("stored entry %q: %v", val, err)
+		}
+		cached.ExpiredAt = time.Now().Add(-time.Second)
+		expired, _ := json.Marshal(&cached)
+		_ = cache.Set(ctx, key, string(expired), time.Minute)
+	}
+	atomic.StoreInt32(&stale, 1)
+
+	result = map[string]interface{}{}
+	errDo := client.CallClientWithCachingInRedis(WithCallOptions(ctx, WithTimeout(50*time.Millisecond)), 60, "drugs", GET, nil, &result, false)
+	if errDo.Err() != nil || result["name"] != "aspirin" {
+		t.Fatalf("stale call result = %v, error = %v", result, errDo.Err())
+	}
+
+	select {
+	case <-canceled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("background refresh not canceled after the timeout of the call")
+	}
+}
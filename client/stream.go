@@ -0,0 +1,239 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// StreamResponse represents the unread response of a streaming call, its body must be closed by the caller
+type StreamResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       io.ReadCloser
+}
+
+// Read reads the body of the response
+func (r *StreamResponse) Read(p []byte) (int, error) {
+	return r.Body.Read(p)
+}
+
+// Close closes the body of the response
+func (r *StreamResponse) Close() error {
+	return r.Body.Close()
+}
+
+// Stream sends the body as it is read and returns the response without reading it, for the large payloads.
+//
+// The request is retried like the other calls when the body is replayable: a *bytes.Reader, *strings.Reader,
+// *bytes.Buffer or another io.ReadSeeker such as *os.File, sent from its current offset (the seekers without ReadAt
+// are buffered in memory). Other readers are sent once.
+// A response which is not 2xx is read and returned as response error like the other calls.
+// The caller must close the returned response, the timeout given with WithTimeout lasting until then.
+// Note that the bodies of the signed requests are read in memory to compute their digest.
+func (c *HTTPClient) Stream(ctx context.Context, path string, method Method, contentType string, body io.Reader, opts ...CallOption) (*StreamResponse, *ResponseError) {
+	urlPath, errDo := c.buildURL(path)
+	if errDo != nil {
+		return nil, errDo
+	}
+
+	if contentType == "" && body != nil {
+		contentType = "application/octet-stream"
+	}
+	call := &Call{
+		Method:     method,
+		URL:        urlPath,
+		Header:     http.Header{},
+		BodyReader: body,
+		streaming:  true,
+	}
+	if contentType != "" {
+		call.Header.Set("Content-Type", contentType)
+	}
+
+	errDo = c.Execute(ctx, call, opts...)
+	if isFailure(errDo) {
+		if call.ResponseBody != nil {
+			call.ResponseBody.Close()
+		}
+		return nil, errDo
+	}
+
+	// a middleware may have served the call without sending it
+	if call.ResponseBody == nil {
+		call.ResponseBody = ioutil.NopCloser(strings.NewReader(call.Response))
+	}
+
+	return &StreamResponse{
+		StatusCode: call.StatusCode,
+		Header:     call.ResponseHeader,
+		Body:       call.ResponseBody,
+	}, errDo
+}
+
+// DecodeStream streams the response of the call and decodes its json values one by one with handle,
+// without holding the whole response in memory.
+//
+// The response can be NDJSON, concatenated json values, or a json array whose elements are decoded one by one.
+// A failed call is returned as a *CallError, while the error of handle stops the decoding and is returned as is.
+func DecodeStream[T any](ctx context.Context, c StreamingHTTPClient, path string, method Method, contentType string, body io.Reader, handle func(T) error, opts ...CallOption) error {
+	res, errDo := c.Stream(ctx, path, method, contentType, body, opts...)
+	if err := errDo.Err(); err != nil {
+		return err
+	}
+	defer res.Close()
+
+	reader := bufio.NewReader(res)
+	isArray, err := startsWithArray(reader)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(reader)
+	if isArray {
+		if _, err = decoder.Token(); err != nil {
+			return err
+		}
+	}
+
+	for {
+		if isArray && !decoder.More() {
+			// consumes the closing bracket, failing when the array is truncated
+			_, err = decoder.Token()
+			return err
+		}
+
+		var value T
+		if err = decoder.Decode(&value); err != nil {
+			if err == io.EOF && !isArray {
+				return nil
+			}
+			return err
+		}
+
+		if err = handle(value); err != nil {
+			return err
+		}
+	}
+}
+
+// newRequest builds the http request of the call.
+// A replayable body reader is sent from the same offset on every send, so that the request can be retried.
+func (call *Call) newRequest(ctx context.Context) (*http.Request, error) {
+	if call.BodyReader == nil {
+		return http.NewRequestWithContext(ctx, string(call.Method), call.URL, bytes.NewBuffer(call.Body))
+	}
+
+	if buffer, ok := call.BodyReader.(*bytes.Buffer); ok {
+		call.BodyReader = bytes.NewReader(buffer.Bytes())
+	}
+
+	seeker, ok := call.BodyReader.(io.ReadSeeker)
+	if !ok {
+		if call.bodySent {
+			return nil, errors.New("the request stream was already sent and cannot be sent again")
+		}
+		call.bodySent = true
+
+		return http.NewRequestWithContext(ctx, string(call.Method), call.URL, call.BodyReader)
+	}
+
+	if !call.bodySent {
+		offset, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		call.bodyOffset = offset
+		call.bodySent = true
+	}
+
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = seeker.Seek(call.bodyOffset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	length := end - call.bodyOffset
+
+	// every send reads its own section of the reader, so that a transport still reading the body of a previous
+	// send, or the signing of the request, never moves the reader of another one; the readers without ReadAt
+	// are buffered from the offset once
+	readerAt, ok := seeker.(io.ReaderAt)
+	if !ok {
+		body, err := ioutil.ReadAll(seeker)
+		if err != nil {
+			return nil, err
+		}
+		buffered := bytes.NewReader(body)
+		readerAt = buffered
+		call.BodyReader = buffered
+		call.bodyOffset = 0
+		length = int64(len(body))
+	}
+	offset := call.bodyOffset
+	getBody := func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(io.NewSectionReader(readerAt, offset, length)), nil
+	}
+
+	body, _ := getBody()
+	req, err := http.NewRequestWithContext(ctx, string(call.Method), call.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = length
+	if req.ContentLength == 0 {
+		req.Body = http.NoBody
+	}
+	req.GetBody = getBody
+
+	return req, nil
+}
+
+// replayable reports whether the request of the call can be sent again
+func (call *Call) replayable() bool {
+	switch call.BodyReader.(type) {
+	case nil, io.Seeker, *bytes.Buffer:
+		return true
+	}
+
+	return false
+}
+
+// cancelOnClose cancels the context of a streaming call once its response body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the body and cancels the context
+func (c *cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+// startsWithArray reports whether the first json value of the reader is an array, without consuming it
+func startsWithArray(reader *bufio.Reader) (bool, error) {
+	for {
+		next, err := reader.Peek(1)
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		switch next[0] {
+		case ' ', '\t', '\r', '\n':
+			reader.ReadByte()
+		default:
+			return next[0] == '[', nil
+		}
+	}
+}
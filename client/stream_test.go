@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/medicplus-inc/medicplus-kit/net/authentication/signature"
+)
+
+// seekOnly hides the ReadAt of its reader
+type seekOnly struct {
+	io.ReadSeeker
+}
+
+func TestStreamSignedSeekableBody(t *testing.T) {
+	const payload = "0123456789abcdefghij"
+	secret := []byte("secret")
+	verifier := signature.NewVerifier(signature.VerifierConfig{Keys: signature.StaticKeyStore{"key": secret}})
+
+	file, err := os.Create(filepath.Join(t.TempDir(), "payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err = file.WriteString(payload); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		body func() io.Reader
+		want string
+	}{
+		{
+			name: "file from its offset",
+			body: func() io.Reader {
+				if _, err := file.Seek(5, io.SeekStart); err != nil {
+					t.Fatal(err)
+				}
+				return file
+			},
+			want: payload[5:],
+		},
+		{
+			name: "seeker without ReadAt",
+			body: func() io.Reader {
+				reader := strings.NewReader(payload)
+				_, _ = reader.Seek(3, io.SeekStart)
+				return seekOnly{reader}
+			},
+			want: payload[3:],
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var attempts int32
+			received := make(chan string, 2)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := ioutil.ReadAll(r.Body)
+				if err != nil {
+					t.Error(err)
+				}
+				if err = verifier.Verify(r, body); err != nil {
+					t.Errorf("invalid signature: %v", err)
+				}
+				if r.ContentLength != int64(len(body)) {
+					t.Errorf("content length %d for a body of %d bytes", r.ContentLength, len(body))
+				}
+				received <- string(body)
+
+				// the first attempt fails so that the body is sent again
+				if atomic.AddInt32(&attempts, 1) == 1 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				_, _ = w.Write([]byte("{}"))
+			}))
+			defer server.Close()
+
+			client := NewHTTPClient(HTTPClient{
+				APIURL:            server.URL,
+				ClientName:        "stream",
+				MaxNetworkRetries: 1,
+				UseNormalSleep:    true,
+				Signer:            signature.NewSigner("key", secret),
+				Logging:           &LoggingConfig{Level: LogLevelOff},
+			}, nil)
+
+			res, errDo := client.Stream(context.Background(), "upload", PUT, "", test.body())
+			if isFailure(errDo) {
+				t.Fatalf("stream failed: %v", errDo.Error)
+			}
+			res.Close()
+
+			for attempt := 1; attempt <= 2; attempt++ {
+				if got := <-received; got != test.want {
+					t.Errorf("attempt %d received %q, want %q", attempt, got, test.want)
+				}
+			}
+		})
+	}
+}
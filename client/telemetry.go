@@ -0,0 +1,212 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//
+// Private constants
+//
+
+const instrumentationName = "github.com/medicplus-inc/medicplus-kit/client"
+
+const clientNameKey = attribute.Key("client.name")
+const statusClassKey = attribute.Key("http.status_class")
+const cacheTypeKey = attribute.Key("cache.type")
+
+// TelemetryConfig represents the OpenTelemetry instrumentation of the client, zero values fall back to the defaults.
+//
+// Each call creates a span, with a child client span per attempt whose context is injected into the request headers,
+// and records the metrics:
+//   - client.requests: count of the calls by client name, method, route and status class
+//   - client.duration: duration of the calls in seconds, with the same attributes
+//   - client.retries: count of the retried attempts by client name and method
+//   - client.cache.hits and client.cache.misses: count of the cache lookups by client name and cache type
+type TelemetryConfig struct {
+	// TracerProvider creates the spans, the global provider by default
+	TracerProvider trace.TracerProvider
+	// MeterProvider creates the metrics, the global provider by default
+	MeterProvider metric.MeterProvider
+	// Propagator injects the span context into the requests, W3C trace context by default
+	Propagator propagation.TextMapPropagator
+}
+
+// instrumentation represents the tracer and the instruments of the client
+type instrumentation struct {
+	tracer      trace.Tracer
+	propagator  propagation.TextMapPropagator
+	requests    metric.Int64Counter
+	duration    metric.Float64Histogram
+	retries     metric.Int64Counter
+	cacheHits   metric.Int64Counter
+	cacheMisses metric.Int64Counter
+}
+
+// newInstrumentation creates the tracer and the instruments of the telemetry config,
+// the instruments failing to be created are reported to the otel error handler and record nothing
+func newInstrumentation(config TelemetryConfig) *instrumentation {
+	if config.TracerProvider == nil {
+		config.TracerProvider = otel.GetTracerProvider()
+	}
+	if config.MeterProvider == nil {
+		config.MeterProvider = otel.GetMeterProvider()
+	}
+	if config.Propagator == nil {
+		config.Propagator = propagation.TraceContext{}
+	}
+
+	meter := config.MeterProvider.Meter(instrumentationName)
+	requests, errRequests := meter.Int64Counter("client.requests",
+		metric.WithDescription("Number of client calls"), metric.WithUnit("{call}"))
+	duration, errDuration := meter.Float64Histogram("client.duration",
+		metric.WithDescription("Duration of client calls"), metric.WithUnit("s"))
+	retries, errRetries := meter.Int64Counter("client.retries",
+		metric.WithDescription("Number of retried attempts"), metric.WithUnit("{attempt}"))
+	cacheHits, errCacheHits := meter.Int64Counter("client.cache.hits",
+		metric.WithDescription("Number of calls served from the cache"), metric.WithUnit("{call}"))
+	cacheMisses, errCacheMisses := meter.Int64Counter("client.cache.misses",
+		metric.WithDescription("Number of calls missing the cache"), metric.WithUnit("{call}"))
+	if err := errors.Join(errRequests, errDuration, errRetries, errCacheHits, errCacheMisses); err != nil {
+		otel.Handle(err)
+	}
+
+	return &instrumentation{
+		tracer:      config.TracerProvider.Tracer(instrumentationName),
+		propagator:  config.Propagator,
+		requests:    requests,
+		duration:    duration,
+		retries:     retries,
+		cacheHits:   cacheHits,
+		cacheMisses: cacheMisses,
+	}
+}
+
+// route returns the route template of the call given with WithRoute,
+// or its path relative to the api url of the client without the query
+func (c *HTTPClient) route(call *Call) string {
+	if call.options.route != "" {
+		return call.options.route
+	}
+
+	path := strings.TrimPrefix(call.URL, c.APIURL)
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		path = path[:i]
+	}
+
+	return "/" + strings.TrimPrefix(path, "/")
+}
+
+// tracing creates the span of the call and records its metrics
+func (c *HTTPClient) tracing() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) *ResponseError {
+			redactedURL := redactURL(call.URL, c.redactedQueryParams(c.loggingConfig()))
+			attributes := []attribute.KeyValue{
+				clientNameKey.String(c.ClientName),
+				semconv.HTTPMethod(string(call.Method)),
+				semconv.HTTPRoute(c.route(call)),
+			}
+
+			ctx, span := c.instrumentation.tracer.Start(ctx, string(call.Method)+" "+c.route(call),
+				trace.WithAttributes(attributes...),
+				trace.WithAttributes(semconv.URLFull(redactedURL)),
+			)
+			defer span.End()
+
+			start := time.Now()
+			errDo := next(ctx, call)
+
+			if call.StatusCode != 0 {
+				span.SetAttributes(semconv.HTTPStatusCode(call.StatusCode))
+			}
+			if isFailure(errDo) {
+				span.SetStatus(codes.Error, errDo.Message)
+				if errDo.Error != nil {
+					span.RecordError(errors.New(redactURLs(errDo.Error.Error(), call.URL, redactedURL)))
+				}
+			}
+
+			measurement := metric.WithAttributes(append(attributes, statusClassKey.String(statusClass(call.StatusCode, errDo)))...)
+			c.instrumentation.requests.Add(ctx, 1, measurement)
+			c.instrumentation.duration.Record(ctx, time.Since(start).Seconds(), measurement)
+
+			return errDo
+		}
+	}
+}
+
+// sendAttempt sends a single attempt of the request, inside its client span when the telemetry is enabled
+func (c *HTTPClient) sendAttempt(req *http.Request, retry int) (*http.Response, error) {
+	if c.instrumentation == nil {
+		return c.transmit(req)
+	}
+
+	attributes := []attribute.KeyValue{
+		clientNameKey.String(c.ClientName),
+		semconv.HTTPMethod(req.Method),
+	}
+	if retry > 0 {
+		attributes = append(attributes, semconv.HTTPResendCount(retry))
+		c.instrumentation.retries.Add(req.Context(), 1, metric.WithAttributes(attributes[:2]...))
+	}
+
+	ctx, span := c.instrumentation.tracer.Start(req.Context(), "HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attributes...),
+	)
+	defer span.End()
+
+	c.instrumentation.propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	res, err := c.transmit(req)
+	if err != nil {
+		span.SetStatus(codes.Error, "transport error")
+		return res, err
+	}
+
+	span.SetAttributes(semconv.HTTPStatusCode(res.StatusCode))
+	if res.StatusCode >= 400 {
+		span.SetStatus(codes.Error, http.StatusText(res.StatusCode))
+	}
+
+	return res, err
+}
+
+// recordCacheLookup counts the hit or the miss of the cache lookup when the telemetry is enabled
+func (c *HTTPClient) recordCacheLookup(ctx context.Context, cacheType string, hit bool) {
+	if c.instrumentation == nil {
+		return
+	}
+
+	measurement := metric.WithAttributes(clientNameKey.String(c.ClientName), cacheTypeKey.String(cacheType))
+	if hit {
+		c.instrumentation.cacheHits.Add(ctx, 1, measurement)
+		return
+	}
+	c.instrumentation.cacheMisses.Add(ctx, 1, measurement)
+}
+
+// statusClass returns the class of the status code, e.g. "2xx", or "error" when the call failed without response
+func statusClass(statusCode int, errDo *ResponseError) string {
+	if statusCode == 0 {
+		if isFailure(errDo) {
+			return "error"
+		}
+		return "2xx"
+	}
+
+	return strconv.Itoa(statusCode/100) + "xx"
+}
@@ -0,0 +1,150 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// counts returns the sums of the int64 counters collected by the reader, by metric name and attribute value when present
+func counts(t *testing.T, reader sdkmetric.Reader, key attribute.Key) map[string]int64 {
+	t.Helper()
+
+	collected := metricdata.ResourceMetrics{}
+	if err := reader.Collect(context.Background(), &collected); err != nil {
+		t.Fatalf("collect error = %v", err)
+	}
+
+	sums := map[string]int64{}
+	for _, scope := range collected.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			sum, ok := m.Data.(metricdata.Sum[int64])
+			if !ok {
+				continue
+			}
+			for _, point := range sum.DataPoints {
+				name := m.Name
+				if value, ok := point.Attributes.Value(key); ok {
+					name += " " + value.Emit()
+				}
+				sums[name] += point.Value
+			}
+		}
+	}
+
+	return sums
+}
+
+func TestTelemetry(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		wantSpans  int
+		wantStatus codes.Code
+		wantCounts map[string]int64
+	}{
+		{
+			name:       "completed call",
+			statuses:   []int{http.StatusOK},
+			wantSpans:  2,
+			wantStatus: codes.Unset,
+			wantCounts: map[string]int64{"client.requests 2xx": 1},
+		},
+		{
+			name:       "retried call",
+			statuses:   []int{http.StatusServiceUnavailable, http.StatusOK},
+			wantSpans:  3,
+			wantStatus: codes.Unset,
+			wantCounts: map[string]int64{"client.requests 2xx": 1, "client.retries": 1},
+		},
+		{
+			name:       "failed call",
+			statuses:   []int{http.StatusBadRequest},
+			wantSpans:  2,
+			wantStatus: codes.Error,
+			wantCounts: map[string]int64{"client.requests 4xx": 1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			attempt := 0
+			traceparents := []string{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				traceparents = append(traceparents, r.Header.Get("Traceparent"))
+				w.WriteHeader(test.statuses[attempt])
+				attempt++
+			}))
+			defer server.Close()
+
+			spans := tracetest.NewSpanRecorder()
+			reader := sdkmetric.NewManualReader()
+			client := newTestClient(t, server.URL, HTTPClient{
+				RetryPolicy: &RetryPolicy{MaxRetries: 1, MinDelay: time.Millisecond, MaxDelay: time.Millisecond},
+				Telemetry: &TelemetryConfig{
+					TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)),
+					MeterProvider:  sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)),
+				},
+			})
+
+			_ = client.CallClient(WithCallOptions(context.Background(), WithRoute("/drugs/{id}")), "drugs/1?nik=3171", GET, nil, nil, false)
+
+			ended := spans.Ended()
+			if len(ended) != test.wantSpans {
+				t.Fatalf("recorded %d spans, want %d", len(ended), test.wantSpans)
+			}
+			call := ended[len(ended)-1]
+			if call.Name() != "GET /drugs/{id}" || call.Status().Code != test.wantStatus {
+				t.Errorf("call span %q of status %v, want GET /drugs/{id} of status %v", call.Name(), call.Status().Code, test.wantStatus)
+			}
+			for i, attemptSpan := range ended[:len(ended)-1] {
+				if attemptSpan.Parent().SpanID() != call.SpanContext().SpanID() {
+					t.Errorf("attempt span %d not a child of the call span", i)
+				}
+				if traceparents[i] == "" || traceparents[i][36:52] != attemptSpan.SpanContext().SpanID().String() {
+					t.Errorf("attempt %d sent the traceparent %q, want the span %s", i, traceparents[i], attemptSpan.SpanContext().SpanID())
+				}
+			}
+
+			got := counts(t, reader, statusClassKey)
+			for name, want := range test.wantCounts {
+				if got[name] != want {
+					t.Errorf("%s = %d, want %d (collected %v)", name, got[name], want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestTelemetryCacheLookups(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	reader := sdkmetric.NewManualReader()
+	client := newTestClient(t, server.URL, HTTPClient{
+		Cache:     NewLRUCache(10, 0),
+		Telemetry: &TelemetryConfig{MeterProvider: sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))},
+	})
+
+	for i := 0; i < 3; i++ {
+		if errDo := client.CallClientWithCachingInRedis(context.Background(), 60, "drugs", GET, nil, nil, false); errDo.Err() != nil {
+			t.Fatalf("call %d error = %v", i, errDo.Err())
+		}
+	}
+
+	got := counts(t, reader, cacheTypeKey)
+	if got["client.cache.hits caching"] != 2 || got["client.cache.misses caching"] != 1 {
+		t.Errorf("cache lookups = %v, want 2 hits and 1 miss", got)
+	}
+}
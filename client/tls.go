@@ -0,0 +1,306 @@
+package client
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+//
+// Private constants
+//
+
+const defaultTLSReloadInterval = 30 * time.Second
+
+// TLSConfig represents the TLS configuration of the client, zero values fall back to the defaults.
+// It replaces the transport of the http client of the client, an invalid configuration is returned by Err
+// and fails every call.
+//
+// The certificate, key and CA files are read at the first connection and read again when they change on disk,
+// so the new connections use the rotated certificates without restarting the service.
+type TLSConfig struct {
+	// CertFile and KeyFile are the PEM files of the client certificate sent for mutual TLS
+	CertFile string
+	KeyFile  string
+	// CAFile is the PEM bundle of the CAs trusted to verify the servers, the system roots are used when empty
+	CAFile string
+	// ServerName overrides the name verified in the server certificate, the host of the url by default
+	ServerName string
+	// MinVersion is the min TLS version, tls.VersionTLS12 by default
+	MinVersion uint16
+	// PinnedPublicKeys are the base64 SHA-256 hashes of the subject public key info of the certificates,
+	// optionally prefixed by "sha256/", one of the certificates of the verified chain must match
+	PinnedPublicKeys []string
+	// ReloadInterval is how often the files are checked for changes, 30s by default and never when negative
+	ReloadInterval time.Duration
+}
+
+// NewTLSTransport creates the http transport of the TLS configuration, the files are loaded once to fail early
+func NewTLSTransport(config TLSConfig) (http.RoundTripper, error) {
+	transport, err := newTLSTransport(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.CertFile != "" {
+		if _, err = transport.base.TLSClientConfig.GetClientCertificate(nil); err != nil {
+			return nil, err
+		}
+	}
+	if _, err = transport.transport(); err != nil {
+		return nil, err
+	}
+
+	return transport, nil
+}
+
+// errorTransport fails every request with its error
+type errorTransport struct {
+	err error
+}
+
+// RoundTrip returns the error of the transport
+func (e errorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	return nil, e.err
+}
+
+// tlsTransport sends the requests with a transport trusting the CAs of the CA file,
+// replaced by a new transport when the CA file changes
+type tlsTransport struct {
+	mutex   sync.Mutex
+	base    *http.Transport
+	caPool  *fileReloader[*x509.CertPool]
+	pool    *x509.CertPool
+	current *http.Transport
+}
+
+// RoundTrip sends the request with the current transport
+func (t *tlsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport, err := t.transport()
+	if err != nil {
+		return nil, err
+	}
+
+	return transport.RoundTrip(req)
+}
+
+// CloseIdleConnections closes the idle connections of the base transport and of the current one
+func (t *tlsTransport) CloseIdleConnections() {
+	t.base.CloseIdleConnections()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.current != nil {
+		t.current.CloseIdleConnections()
+	}
+}
+
+// transport returns the transport trusting the current CAs
+func (t *tlsTransport) transport() (*http.Transport, error) {
+	if t.caPool == nil {
+		return t.base, nil
+	}
+
+	pool, err := t.caPool.get()
+	if err != nil {
+		return nil, err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if pool != t.pool {
+		if t.current != nil {
+			t.current.CloseIdleConnections()
+		}
+		t.current = t.base.Clone()
+		t.current.TLSClientConfig.RootCAs = pool
+		t.pool = pool
+	}
+
+	return t.current, nil
+}
+
+func newTLSTransport(config TLSConfig) (*tlsTransport, error) {
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		return nil, errors.New("tls: both CertFile and KeyFile are required for the client certificate")
+	}
+
+	pins, err := parsePinnedPublicKeys(config.PinnedPublicKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	interval := config.ReloadInterval
+	if interval == 0 {
+		interval = defaultTLSReloadInterval
+	}
+
+	minVersion := config.MinVersion
+	if minVersion == 0 {
+		minVersion = tls.VersionTLS12
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: minVersion,
+		ServerName: config.ServerName,
+	}
+	if len(pins) > 0 {
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			return verifyPinnedPublicKeys(state.VerifiedChains, pins)
+		}
+	}
+
+	if config.CertFile != "" {
+		certificate := newFileReloader(interval, []string{config.CertFile, config.KeyFile}, func() (*tls.Certificate, error) {
+			certificate, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+			return &certificate, err
+		})
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return certificate.get()
+		}
+	}
+
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.TLSClientConfig = tlsConfig
+	transport := &tlsTransport{
+		base: base,
+	}
+
+	if config.CAFile != "" {
+		transport.caPool = newFileReloader(interval, []string{config.CAFile}, func() (*x509.CertPool, error) {
+			bundle, err := os.ReadFile(config.CAFile)
+			if err != nil {
+				return nil, err
+			}
+
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(bundle) {
+				return nil, fmt.Errorf("tls: no certificate found in %s", config.CAFile)
+			}
+			return pool, nil
+		})
+	}
+
+	return transport, nil
+}
+
+// parsePinnedPublicKeys decodes the base64 hashes of the pinned public keys
+func parsePinnedPublicKeys(pinnedPublicKeys []string) (map[[sha256.Size]byte]bool, error) {
+	pins := map[[sha256.Size]byte]bool{}
+	for _, pin := range pinnedPublicKeys {
+		hash, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(pin, "sha256/"))
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("tls: invalid pinned public key %q", pin)
+		}
+
+		var key [sha256.Size]byte
+		copy(key[:], hash)
+		pins[key] = true
+	}
+
+	return pins, nil
+}
+
+// verifyPinnedPublicKeys checks that one of the certificates of the verified chains has a pinned public key
+func verifyPinnedPublicKeys(chains [][]*x509.Certificate, pins map[[sha256.Size]byte]bool) error {
+	if len(pins) == 0 {
+		return nil
+	}
+
+	for _, chain := range chains {
+		for _, certificate := range chain {
+			if pins[sha256.Sum256(certificate.RawSubjectPublicKeyInfo)] {
+				return nil
+			}
+		}
+	}
+
+	return errors.New("tls: no pinned public key found in the certificate chain")
+}
+
+// fileReloader loads a value from files and loads it again when their modification time changes
+type fileReloader[T any] struct {
+	mutex     sync.Mutex
+	interval  time.Duration
+	files     []string
+	load      func() (T, error)
+	value     T
+	loaded    bool
+	modTimes  []time.Time
+	checkedAt time.Time
+}
+
+// get returns the loaded value, the previous value is kept when the changed files fail to load
+func (f *fileReloader[T]) get() (T, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.loaded && (f.interval < 0 || time.Since(f.checkedAt) < f.interval) {
+		return f.value, nil
+	}
+	f.checkedAt = time.Now()
+
+	modTimes := make([]time.Time, 0, len(f.files))
+	for _, file := range f.files {
+		info, err := os.Stat(file)
+		if err != nil {
+			if f.loaded {
+				return f.value, nil
+			}
+			return f.value, err
+		}
+		modTimes = append(modTimes, info.ModTime())
+	}
+
+	if f.loaded && equalTimes(modTimes, f.modTimes) {
+		return f.value, nil
+	}
+
+	value, err := f.load()
+	if err != nil {
+		if f.loaded {
+			return f.value, nil
+		}
+		return value, err
+	}
+	f.value = value
+	f.loaded = true
+	f.modTimes = modTimes
+
+	return f.value, nil
+}
+
+func newFileReloader[T any](interval time.Duration, files []string, load func() (T, error)) *fileReloader[T] {
+	return &fileReloader[T]{
+		interval: interval,
+		files:    files,
+		load:     load,
+	}
+}
+
+func equalTimes(a []time.Time, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
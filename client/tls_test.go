@@ -0,0 +1,225 @@
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCertificate is a certificate and its key, signed by the parent or self signed
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	der         []byte
+}
+
+func newTestCertificate(t *testing.T, name string, parent *testCertificate, template x509.Certificate) *testCertificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template.SerialNumber = serial
+	template.Subject = pkix.Name{CommonName: name}
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	signer, signerKey := &template, key
+	if parent != nil {
+		signer, signerKey = parent.certificate, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate, _ := x509.ParseCertificate(der)
+
+	return &testCertificate{certificate: certificate, key: key, der: der}
+}
+
+// writePEM writes the certificate and its key into the directory, returning their files
+func (c *testCertificate) writePEM(t *testing.T, dir string, name string) (string, string) {
+	t.Helper()
+
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	_ = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0600)
+	_ = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+
+	return certFile, keyFile
+}
+
+func (c *testCertificate) pin() string {
+	sum := sha256.Sum256(c.certificate.RawSubjectPublicKeyInfo)
+	return "sha256/" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// newMTLSServer starts a server requiring a client certificate of the CA
+func newMTLSServer(t *testing.T, ca *testCertificate) *httptest.Server {
+	t.Helper()
+
+	serverCertificate := newTestCertificate(t, "server", ca, x509.Certificate{
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.certificate)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"client":"` + r.TLS.PeerCertificates[0].Subject.CommonName + `"}`))
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{serverCertificate.der}, PrivateKey: serverCertificate.key}},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}
+	server.StartTLS()
+
+	return server
+}
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCertificate(t, "ca", nil, x509.Certificate{IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign})
+	otherCA := newTestCertificate(t, "other-ca", nil, x509.Certificate{IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign})
+	clientCertificate := newTestCertificate(t, "drugs-service", ca, x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+
+	caFile, _ := ca.writePEM(t, dir, "ca")
+	certFile, keyFile := clientCertificate.writePEM(t, dir, "client")
+	invalidFile := filepath.Join(dir, "invalid.pem")
+	_ = os.WriteFile(invalidFile, []byte("not a pem"), 0600)
+
+	server := newMTLSServer(t, ca)
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		config     TLSConfig
+		wantConfig bool
+		wantCall   bool
+	}{
+		{
+			name:   "mutual tls",
+			config: TLSConfig{CertFile: certFile, KeyFile: keyFile, CAFile: caFile},
+		},
+		{
+			name:   "pinned public key of the chain",
+			config: TLSConfig{CertFile: certFile, KeyFile: keyFile, CAFile: caFile, PinnedPublicKeys: []string{ca.pin()}},
+		},
+		{
+			name:     "pinned public key not in the chain",
+			config:   TLSConfig{CertFile: certFile, KeyFile: keyFile, CAFile: caFile, PinnedPublicKeys: []string{otherCA.pin()}},
+			wantCall: true,
+		},
+		{
+			name:     "no client certificate",
+			config:   TLSConfig{CAFile: caFile},
+			wantCall: true,
+		},
+		{
+			name:       "certificate without key",
+			config:     TLSConfig{CertFile: certFile, CAFile: caFile},
+			wantConfig: true,
+		},
+		{
+			name:       "invalid key",
+			config:     TLSConfig{CertFile: certFile, KeyFile: invalidFile, CAFile: caFile},
+			wantConfig: true,
+		},
+		{
+			name:       "invalid CA file",
+			config:     TLSConfig{CertFile: certFile, KeyFile: keyFile, CAFile: invalidFile},
+			wantConfig: true,
+		},
+		{
+			name:       "missing CA file",
+			config:     TLSConfig{CertFile: certFile, KeyFile: keyFile, CAFile: filepath.Join(dir, "missing.pem")},
+			wantConfig: true,
+		},
+		{
+			name:       "invalid pinned public key",
+			config:     TLSConfig{CAFile: caFile, PinnedPublicKeys: []string{"sha256/abc"}},
+			wantConfig: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := test.config
+			client := newTestClient(t, server.URL, HTTPClient{TLS: &config})
+			if (client.Err() != nil) != test.wantConfig {
+				t.Fatalf("Err() = %v, want error %v", client.Err(), test.wantConfig)
+			}
+
+			result := map[string]string{}
+			errDo := client.CallClient(context.Background(), "drugs", GET, nil, &result, false)
+			if test.wantConfig || test.wantCall {
+				if errDo.Err() == nil {
+					t.Fatalf("call succeeded, want an error")
+				}
+				return
+			}
+			if errDo.Err() != nil || result["client"] != "drugs-service" {
+				t.Errorf("result = %v, error = %v", result, errDo.Err())
+			}
+		})
+	}
+}
+
+func TestTLSCloseIdleConnections(t *testing.T) {
+	ca := newTestCertificate(t, "ca", nil, x509.Certificate{IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign})
+	clientCertificate := newTestCertificate(t, "drugs-service", ca, x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	certFile, keyFile := clientCertificate.writePEM(t, t.TempDir(), "client")
+
+	closed := make(chan struct{}, 1)
+	server := newMTLSServer(t, ca)
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			closed <- struct{}{}
+		}
+	}
+	defer server.Close()
+
+	// without CA file the requests are sent by the base transport, trusting here the CA of the test
+	transport, err := newTLSTransport(TLSConfig{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport.base.TLSClientConfig.RootCAs = x509.NewCertPool()
+	transport.base.TLSClientConfig.RootCAs.AddCert(ca.certificate)
+
+	client := &http.Client{Transport: transport}
+	res, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	client.CloseIdleConnections()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Error("idle connection not closed")
+	}
+}
@@ -4,9 +4,36 @@ import (
 	"fmt"
 	"net/url"
 	"reflect"
+
+	"github.com/medicplus-inc/medicplus-kit/encoding/querystring"
 )
 
+// EncodeQueryParams adds the params encoded with their `qs` tags to the query of the path (see package querystring),
+// so that the same struct describes the query on the client and on the server decoding it
+func EncodeQueryParams(path string, params interface{}) (string, error) {
+	baseURL, err := url.Parse(path)
+	if err != nil {
+		return "", err
+	}
+
+	values, err := querystring.Encode(params)
+	if err != nil {
+		return "", err
+	}
+
+	query := baseURL.Query()
+	for key, value := range values {
+		query[key] = append(query[key], value...)
+	}
+	baseURL.RawQuery = query.Encode()
+
+	return baseURL.String(), nil
+}
+
 // ParseQueryParams .
+//
+// Deprecated: ParseQueryParams adds the pointers as their address, ignores omitempty and nested structs,
+// and panics on non-struct params. Use EncodeQueryParams instead.
 func ParseQueryParams(path string, params interface{}) string {
 	baseURL, _ := url.Parse(path)
 	filterParams := baseURL.Query()
@@ -0,0 +1,530 @@
+// Package querystring encodes structs into query parameters and decodes them back with the `qs` struct tag.
+//
+// The tag gives the name of the parameter followed by its options, e.g. `qs:"status,omitempty"`:
+//   - omitempty skips the zero values, nil pointers are always skipped
+//   - repeat (default), comma and bracket encode the slices as "a=1&a=2", "a=1,2" and "a[]=1&a[]=2"
+//   - unix and unixmilli encode the times as unix timestamps
+//
+// The times are encoded with the layout of the `layout` tag, RFC3339 by default, e.g. `qs:"from" layout:"2006-01-02"`.
+// A `qs:"-"` field and the fields without tag are skipped, except the embedded structs whose fields are flattened.
+// The fields of a nested struct are named after the parent, e.g. "filter[status]".
+// The types implementing Marshaler / Unmarshaler, then encoding.TextMarshaler / encoding.TextUnmarshaler
+// such as uuid.UUID, encode themselves.
+package querystring
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Marshaler is implemented by the types adding their own query values under the key
+type Marshaler interface {
+	MarshalQuery(key string, values url.Values) error
+}
+
+// Unmarshaler is implemented by the types decoding their own query values of the key
+type Unmarshaler interface {
+	UnmarshalQuery(key string, values url.Values) error
+}
+
+//
+// Private variables
+//
+
+var timeType = reflect.TypeOf(time.Time{})
+var marshalerType = reflect.TypeOf((*Marshaler)(nil)).Elem()
+var unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// errUnsupportedType is wrapped by the errors of the fields whose type cannot be decoded
+var errUnsupportedType = errors.New("unsupported type")
+
+// Encode encodes the struct, or pointer to struct, into query values; a nil value is encoded as empty values
+func Encode(v interface{}) (url.Values, error) {
+	values := url.Values{}
+	if v == nil {
+		return values, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return values, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("querystring: cannot encode %T, a struct is expected", v)
+	}
+
+	if err := encodeStruct(values, "", rv); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// Decode decodes the query values into the pointer to struct, the missing and empty parameters are skipped
+func Decode(values url.Values, v interface{}) error {
+	return Decoder{}.Decode(values, v)
+}
+
+// Decoder represents the options of the decoding of the query values
+type Decoder struct {
+	// SkipUnsupported leaves the fields whose type cannot be decoded untouched instead of failing
+	SkipUnsupported bool
+}
+
+// Decode decodes the query values into the pointer to struct, the missing and empty parameters are skipped
+func (d Decoder) Decode(values url.Values, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("querystring: cannot decode into %T, a pointer to struct is expected", v)
+	}
+
+	return d.decodeStruct(values, "", rv.Elem())
+}
+
+// field represents the options of the `qs` tag of a struct field
+type field struct {
+	name      string
+	omitEmpty bool
+	style     string
+	unix      string
+	layout    string
+}
+
+// parseField reads the tags of the struct field, ok is false when the field is skipped
+func parseField(structField reflect.StructField) (field, bool) {
+	tag, hasTag := structField.Tag.Lookup("qs")
+	if !hasTag || tag == "-" {
+		return field{}, false
+	}
+
+	parts := strings.Split(tag, ",")
+	f := field{
+		name:   parts[0],
+		style:  "repeat",
+		layout: structField.Tag.Get("layout"),
+	}
+	for _, option := range parts[1:] {
+		switch option {
+		case "omitempty":
+			f.omitEmpty = true
+		case "repeat", "comma", "bracket":
+			f.style = option
+		case "unix", "unixmilli":
+			f.unix = option
+		}
+	}
+	if f.name == "" {
+		f.name = structField.Name
+	}
+	if f.layout == "" {
+		f.layout = time.RFC3339
+	}
+
+	return f, true
+}
+
+// key returns the key of the field, nested under the prefix
+func (f field) key(prefix string) string {
+	if prefix == "" {
+		return f.name
+	}
+
+	return prefix + "[" + f.name + "]"
+}
+
+// isEmbedded reports whether the field is an untagged embedded struct whose fields are flattened
+func isEmbedded(structField reflect.StructField) bool {
+	if !structField.Anonymous {
+		return false
+	}
+	if _, hasTag := structField.Tag.Lookup("qs"); hasTag {
+		return false
+	}
+
+	t := structField.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t.Kind() == reflect.Struct && !encodesItself(t)
+}
+
+// encodesItself reports whether the type is encoded by itself rather than field by field
+func encodesItself(t reflect.Type) bool {
+	if t == timeType {
+		return true
+	}
+
+	for _, candidate := range []reflect.Type{t, reflect.PtrTo(t)} {
+		if candidate.Implements(marshalerType) || candidate.Implements(textMarshalerType) ||
+			candidate.Implements(unmarshalerType) || candidate.Implements(textUnmarshalerType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func encodeStruct(values url.Values, prefix string, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		structField := rt.Field(i)
+		fv := rv.Field(i)
+
+		if isEmbedded(structField) {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if err := encodeStruct(values, prefix, fv); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if structField.PkgPath != "" {
+			continue
+		}
+		f, ok := parseField(structField)
+		if !ok {
+			continue
+		}
+
+		if err := encodeField(values, f, f.key(prefix), fv); err != nil {
+			return fmt.Errorf("querystring: cannot encode %s: %w", structField.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func encodeField(values url.Values, f field, key string, fv reflect.Value) error {
+	if f.omitEmpty && (fv.IsZero() || fv.Kind() == reflect.Slice && fv.Len() == 0) {
+		return nil
+	}
+	for fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Interface {
+		if fv.IsNil() {
+			return nil
+		}
+		fv = fv.Elem()
+	}
+
+	if marshaler, ok := asMarshaler(fv); ok {
+		return marshaler.MarshalQuery(key, values)
+	}
+
+	if fv.Kind() == reflect.Struct && !encodesItself(fv.Type()) {
+		return encodeStruct(values, key, fv)
+	}
+
+	if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 && !encodesItself(fv.Type()) {
+		items := make([]string, 0, fv.Len())
+		for i := 0; i < fv.Len(); i++ {
+			item, err := encodeValue(f, fv.Index(i))
+			if err != nil {
+				return err
+			}
+			items = append(items, item)
+		}
+
+		switch f.style {
+		case "comma":
+			if len(items) > 0 {
+				values.Add(key, strings.Join(items, ","))
+			}
+		case "bracket":
+			for _, item := range items {
+				values.Add(key+"[]", item)
+			}
+		default:
+			for _, item := range items {
+				values.Add(key, item)
+			}
+		}
+		return nil
+	}
+
+	value, err := encodeValue(f, fv)
+	if err != nil {
+		return err
+	}
+	values.Add(key, value)
+
+	return nil
+}
+
+// encodeValue formats a single value
+func encodeValue(f field, fv reflect.Value) (string, error) {
+	for fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Interface {
+		if fv.IsNil() {
+			return "", nil
+		}
+		fv = fv.Elem()
+	}
+
+	if fv.Type() == timeType {
+		t := fv.Interface().(time.Time)
+		switch f.unix {
+		case "unix":
+			return strconv.FormatInt(t.Unix(), 10), nil
+		case "unixmilli":
+			return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10), nil
+		}
+		return t.Format(f.layout), nil
+	}
+
+	if marshaler, ok := asTextMarshaler(fv); ok {
+		text, err := marshaler.MarshalText()
+		return string(text), err
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		return fv.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(fv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(fv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(fv.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(fv.Float(), 'f', -1, fv.Type().Bits()), nil
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() == reflect.Uint8 {
+			return string(fv.Bytes()), nil
+		}
+	}
+
+	return "", fmt.Errorf("unsupported type %s", fv.Type())
+}
+
+func asMarshaler(fv reflect.Value) (Marshaler, bool) {
+	if fv.Type().Implements(marshalerType) {
+		return fv.Interface().(Marshaler), true
+	}
+	if fv.CanAddr() && fv.Addr().Type().Implements(marshalerType) {
+		return fv.Addr().Interface().(Marshaler), true
+	}
+
+	return nil, false
+}
+
+func asTextMarshaler(fv reflect.Value) (encoding.TextMarshaler, bool) {
+	if fv.Type().Implements(textMarshalerType) {
+		return fv.Interface().(encoding.TextMarshaler), true
+	}
+	if fv.CanAddr() && fv.Addr().Type().Implements(textMarshalerType) {
+		return fv.Addr().Interface().(encoding.TextMarshaler), true
+	}
+
+	return nil, false
+}
+
+func (d Decoder) decodeStruct(values url.Values, prefix string, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		structField := rt.Field(i)
+		fv := rv.Field(i)
+
+		if isEmbedded(structField) {
+			if fv.Kind() == reflect.Ptr {
+				if !hasPrefix(values, prefix) {
+					continue
+				}
+				if fv.IsNil() {
+					if !fv.CanSet() {
+						continue
+					}
+					fv.Set(reflect.New(fv.Type().Elem()))
+				}
+				fv = fv.Elem()
+			}
+			if err := d.decodeStruct(values, prefix, fv); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if structField.PkgPath != "" {
+			continue
+		}
+		f, ok := parseField(structField)
+		if !ok {
+			continue
+		}
+
+		previous := reflect.New(fv.Type()).Elem()
+		previous.Set(fv)
+		if err := d.decodeField(values, f, f.key(prefix), fv); err != nil {
+			if d.SkipUnsupported && errors.Is(err, errUnsupportedType) {
+				// the pointers allocated for the field are dropped
+				fv.Set(previous)
+				continue
+			}
+			return fmt.Errorf("querystring: cannot decode %s: %w", f.key(prefix), err)
+		}
+	}
+
+	return nil
+}
+
+func (d Decoder) decodeField(values url.Values, f field, key string, fv reflect.Value) error {
+	t := fv.Type()
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case reflect.PtrTo(t).Implements(unmarshalerType):
+		if _, ok := values[key]; !ok {
+			return nil
+		}
+		return allocate(fv).Interface().(Unmarshaler).UnmarshalQuery(key, values)
+	case t.Kind() == reflect.Struct && !encodesItself(t):
+		if !hasPrefix(values, key+"[") {
+			return nil
+		}
+		return d.decodeStruct(values, key, allocate(fv).Elem())
+	case t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8 && !encodesItself(t):
+		items := values[key]
+		switch f.style {
+		case "comma":
+			items = nil
+			if value := values.Get(key); value != "" {
+				items = strings.Split(value, ",")
+			}
+		case "bracket":
+			items = values[key+"[]"]
+		}
+		if len(items) == 0 {
+			return nil
+		}
+
+		slice := reflect.MakeSlice(t, len(items), len(items))
+		for i, item := range items {
+			if err := decodeValue(f, item, slice.Index(i)); err != nil {
+				return err
+			}
+		}
+		allocate(fv).Elem().Set(slice)
+		return nil
+	}
+
+	value := values.Get(key)
+	if value == "" {
+		return nil
+	}
+
+	return decodeValue(f, value, allocate(fv).Elem())
+}
+
+// allocate returns a pointer to the value of the field, allocating the nil pointers
+func allocate(fv reflect.Value) reflect.Value {
+	for fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		if fv.Elem().Kind() != reflect.Ptr {
+			return fv
+		}
+		fv = fv.Elem()
+	}
+
+	return fv.Addr()
+}
+
+// decodeValue parses a single value into the settable value
+func decodeValue(f field, value string, fv reflect.Value) error {
+	if fv.Kind() == reflect.Ptr {
+		return decodeValue(f, value, allocate(fv).Elem())
+	}
+
+	if fv.Type() == timeType {
+		var t time.Time
+		switch f.unix {
+		case "unix", "unixmilli":
+			timestamp, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return err
+			}
+			t = time.Unix(timestamp, 0)
+			if f.unix == "unixmilli" {
+				t = time.Unix(0, timestamp*int64(time.Millisecond))
+			}
+		default:
+			parsed, err := time.Parse(f.layout, value)
+			if err != nil {
+				return err
+			}
+			t = parsed
+		}
+		fv.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	if fv.Addr().Type().Implements(textUnmarshalerType) {
+		return fv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Bool:
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(v)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v, err := strconv.ParseInt(value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v, err := strconv.ParseUint(value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(v)
+	case reflect.Float32, reflect.Float64:
+		v, err := strconv.ParseFloat(value, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(v)
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("%w %s", errUnsupportedType, fv.Type())
+		}
+		fv.SetBytes([]byte(value))
+	default:
+		return fmt.Errorf("%w %s", errUnsupportedType, fv.Type())
+	}
+
+	return nil
+}
+
+// hasPrefix reports whether one of the keys of the values starts with the prefix, any key when empty
+func hasPrefix(values url.Values, prefix string) bool {
+	for key := range values {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,226 @@
+package querystring
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Paging struct {
+	Page  int `qs:"page,omitempty"`
+	Limit int `qs:"limit,omitempty"`
+}
+
+type filter struct {
+	Status string `qs:"status"`
+	Level  *int   `qs:"level"`
+}
+
+type search struct {
+	Paging
+	Keyword  string     `qs:"keyword,omitempty"`
+	IDs      []int      `qs:"ids"`
+	Codes    []string   `qs:"codes,comma"`
+	Tags     []string   `qs:"tags,bracket"`
+	Price    float64    `qs:"price,omitempty"`
+	Active   *bool      `qs:"active"`
+	ID       uuid.UUID  `qs:"id,omitempty"`
+	From     time.Time  `qs:"from,omitempty" layout:"2006-01-02"`
+	To       *time.Time `qs:"to,unix"`
+	Filter   *filter    `qs:"filter"`
+	Ignored  string     `qs:"-"`
+	Untagged string
+}
+
+type unsupported struct {
+	Page     int            `qs:"page"`
+	Channels chan int       `qs:"channels"`
+	Labels   map[string]int `qs:"labels"`
+}
+
+func TestEncode(t *testing.T) {
+	id := uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	active := false
+	level := 3
+	to := time.Unix(1672531200, 0)
+
+	tests := []struct {
+		name    string
+		value   interface{}
+		want    url.Values
+		wantErr bool
+	}{
+		{
+			name:  "nil value",
+			value: nil,
+			want:  url.Values{},
+		},
+		{
+			name:  "nil pointer",
+			value: (*search)(nil),
+			want:  url.Values{},
+		},
+		{
+			name:  "zero values omitted",
+			value: search{Ignored: "ignored", Untagged: "untagged"},
+			want:  url.Values{},
+		},
+		{
+			name: "every field",
+			value: &search{
+				Paging:  Paging{Page: 2, Limit: 10},
+				Keyword: "aspirin",
+				IDs:     []int{1, 2},
+				Codes:   []string{"a", "b"},
+				Tags:    []string{"x", "y"},
+				Price:   1.5,
+				Active:  &active,
+				ID:      id,
+				From:    time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC),
+				To:      &to,
+				Filter:  &filter{Status: "open", Level: &level},
+			},
+			want: url.Values{
+				"page":           {"2"},
+				"limit":          {"10"},
+				"keyword":        {"aspirin"},
+				"ids":            {"1", "2"},
+				"codes":          {"a,b"},
+				"tags[]":         {"x", "y"},
+				"price":          {"1.5"},
+				"active":         {"false"},
+				"id":             {id.String()},
+				"from":           {"2023-01-02"},
+				"to":             {"1672531200"},
+				"filter[status]": {"open"},
+				"filter[level]":  {"3"},
+			},
+		},
+		{
+			name:    "not a struct",
+			value:   []int{1},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported field",
+			value:   unsupported{Labels: map[string]int{"a": 1}},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values, err := Encode(test.value)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error = %v, want error %t", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(values, test.want) {
+				t.Errorf("values = %v, want %v", values, test.want)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	id := uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	active := true
+	level := 3
+	to := time.Unix(1672531200, 0)
+
+	tests := []struct {
+		name    string
+		query   string
+		decoder Decoder
+		target  interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name:   "missing and empty parameters skipped",
+			query:  "keyword=&page=",
+			target: &search{},
+			want:   &search{},
+		},
+		{
+			name: "every field",
+			query: "page=2&limit=10&keyword=aspirin&ids=1&ids=2&codes=a,b&tags[]=x&tags[]=y&price=1.5&active=true&id=" + id.String() +
+				"&from=2023-01-02&to=1672531200&filter[status]=open&filter[level]=3&Untagged=untagged",
+			target: &search{},
+			want: &search{
+				Paging:  Paging{Page: 2, Limit: 10},
+				Keyword: "aspirin",
+				IDs:     []int{1, 2},
+				Codes:   []string{"a", "b"},
+				Tags:    []string{"x", "y"},
+				Price:   1.5,
+				Active:  &active,
+				ID:      id,
+				From:    time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC),
+				To:      &to,
+				Filter:  &filter{Status: "open", Level: &level},
+			},
+		},
+		{
+			name:    "invalid value",
+			query:   "ids=1&ids=two",
+			target:  &search{},
+			wantErr: true,
+		},
+		{
+			name:    "not a pointer to struct",
+			query:   "page=1",
+			target:  search{},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported field",
+			query:   "page=1&channels=1",
+			target:  &unsupported{},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported field skipped",
+			query:   "page=1&channels=1&labels=a",
+			decoder: Decoder{SkipUnsupported: true},
+			target:  &unsupported{},
+			want:    &unsupported{Page: 1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values, err := url.ParseQuery(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = test.decoder.Decode(values, test.target)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error = %v, want error %t", err, test.wantErr)
+			}
+			if !test.wantErr && !reflect.DeepEqual(test.target, test.want) {
+				t.Errorf("decoded = %+v, want %+v", test.target, test.want)
+			}
+		})
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	level := 1
+	want := search{Keyword: "aspirin", IDs: []int{3}, Codes: []string{"a"}, Filter: &filter{Status: "open", Level: &level}}
+
+	values, err := Encode(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := search{}
+	if err = Decode(values, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,74 @@
+package signature
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// DefaultRedisNoncePrefix is the prefix of the nonces stored by the redis nonce store
+const DefaultRedisNoncePrefix = "signature-nonce:"
+
+// NonceStore remembers the nonces of the verified requests to reject their replays
+type NonceStore interface {
+	// Add stores the nonce for the ttl and reports whether it was not stored yet
+	Add(ctx context.Context, nonce string, ttl time.Duration) (bool, error)
+}
+
+// MemoryNonceStore is the nonce store of a single process
+type MemoryNonceStore struct {
+	mutex  sync.Mutex
+	nonces map[string]time.Time
+}
+
+// Add stores the nonce for the ttl, the expired nonces are purged along the way
+func (m *MemoryNonceStore) Add(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Now()
+	for stored, expiredAt := range m.nonces {
+		if now.After(expiredAt) {
+			delete(m.nonces, stored)
+		}
+	}
+
+	if _, ok := m.nonces[nonce]; ok {
+		return false, nil
+	}
+	m.nonces[nonce] = now.Add(ttl)
+
+	return true, nil
+}
+
+// NewMemoryNonceStore creates the nonce store of a single process
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{
+		nonces: map[string]time.Time{},
+	}
+}
+
+// RedisNonceStore is the nonce store shared by the replicas of a service
+type RedisNonceStore struct {
+	redisClient *redis.Client
+	prefix      string
+}
+
+// Add stores the nonce with SETNX
+func (r *RedisNonceStore) Add(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	return r.redisClient.WithContext(ctx).SetNX(r.prefix+nonce, 1, ttl).Result()
+}
+
+// NewRedisNonceStore creates the nonce store in redis, DefaultRedisNoncePrefix is used when the prefix is empty
+func NewRedisNonceStore(redisClient *redis.Client, prefix string) *RedisNonceStore {
+	if prefix == "" {
+		prefix = DefaultRedisNoncePrefix
+	}
+
+	return &RedisNonceStore{
+		redisClient: redisClient,
+		prefix:      prefix,
+	}
+}
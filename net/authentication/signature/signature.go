@@ -0,0 +1,320 @@
+package signature
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Headers carrying the signature of a request
+const (
+	HeaderKeyID         = "X-Signature-Key-Id"
+	HeaderTimestamp     = "X-Signature-Timestamp"
+	HeaderNonce         = "X-Signature-Nonce"
+	HeaderSignedHeaders = "X-Signature-Headers"
+	HeaderContentSHA256 = "X-Content-Sha256"
+	HeaderSignature     = "X-Signature"
+)
+
+// Algorithm is the name of the signing algorithm, first line of the string to sign
+const Algorithm = "HMAC-SHA256"
+
+// DefaultClockSkew is the max difference between the timestamp of a request and the time of its verification
+const DefaultClockSkew = 5 * time.Minute
+
+// DefaultMaxBodySize is the max number of bytes of the body of a verified request
+const DefaultMaxBodySize = 10 << 20
+
+// Errors returned by the verification of a request
+var (
+	ErrMissingSignature = errors.New("signature: missing signature")
+	ErrUnknownKey       = errors.New("signature: unknown key")
+	ErrExpiredSignature = errors.New("signature: timestamp outside the clock skew window")
+	ErrDigestMismatch   = errors.New("signature: body digest mismatch")
+	ErrInvalidSignature = errors.New("signature: invalid signature")
+	ErrReplayedRequest  = errors.New("signature: replayed request")
+	ErrUnsignedHeader   = errors.New("signature: required header not signed")
+	ErrBodyTooLarge     = errors.New("signature: request body too large")
+)
+
+// KeyStore represents the storage of the secrets of the signing keys
+type KeyStore interface {
+	Secret(ctx context.Context, keyID string) ([]byte, error)
+}
+
+// StaticKeyStore is the key store of a fixed set of secrets by key id
+type StaticKeyStore map[string][]byte
+
+// Secret returns the secret of the key, ErrUnknownKey when it does not exist
+func (s StaticKeyStore) Secret(ctx context.Context, keyID string) ([]byte, error) {
+	secret, ok := s[keyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	return secret, nil
+}
+
+// Signer signs the requests with HMAC-SHA256.
+//
+// The signature covers the method, the path, the sorted query, the signed headers, a SHA-256 digest of the body,
+// a timestamp and a random nonce, in the style of AWS SigV4.
+type Signer struct {
+	keyID         string
+	secret        []byte
+	signedHeaders []string
+	now           func() time.Time
+}
+
+// Sign adds the signature headers to the request, the body is the payload the request sends
+func (s *Signer) Sign(req *http.Request, body []byte) {
+	digest := sha256.Sum256(body)
+	contentSHA256 := hex.EncodeToString(digest[:])
+
+	req.Header.Set(HeaderKeyID, s.keyID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(s.now().Unix(), 10))
+	req.Header.Set(HeaderNonce, uuid.New().String())
+	req.Header.Set(HeaderContentSHA256, contentSHA256)
+	if len(s.signedHeaders) > 0 {
+		req.Header.Set(HeaderSignedHeaders, strings.Join(s.signedHeaders, ";"))
+	} else {
+		req.Header.Del(HeaderSignedHeaders)
+	}
+
+	req.Header.Set(HeaderSignature, Compute(s.secret, StringToSign(req, s.signedHeaders, contentSHA256)))
+}
+
+// KeyID returns the id of the key signing the requests
+func (s *Signer) KeyID() string {
+	return s.keyID
+}
+
+// NewSigner creates the signer of the key, the signed headers are lower cased header names such as "host"
+func NewSigner(keyID string, secret []byte, signedHeaders ...string) *Signer {
+	names := make([]string, 0, len(signedHeaders))
+	for _, name := range signedHeaders {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+
+	return &Signer{
+		keyID:         keyID,
+		secret:        secret,
+		signedHeaders: names,
+		now:           time.Now,
+	}
+}
+
+// VerifierConfig represents the configuration of the verification of the signed requests
+type VerifierConfig struct {
+	// Keys provides the secrets of the key ids
+	Keys KeyStore
+	// ClockSkew is the max difference between the timestamp of the request and now, DefaultClockSkew by default
+	ClockSkew time.Duration
+	// Nonces rejects the nonces already seen, replays within the clock skew window are accepted when nil
+	Nonces NonceStore
+	// RequiredHeaders are the lower cased header names, such as "host", the signatures must cover
+	RequiredHeaders []string
+	// MaxBodySize is the max number of bytes of the body read by ReadBody, DefaultMaxBodySize by default
+	// and unlimited when negative
+	MaxBodySize int64
+}
+
+// Verifier verifies the requests signed by a Signer
+type Verifier struct {
+	config VerifierConfig
+	now    func() time.Time
+}
+
+// Verify checks the signature of the request, the body is the payload the request received
+func (v *Verifier) Verify(req *http.Request, body []byte) error {
+	keyID := req.Header.Get(HeaderKeyID)
+	signature := req.Header.Get(HeaderSignature)
+	timestamp := req.Header.Get(HeaderTimestamp)
+	nonce := req.Header.Get(HeaderNonce)
+	if keyID == "" || signature == "" || timestamp == "" || nonce == "" {
+		return ErrMissingSignature
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrMissingSignature
+	}
+	skew := v.now().Sub(time.Unix(seconds, 0))
+	if skew > v.clockSkew() || skew < -v.clockSkew() {
+		return ErrExpiredSignature
+	}
+
+	digest := sha256.Sum256(body)
+	contentSHA256 := hex.EncodeToString(digest[:])
+	if !hmac.Equal([]byte(contentSHA256), []byte(req.Header.Get(HeaderContentSHA256))) {
+		return ErrDigestMismatch
+	}
+
+	secret, err := v.config.Keys.Secret(req.Context(), keyID)
+	if err != nil {
+		return err
+	}
+
+	signedHeaders := []string{}
+	if names := req.Header.Get(HeaderSignedHeaders); names != "" {
+		signedHeaders = strings.Split(names, ";")
+	}
+	for _, required := range v.config.RequiredHeaders {
+		if !containsHeader(signedHeaders, required) {
+			return ErrUnsignedHeader
+		}
+	}
+	expected := Compute(secret, StringToSign(req, signedHeaders, contentSHA256))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+
+	if v.config.Nonces != nil {
+		// the nonce is kept as long as its request can pass the clock skew check
+		fresh, err := v.config.Nonces.Add(req.Context(), keyID+":"+nonce, 2*v.clockSkew())
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return ErrReplayedRequest
+		}
+	}
+
+	return nil
+}
+
+// ReadBody reads the body of the request up to the MaxBodySize, ErrBodyTooLarge beyond,
+// and replaces it with a reader of the returned bytes so that the handlers can read it again
+func (v *Verifier) ReadBody(w http.ResponseWriter, req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+
+	reader := req.Body
+	if maxBodySize := v.maxBodySize(); maxBodySize >= 0 {
+		reader = http.MaxBytesReader(w, req.Body, maxBodySize)
+	}
+	body, err := ioutil.ReadAll(reader)
+	req.Body.Close()
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, ErrBodyTooLarge
+		}
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	return body, nil
+}
+
+func (v *Verifier) maxBodySize() int64 {
+	if v.config.MaxBodySize == 0 {
+		return DefaultMaxBodySize
+	}
+
+	return v.config.MaxBodySize
+}
+
+func (v *Verifier) clockSkew() time.Duration {
+	if v.config.ClockSkew == 0 {
+		return DefaultClockSkew
+	}
+
+	return v.config.ClockSkew
+}
+
+// NewVerifier creates the verifier of the signed requests
+func NewVerifier(config VerifierConfig) *Verifier {
+	return &Verifier{
+		config: config,
+		now:    time.Now,
+	}
+}
+
+// StringToSign builds the canonical string of the request signed with HMAC-SHA256
+func StringToSign(req *http.Request, signedHeaders []string, contentSHA256 string) string {
+	canonical := bytes.Buffer{}
+	canonical.WriteString(Algorithm + "\n")
+	canonical.WriteString(req.Header.Get(HeaderKeyID) + "\n")
+	canonical.WriteString(req.Header.Get(HeaderTimestamp) + "\n")
+	canonical.WriteString(req.Header.Get(HeaderNonce) + "\n")
+	canonical.WriteString(strings.ToUpper(req.Method) + "\n")
+	canonical.WriteString(canonicalPath(req.URL) + "\n")
+	canonical.WriteString(canonicalQuery(req.URL) + "\n")
+	for _, name := range signedHeaders {
+		fmt.Fprintf(&canonical, "%s:%s\n", name, canonicalHeader(req, name))
+	}
+	canonical.WriteString(strings.Join(signedHeaders, ";") + "\n")
+	canonical.WriteString(contentSHA256)
+
+	return canonical.String()
+}
+
+// Compute returns the hex encoded HMAC-SHA256 of the string to sign
+func Compute(secret []byte, stringToSign string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(stringToSign))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// containsHeader reports whether the header name is in the signed headers, regardless of its case
+func containsHeader(signedHeaders []string, name string) bool {
+	for _, signed := range signedHeaders {
+		if strings.EqualFold(signed, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func canonicalPath(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		return "/"
+	}
+
+	return path
+}
+
+// canonicalQuery sorts the query by key then value, so its original order and encoding do not matter
+func canonicalQuery(u *url.URL) string {
+	query := u.Query()
+	for _, values := range query {
+		sort.Strings(values)
+	}
+
+	return query.Encode()
+}
+
+func canonicalHeader(req *http.Request, name string) string {
+	if name == "host" {
+		if req.Host != "" {
+			return req.Host
+		}
+		return req.URL.Host
+	}
+
+	values := []string{}
+	for _, value := range req.Header.Values(name) {
+		values = append(values, strings.TrimSpace(value))
+	}
+
+	return strings.Join(values, ",")
+}
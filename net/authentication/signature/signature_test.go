@@ -0,0 +1,244 @@
+package signature
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	keys := StaticKeyStore{"service-1": []byte("secret-1"), "service-2": []byte("secret-2")}
+	body := []byte(`{"name":"aspirin"}`)
+
+	tests := []struct {
+		name     string
+		keyID    string
+		secret   string
+		signed   []string
+		required []string
+		signedAt time.Time
+		tamper   func(req *http.Request) []byte
+		wantErr  error
+	}{
+		{
+			name:   "valid signature",
+			keyID:  "service-1",
+			secret: "secret-1",
+		},
+		{
+			name:   "query reordered",
+			keyID:  "service-1",
+			secret: "secret-1",
+			tamper: func(req *http.Request) []byte {
+				req.URL.RawQuery = "page=2&ids=b&ids=a"
+				return body
+			},
+		},
+		{
+			name:   "tampered body",
+			keyID:  "service-1",
+			secret: "secret-1",
+			tamper: func(req *http.Request) []byte {
+				return []byte(`{"name":"morphine"}`)
+			},
+			wantErr: ErrDigestMismatch,
+		},
+		{
+			name:   "tampered query",
+			keyID:  "service-1",
+			secret: "secret-1",
+			tamper: func(req *http.Request) []byte {
+				req.URL.RawQuery = "ids=a&ids=b&page=3"
+				return body
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:   "tampered method",
+			keyID:  "service-1",
+			secret: "secret-1",
+			tamper: func(req *http.Request) []byte {
+				req.Method = http.MethodDelete
+				return body
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:   "tampered signed header",
+			keyID:  "service-1",
+			secret: "secret-1",
+			signed: []string{"X-Patient-Id"},
+			tamper: func(req *http.Request) []byte {
+				req.Header.Set("X-Patient-Id", "patient-2")
+				return body
+			},
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "wrong secret",
+			keyID:   "service-1",
+			secret:  "secret-2",
+			wantErr: ErrInvalidSignature,
+		},
+		{
+			name:    "unknown key",
+			keyID:   "service-3",
+			secret:  "secret-3",
+			wantErr: ErrUnknownKey,
+		},
+		{
+			name:     "expired signature",
+			keyID:    "service-1",
+			secret:   "secret-1",
+			signedAt: time.Now().Add(-10 * time.Minute),
+			wantErr:  ErrExpiredSignature,
+		},
+		{
+			name:     "signature from the future",
+			keyID:    "service-1",
+			secret:   "secret-1",
+			signedAt: time.Now().Add(10 * time.Minute),
+			wantErr:  ErrExpiredSignature,
+		},
+		{
+			name:     "required header not signed",
+			keyID:    "service-1",
+			secret:   "secret-1",
+			required: []string{"host"},
+			wantErr:  ErrUnsignedHeader,
+		},
+		{
+			name:     "required header signed",
+			keyID:    "service-1",
+			secret:   "secret-1",
+			signed:   []string{"Host"},
+			required: []string{"host"},
+		},
+		{
+			name:   "missing signature",
+			keyID:  "service-1",
+			secret: "secret-1",
+			tamper: func(req *http.Request) []byte {
+				req.Header.Del(HeaderSignature)
+				return body
+			},
+			wantErr: ErrMissingSignature,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "https://drugs.local/drugs?page=2&ids=a&ids=b", bytes.NewReader(body))
+			req.Header.Set("X-Patient-Id", "patient-1")
+
+			signer := NewSigner(test.keyID, []byte(test.secret), test.signed...)
+			if !test.signedAt.IsZero() {
+				signer.now = func() time.Time { return test.signedAt }
+			}
+			signer.Sign(req, body)
+
+			received := body
+			if test.tamper != nil {
+				received = test.tamper(req)
+			}
+
+			verifier := NewVerifier(VerifierConfig{Keys: keys, RequiredHeaders: test.required})
+			if err := verifier.Verify(req, received); !errors.Is(err, test.wantErr) {
+				t.Errorf("Verify() error = %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyReplay(t *testing.T) {
+	signer := NewSigner("service-1", []byte("secret-1"))
+	verifier := NewVerifier(VerifierConfig{Keys: StaticKeyStore{"service-1": []byte("secret-1")}, Nonces: NewMemoryNonceStore()})
+
+	req := httptest.NewRequest(http.MethodGet, "https://drugs.local/drugs", nil)
+	signer.Sign(req, nil)
+
+	tests := []struct {
+		name    string
+		sign    bool
+		wantErr error
+	}{
+		{name: "first request", wantErr: nil},
+		{name: "replayed request", wantErr: ErrReplayedRequest},
+		{name: "request signed again", sign: true, wantErr: nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.sign {
+				signer.Sign(req, nil)
+			}
+			if err := verifier.Verify(req, nil); !errors.Is(err, test.wantErr) {
+				t.Errorf("Verify() error = %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		maxBodySize int64
+		wantErr     error
+	}{
+		{name: "body within the max size", body: "aspirin", maxBodySize: 7},
+		{name: "body larger than the max size", body: "aspirin", maxBodySize: 6, wantErr: ErrBodyTooLarge},
+		{name: "unlimited body", body: "aspirin", maxBodySize: -1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "https://drugs.local/drugs", bytes.NewBufferString(test.body))
+			verifier := NewVerifier(VerifierConfig{MaxBodySize: test.maxBodySize})
+
+			body, err := verifier.ReadBody(httptest.NewRecorder(), req)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("ReadBody() error = %v, want %v", err, test.wantErr)
+			}
+			if test.wantErr != nil {
+				return
+			}
+
+			again := new(bytes.Buffer)
+			_, _ = again.ReadFrom(req.Body)
+			if string(body) != test.body || again.String() != test.body {
+				t.Errorf("body = %q, read again %q, want %q", body, again, test.body)
+			}
+		})
+	}
+}
+
+func TestMemoryNonceStore(t *testing.T) {
+	store := NewMemoryNonceStore()
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		nonce string
+		wait  time.Duration
+		want  bool
+	}{
+		{name: "new nonce", nonce: "a", want: true},
+		{name: "seen nonce", nonce: "a", want: false},
+		{name: "other nonce", nonce: "b", want: true},
+		{name: "expired nonce", nonce: "a", wait: 30 * time.Millisecond, want: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			time.Sleep(test.wait)
+			if got, err := store.Add(ctx, test.nonce, 20*time.Millisecond); err != nil || got != test.want {
+				t.Errorf("Add(%q) = %v, %v, want %v", test.nonce, got, err, test.want)
+			}
+		})
+	}
+}
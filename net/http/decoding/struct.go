@@ -11,9 +11,22 @@ import (
 	"github.com/go-chi/chi"
 	gokitHttp "github.com/go-kit/kit/transport/http"
 	"github.com/google/uuid"
+	"github.com/medicplus-inc/medicplus-kit/encoding/querystring"
 )
 
+// Options represents the options of the decoding of the requests
+type Options struct {
+	// TypedQueryString decodes the query into every type supported by the querystring package, such as the floats,
+	// the times and the slices, instead of the int, string, bool and uuid fields only
+	TypedQueryString bool
+}
+
 func Decode(model interface{}) gokitHttp.DecodeRequestFunc {
+	return DecodeWithOptions(model, Options{})
+}
+
+// DecodeWithOptions decodes the requests like Decode with the given options
+func DecodeWithOptions(model interface{}, options Options) gokitHttp.DecodeRequestFunc {
 	return func(ctx context.Context, r *http.Request) (interface{}, error) {
 		if model == nil {
 			return nil, nil
@@ -42,7 +55,7 @@ func Decode(model interface{}) gokitHttp.DecodeRequestFunc {
 			return nil, err
 		}
 
-		err = getURLQueryString(ctx, model, r)
+		err = getURLQueryString(ctx, model, r, options)
 		if nil != err {
 			return nil, err
 		}
@@ -105,7 +118,12 @@ func getURLParam(ctx context.Context, model interface{}, r *http.Request) error
 	return nil
 }
 
-func getURLQueryString(ctx context.Context, model interface{}, r *http.Request) error {
+func getURLQueryString(ctx context.Context, model interface{}, r *http.Request, options Options) error {
+	if options.TypedQueryString {
+		// the fields of a type the query cannot be decoded into are skipped, as they are by assignValue
+		return querystring.Decoder{SkipUnsupported: true}.Decode(r.URL.Query(), model)
+	}
+
 	var err error
 
 	typeOf := reflect.TypeOf(model)
@@ -0,0 +1,130 @@
+package decoding
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type searchRequest struct {
+	Page     int        `qs:"page"`
+	Limit    *int64     `qs:"limit"`
+	Keyword  string     `qs:"keyword"`
+	Active   bool       `qs:"active"`
+	ID       uuid.UUID  `qs:"id"`
+	MinPrice float64    `qs:"min_price"`
+	From     time.Time  `qs:"from"`
+	To       *time.Time `qs:"to"`
+	Tags     []string   `qs:"tags"`
+	Token    string     `header:"Authorization"`
+}
+
+func TestDecodeQueryString(t *testing.T) {
+	id := uuid.New()
+	limit := int64(20)
+	from := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	to := time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		query   string
+		options Options
+		want    searchRequest
+		wantErr bool
+	}{
+		{
+			name:  "supported fields parsed",
+			query: "page=2&limit=20&keyword=aspirin&active=true&id=" + id.String(),
+			want:  searchRequest{Page: 2, Limit: &limit, Keyword: "aspirin", Active: true, ID: id},
+		},
+		{
+			name:  "float, time and slice fields skipped by default",
+			query: "page=2&min_price=1.5&from=2023-01-02T03:04:05Z&to=2023-02-01T00:00:00Z&tags=a&tags=b",
+			want:  searchRequest{Page: 2},
+		},
+		{
+			name:  "invalid float skipped by default",
+			query: "page=2&min_price=cheap",
+			want:  searchRequest{Page: 2},
+		},
+		{
+			name:    "invalid int",
+			query:   "page=second",
+			wantErr: true,
+		},
+		{
+			name:    "float, time and slice fields parsed by the typed query string",
+			query:   "page=2&min_price=1.5&from=2023-01-02T03:04:05Z&to=2023-02-01T00:00:00Z&tags=a&tags=b",
+			options: Options{TypedQueryString: true},
+			want:    searchRequest{Page: 2, MinPrice: 1.5, From: from, To: &to, Tags: []string{"a", "b"}},
+		},
+		{
+			name:    "invalid float with the typed query string",
+			query:   "min_price=cheap",
+			options: Options{TypedQueryString: true},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/drugs?"+test.query, nil)
+			r.Header.Set("Authorization", "Bearer token")
+
+			model := &searchRequest{}
+			_, err := DecodeWithOptions(model, test.options)(context.Background(), r)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error = %v, want error %t", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+
+			test.want.Token = "Bearer token"
+			if model.Page != test.want.Page || model.Keyword != test.want.Keyword || model.Active != test.want.Active ||
+				model.ID != test.want.ID || model.MinPrice != test.want.MinPrice || !model.From.Equal(test.want.From) ||
+				model.Token != test.want.Token || len(model.Tags) != len(test.want.Tags) {
+				t.Errorf("model = %+v, want %+v", *model, test.want)
+			}
+			if (model.Limit == nil) != (test.want.Limit == nil) || model.Limit != nil && *model.Limit != *test.want.Limit {
+				t.Errorf("limit = %v, want %v", model.Limit, test.want.Limit)
+			}
+			if (model.To == nil) != (test.want.To == nil) || model.To != nil && !model.To.Equal(*test.want.To) {
+				t.Errorf("to = %v, want %v", model.To, test.want.To)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		model   interface{}
+		body    string
+		wantErr bool
+	}{
+		{name: "nil model", model: nil},
+		{name: "pointer model", model: &searchRequest{}, body: `{"Keyword":"aspirin"}`},
+		{name: "non pointer model", model: searchRequest{}, wantErr: true},
+		{name: "invalid json", model: &searchRequest{}, body: `{`, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/drugs", nil)
+			if test.body != "" {
+				r = httptest.NewRequest("POST", "/drugs", strings.NewReader(test.body))
+				r.Header.Set("Content-Type", "application/json")
+			}
+
+			_, err := Decode(test.model)(context.Background(), r)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error = %v, want error %t", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,349 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+	libError "github.com/medicplus-inc/medicplus-kit/error"
+	"github.com/medicplus-inc/medicplus-kit/net/http/encoding"
+)
+
+// HeaderIdempotencyKey is the header identifying a request across its retries
+const HeaderIdempotencyKey = "Idempotency-Key"
+
+// HeaderIdempotentReplayed is set on the responses replayed for the duplicated requests
+const HeaderIdempotentReplayed = "Idempotent-Replayed"
+
+// DefaultRedisIdempotencyPrefix is the prefix of the keys of the idempotent responses in redis
+const DefaultRedisIdempotencyPrefix = "idempotency:"
+
+// Errors of the rejected idempotent requests
+var (
+	ErrIdempotentRequestInFlight = errors.New("a request with the same idempotency key is in progress")
+	ErrIdempotencyKeyReused      = errors.New("the idempotency key was used by another request")
+	ErrInvalidIdempotencyKey     = errors.New("the idempotency key is longer than 255 characters")
+)
+
+//
+// Private constants
+//
+
+const defaultIdempotencyTTL = 24 * time.Hour
+const defaultIdempotencyLockTimeout = time.Minute
+const maxIdempotencyKeyLength = 255
+const defaultIdempotencyMaxBodySize = 10 << 20
+
+const idempotencyProcessing = "processing"
+const idempotencyCompleted = "completed"
+
+// completeIdempotencyScript replaces the lock ARGV[1] of the request by its response ARGV[2] stored for ARGV[3] ms,
+// or releases it when the response is empty, unless the lock expired and was taken by another request
+const completeIdempotencyScript = `
+if redis.call("get", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+if ARGV[2] == "" then
+	redis.call("del", KEYS[1])
+else
+	redis.call("set", KEYS[1], ARGV[2], "px", ARGV[3])
+end
+return 1
+`
+
+//
+// Private variables
+//
+
+// defaultUnstoredStatusCodes are the statuses of the requests the handler did not complete,
+// which the retries of the request, e.g. with a refreshed token, must reach the handler again
+var defaultUnstoredStatusCodes = []int{
+	http.StatusUnauthorized,
+	http.StatusForbidden,
+	http.StatusRequestTimeout,
+	http.StatusConflict,
+	http.StatusTooEarly,
+	http.StatusTooManyRequests,
+}
+
+// IdempotencyConfig represents the idempotency of the requests, zero values fall back to the defaults
+type IdempotencyConfig struct {
+	// TTL is how long the responses are replayed, 24h by default
+	TTL time.Duration
+	// LockTimeout is how long a request is considered in progress when its replica dies before responding,
+	// 1 min by default
+	LockTimeout time.Duration
+	// Prefix is the prefix of the redis keys, DefaultRedisIdempotencyPrefix by default
+	Prefix string
+	// Methods are the methods of the idempotent requests, POST and PATCH by default
+	Methods []string
+	// Scope returns the scope of the keys of the request, e.g. the id of the authenticated user,
+	// so that the keys of different callers do not collide; the keys are global when nil
+	Scope func(r *http.Request) string
+	// UnstoredStatusCodes are the statuses of the responses which are not stored, in addition to the 5xx ones,
+	// 401, 403, 408, 409, 425 and 429 by default
+	UnstoredStatusCodes []int
+	// MaxBodySize is the max number of bytes of the body of the requests, 10 MB by default and unlimited when negative;
+	// the responses with a larger body are not stored
+	MaxBodySize int64
+}
+
+// idempotentRecord represents the state of an idempotency key stored in redis
+type idempotentRecord struct {
+	Status      string      `json:"status"`
+	Lock        string      `json:"lock,omitempty"`
+	Fingerprint string      `json:"fingerprint"`
+	StatusCode  int         `json:"statusCode,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+// responseRecorder writes the response through while recording it, up to maxBodySize bytes of body when positive
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	body        bytes.Buffer
+	maxBodySize int64
+	overflowed  bool
+}
+
+// WriteHeader writes and records the status code
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	if r.statusCode == 0 {
+		r.statusCode = statusCode
+	}
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write writes and records the body
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	if r.statusCode == 0 {
+		r.statusCode = http.StatusOK
+	}
+	if !r.overflowed {
+		if r.maxBodySize > 0 && int64(r.body.Len()+len(p)) > r.maxBodySize {
+			r.overflowed = true
+			r.body.Reset()
+		} else {
+			r.body.Write(p)
+		}
+	}
+
+	return r.ResponseWriter.Write(p)
+}
+
+// Flush sends the buffered response to the client when the underlying writer supports it
+func (r *responseRecorder) Flush() {
+	if r.statusCode == 0 {
+		r.statusCode = http.StatusOK
+	}
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Idempotency stores in redis the first response of the requests carrying an Idempotency-Key header and replays it,
+// with the Idempotent-Replayed header, for the duplicated requests sent with the same key.
+//
+// A duplicate sent while the first request is in progress is rejected with 409, and a key reused with another
+// method, path or body with 422. The 5xx responses and the ones of the UnstoredStatusCodes, such as 401 or 429,
+// are not stored so that the request can be retried, nor the ones larger than the MaxBodySize;
+// the Set-Cookie header is never stored.
+// The requests are rejected with 503 when redis fails, and with 413 when their body is larger than the MaxBodySize.
+func Idempotency(redisClient *redis.Client, config IdempotencyConfig) func(http.Handler) http.Handler {
+	if config.TTL == 0 {
+		config.TTL = defaultIdempotencyTTL
+	}
+	if config.LockTimeout == 0 {
+		config.LockTimeout = defaultIdempotencyLockTimeout
+	}
+	if config.Prefix == "" {
+		config.Prefix = DefaultRedisIdempotencyPrefix
+	}
+	if config.Methods == nil {
+		config.Methods = []string{http.MethodPost, http.MethodPatch}
+	}
+	if config.UnstoredStatusCodes == nil {
+		config.UnstoredStatusCodes = defaultUnstoredStatusCodes
+	}
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = defaultIdempotencyMaxBodySize
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			idempotencyKey := r.Header.Get(HeaderIdempotencyKey)
+			if idempotencyKey == "" || !containsMethod(config.Methods, r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(idempotencyKey) > maxIdempotencyKeyLength {
+				encoding.EncodeError(ctx, libError.New(ErrInvalidIdempotencyKey, http.StatusBadRequest, "Invalid Idempotency-Key"), w)
+				return
+			}
+
+			var body []byte
+			if r.Body != nil {
+				reader := r.Body
+				if config.MaxBodySize > 0 {
+					reader = http.MaxBytesReader(w, r.Body, config.MaxBodySize)
+				}
+				var err error
+				body, err = ioutil.ReadAll(reader)
+				r.Body.Close()
+				if err != nil {
+					var maxBytesErr *http.MaxBytesError
+					if errors.As(err, &maxBytesErr) {
+						encoding.EncodeError(ctx, libError.New(err, http.StatusRequestEntityTooLarge, "Request body too large"), w)
+						return
+					}
+					encoding.EncodeError(ctx, libError.New(err, http.StatusBadRequest, "Invalid request body"), w)
+					return
+				}
+				r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			}
+
+			key := config.Prefix
+			if config.Scope != nil {
+				key += config.Scope(r) + ":"
+			}
+			key += idempotencyKey
+			fingerprint := requestFingerprint(r, body)
+
+			lock, err := json.Marshal(idempotentRecord{
+				Status:      idempotencyProcessing,
+				Lock:        uuid.New().String(),
+				Fingerprint: fingerprint,
+			})
+			if err != nil {
+				encoding.EncodeError(ctx, err, w)
+				return
+			}
+
+			acquired, err := redisClient.WithContext(ctx).SetNX(key, lock, config.LockTimeout).Result()
+			if err != nil {
+				encoding.EncodeError(ctx, libError.New(err, http.StatusServiceUnavailable, "Service Unavailable"), w)
+				return
+			}
+			if !acquired {
+				replayIdempotentResponse(w, r, redisClient.WithContext(ctx), key, fingerprint)
+				return
+			}
+
+			recorder := &responseRecorder{ResponseWriter: w, maxBodySize: config.MaxBodySize}
+			completed := false
+			defer func() {
+				// the lock is released when the handler panics or fails so that the request can be retried,
+				// even when the caller went away
+				var stored []byte
+				if completed && !recorder.overflowed && recorder.statusCode < http.StatusInternalServerError &&
+					!containsStatusCode(config.UnstoredStatusCodes, recorder.statusCode) {
+					header := recorder.Header().Clone()
+					header.Del("Set-Cookie")
+					stored, _ = json.Marshal(idempotentRecord{
+						Status:      idempotencyCompleted,
+						Fingerprint: fingerprint,
+						StatusCode:  recorder.statusCode,
+						Header:      header,
+						Body:        recorder.body.Bytes(),
+					})
+				}
+
+				err := redisClient.Eval(completeIdempotencyScript, []string{key}, string(lock), string(stored), config.TTL.Milliseconds()).Err()
+				if err != nil {
+					// the key stays locked until the LockTimeout, the duplicates being rejected with 409 meanwhile
+					log.Printf("Error while completing the idempotent request [%s]: %v", key, err)
+				}
+			}()
+
+			next.ServeHTTP(recorder, r)
+			if recorder.statusCode == 0 {
+				recorder.statusCode = http.StatusOK
+			}
+			completed = true
+		})
+	}
+}
+
+// replayIdempotentResponse writes the stored response of the key, or rejects the request
+// when the first request is in progress or was another request
+func replayIdempotentResponse(w http.ResponseWriter, r *http.Request, redisClient *redis.Client, key string, fingerprint string) {
+	ctx := r.Context()
+
+	stored, err := redisClient.Get(key).Bytes()
+	if err == redis.Nil {
+		// the lock of the first request expired or was released meanwhile
+		encoding.EncodeError(ctx, libError.New(ErrIdempotentRequestInFlight, http.StatusConflict, "Request in progress"), w)
+		return
+	}
+	if err != nil {
+		encoding.EncodeError(ctx, libError.New(err, http.StatusServiceUnavailable, "Service Unavailable"), w)
+		return
+	}
+
+	var record idempotentRecord
+	if err = json.Unmarshal(stored, &record); err != nil {
+		encoding.EncodeError(ctx, err, w)
+		return
+	}
+
+	if record.Fingerprint != fingerprint {
+		encoding.EncodeError(ctx, libError.New(ErrIdempotencyKeyReused, http.StatusUnprocessableEntity, "Idempotency-Key reused"), w)
+		return
+	}
+	if record.Status != idempotencyCompleted {
+		encoding.EncodeError(ctx, libError.New(ErrIdempotentRequestInFlight, http.StatusConflict, "Request in progress"), w)
+		return
+	}
+
+	for name, values := range record.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(HeaderIdempotentReplayed, "true")
+	w.WriteHeader(record.StatusCode)
+	_, _ = w.Write(record.Body)
+}
+
+// requestFingerprint identifies the method, path and body of the request
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func containsMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsStatusCode(statusCodes []int, statusCode int) bool {
+	for _, code := range statusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+
+	return false
+}
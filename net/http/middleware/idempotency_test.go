@@ -0,0 +1,217 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+)
+
+// idempotencyRequest is a request sent through the idempotency middleware
+type idempotencyRequest struct {
+	method string
+	key    string
+	body   string
+}
+
+func (r idempotencyRequest) send(handler http.Handler) *httptest.ResponseRecorder {
+	method := r.method
+	if method == "" {
+		method = http.MethodPost
+	}
+	req := httptest.NewRequest(method, "/patients", strings.NewReader(r.body))
+	if r.key != "" {
+		req.Header.Set(HeaderIdempotencyKey, r.key)
+	}
+
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, req)
+
+	return res
+}
+
+func newIdempotencyRedis(t *testing.T) *redis.Client {
+	t.Helper()
+
+	redisClient := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	t.Cleanup(func() { redisClient.Close() })
+
+	return redisClient
+}
+
+func TestIdempotency(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       IdempotencyConfig
+		status       int
+		response     string
+		first        idempotencyRequest
+		second       idempotencyRequest
+		wantStatus   int
+		wantReplayed bool
+		wantCalls    int
+	}{
+		{
+			name:         "response replayed",
+			status:       http.StatusCreated,
+			response:     `{"id":1}`,
+			first:        idempotencyRequest{key: "key-1", body: `{"name":"Budi"}`},
+			second:       idempotencyRequest{key: "key-1", body: `{"name":"Budi"}`},
+			wantStatus:   http.StatusCreated,
+			wantReplayed: true,
+			wantCalls:    1,
+		},
+		{
+			name:       "key reused by another request",
+			status:     http.StatusCreated,
+			response:   `{"id":1}`,
+			first:      idempotencyRequest{key: "key-1", body: `{"name":"Budi"}`},
+			second:     idempotencyRequest{key: "key-1", body: `{"name":"Siti"}`},
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCalls:  1,
+		},
+		{
+			name:       "other key",
+			status:     http.StatusCreated,
+			first:      idempotencyRequest{key: "key-1"},
+			second:     idempotencyRequest{key: "key-2"},
+			wantStatus: http.StatusCreated,
+			wantCalls:  2,
+		},
+		{
+			name:       "unstored status",
+			status:     http.StatusTooManyRequests,
+			first:      idempotencyRequest{key: "key-1"},
+			second:     idempotencyRequest{key: "key-1"},
+			wantStatus: http.StatusTooManyRequests,
+			wantCalls:  2,
+		},
+		{
+			name:       "server error not stored",
+			status:     http.StatusInternalServerError,
+			first:      idempotencyRequest{key: "key-1"},
+			second:     idempotencyRequest{key: "key-1"},
+			wantStatus: http.StatusInternalServerError,
+			wantCalls:  2,
+		},
+		{
+			name:       "response larger than the max body size not stored",
+			config:     IdempotencyConfig{MaxBodySize: 16},
+			status:     http.StatusOK,
+			response:   strings.Repeat("a", 17),
+			first:      idempotencyRequest{key: "key-1"},
+			second:     idempotencyRequest{key: "key-1"},
+			wantStatus: http.StatusOK,
+			wantCalls:  2,
+		},
+		{
+			name:       "request without key",
+			status:     http.StatusCreated,
+			first:      idempotencyRequest{},
+			second:     idempotencyRequest{},
+			wantStatus: http.StatusCreated,
+			wantCalls:  2,
+		},
+		{
+			name:       "method not idempotent",
+			status:     http.StatusOK,
+			first:      idempotencyRequest{method: http.MethodPut, key: "key-1"},
+			second:     idempotencyRequest{method: http.MethodPut, key: "key-1"},
+			wantStatus: http.StatusOK,
+			wantCalls:  2,
+		},
+		{
+			name:       "request body larger than the max body size",
+			config:     IdempotencyConfig{MaxBodySize: 4},
+			status:     http.StatusCreated,
+			first:      idempotencyRequest{key: "key-1", body: "Budi"},
+			second:     idempotencyRequest{key: "key-2", body: "Budi Santoso"},
+			wantStatus: http.StatusRequestEntityTooLarge,
+			wantCalls:  1,
+		},
+		{
+			name:       "key longer than 255 characters",
+			status:     http.StatusCreated,
+			first:      idempotencyRequest{key: "key-1"},
+			second:     idempotencyRequest{key: strings.Repeat("k", 256)},
+			wantStatus: http.StatusBadRequest,
+			wantCalls:  1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			calls := 0
+			handler := Idempotency(newIdempotencyRedis(t), test.config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				w.Header().Set("Set-Cookie", "session=secret")
+				w.WriteHeader(test.status)
+				_, _ = w.Write([]byte(test.response))
+			}))
+
+			first := test.first.send(handler)
+			second := test.second.send(handler)
+
+			if second.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d: %s", second.Code, test.wantStatus, second.Body)
+			}
+			if replayed := second.Header().Get(HeaderIdempotentReplayed) == "true"; replayed != test.wantReplayed {
+				t.Errorf("replayed = %t, want %t", replayed, test.wantReplayed)
+			}
+			if test.wantReplayed && (!bytes.Equal(second.Body.Bytes(), first.Body.Bytes()) || second.Header().Get("Set-Cookie") != "") {
+				t.Errorf("replayed %q with cookie %q, want %q without cookie",
+					second.Body, second.Header().Get("Set-Cookie"), first.Body)
+			}
+			if calls != test.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, test.wantCalls)
+			}
+		})
+	}
+}
+
+func TestIdempotencyRequestInFlight(t *testing.T) {
+	redisClient := newIdempotencyRedis(t)
+	request := idempotencyRequest{key: "key-1", body: `{"name":"Budi"}`}
+
+	var duplicate *httptest.ResponseRecorder
+	var handler http.Handler
+	handler = Idempotency(redisClient, IdempotencyConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if duplicate == nil {
+			duplicate = request.send(handler)
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	if res := request.send(handler); res.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d", res.Code, http.StatusCreated)
+	}
+	if duplicate.Code != http.StatusConflict {
+		t.Errorf("status of the duplicate in flight = %d, want %d", duplicate.Code, http.StatusConflict)
+	}
+	if res := request.send(handler); res.Code != http.StatusCreated || res.Header().Get(HeaderIdempotentReplayed) != "true" {
+		t.Errorf("status = %d, want the replayed %d once completed", res.Code, http.StatusCreated)
+	}
+}
+
+func TestIdempotencyFlush(t *testing.T) {
+	handler := Idempotency(newIdempotencyRedis(t), IdempotencyConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("event: created\n\n"))
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("flush: %v", err)
+		}
+	}))
+
+	res := idempotencyRequest{key: "key-1"}.send(handler)
+	if !res.Flushed {
+		t.Errorf("response not flushed")
+	}
+
+	replayed := idempotencyRequest{key: "key-1"}.send(handler)
+	if replayed.Header().Get(HeaderIdempotentReplayed) != "true" || replayed.Body.String() != "event: created\n\n" {
+		t.Errorf("replayed %q, want the flushed response stored", replayed.Body)
+	}
+}
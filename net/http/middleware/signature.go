@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	libError "github.com/medicplus-inc/medicplus-kit/error"
+	"github.com/medicplus-inc/medicplus-kit/net/authentication/signature"
+	"github.com/medicplus-inc/medicplus-kit/net/http/encoding"
+)
+
+// noinspection ALL
+const (
+	KEY_SIGNATURE_KEY_ID = "medicplus-kit:signature-key-id"
+)
+
+// VerifySignature rejects with 401 the requests whose HMAC signature is missing, invalid, outside the clock skew
+// window, replayed or not covering the required headers of the verifier, and with 413 the ones whose body is larger
+// than the max body size of the verifier. The key id of the verified requests is stored in the context
+// under KEY_SIGNATURE_KEY_ID
+func VerifySignature(verifier *signature.Verifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			body, err := verifier.ReadBody(w, r)
+			if err != nil {
+				encoding.EncodeError(ctx, bodyError(err), w)
+				return
+			}
+
+			if err := verifier.Verify(r, body); err != nil {
+				encoding.EncodeError(ctx, signatureError(err), w)
+				return
+			}
+
+			ctx = context.WithValue(ctx, KEY_SIGNATURE_KEY_ID, r.Header.Get(signature.HeaderKeyID))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// bodyError returns 413 when the body is larger than the max body size of the verifier, 400 otherwise
+func bodyError(err error) *libError.Error {
+	if errors.Is(err, signature.ErrBodyTooLarge) {
+		return libError.New(err, http.StatusRequestEntityTooLarge, "Request body too large")
+	}
+
+	return libError.New(err, http.StatusBadRequest, "Invalid request body")
+}
+
+func signatureError(err error) *libError.Error {
+	for _, signatureErr := range []error{
+		signature.ErrMissingSignature,
+		signature.ErrUnknownKey,
+		signature.ErrExpiredSignature,
+		signature.ErrDigestMismatch,
+		signature.ErrInvalidSignature,
+		signature.ErrReplayedRequest,
+		signature.ErrUnsignedHeader,
+	} {
+		if errors.Is(err, signatureErr) {
+			return libError.New(err, http.StatusUnauthorized, "Invalid request signature")
+		}
+	}
+
+	return libError.New(err, http.StatusInternalServerError, "Something Went Wrong")
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/medicplus-inc/medicplus-kit/net/authentication/signature"
+)
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte(`{"name":"aspirin"}`)
+
+	tests := []struct {
+		name       string
+		sign       bool
+		body       []byte
+		wantStatus int
+	}{
+		{name: "signed request", sign: true, body: body, wantStatus: http.StatusOK},
+		{name: "unsigned request", body: body, wantStatus: http.StatusUnauthorized},
+		{name: "body larger than the max size", sign: true, body: bytes.Repeat([]byte("a"), 65), wantStatus: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			verifier := signature.NewVerifier(signature.VerifierConfig{
+				Keys:        signature.StaticKeyStore{"service-1": []byte("secret-1")},
+				Nonces:      signature.NewMemoryNonceStore(),
+				MaxBodySize: 64,
+			})
+			handler := VerifySignature(verifier)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received, _ := ioutil.ReadAll(r.Body)
+				if !bytes.Equal(received, test.body) {
+					t.Errorf("handler read %q, want %q", received, test.body)
+				}
+				if keyID := r.Context().Value(KEY_SIGNATURE_KEY_ID); keyID != "service-1" {
+					t.Errorf("key id in the context = %v", keyID)
+				}
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/drugs", bytes.NewReader(test.body))
+			if test.sign {
+				signature.NewSigner("service-1", []byte("secret-1")).Sign(req, test.body)
+			}
+
+			res := httptest.NewRecorder()
+			handler.ServeHTTP(res, req)
+			if res.Code != test.wantStatus {
+				t.Errorf("status = %d, want %d: %s", res.Code, test.wantStatus, res.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,455 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/medicplus-inc/medicplus-kit/client"
+)
+
+// TestingT is the part of testing.TB used by the mock and its assertions
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	Fatalf(format string, args ...interface{})
+}
+
+// the mock is a double of the client
+var _ client.GenericHTTPClient = (*Mock)(nil)
+var _ client.StreamingHTTPClient = (*Mock)(nil)
+
+// Call represents a call received by the mock
+type Call struct {
+	// Function is the name of the method of client.GenericHTTPClient which was called
+	Function string
+	Method   client.Method
+	// Path is the path of the call, or its url for CallClientWithBaseURLGiven and Do
+	Path string
+	// Request is the request given to the call, or its body for CallClientWithRequestInBytes, Stream and Do
+	Request interface{}
+	// CacheKey is the path stored as key given to CallClientWithCachingInRedisWithDifferentKey
+	CacheKey string
+}
+
+// Expectation represents the canned outcome of the calls matching a method and a path
+type Expectation struct {
+	t           TestingT
+	method      client.Method
+	path        string
+	response    []byte
+	contentType string
+	errDo       *client.ResponseError
+	status      int
+	match       func(call Call) bool
+	run         func(call Call)
+	times       int
+	calls       int
+}
+
+// Return sets the response of the calls, decoded into their result: a string or []byte is the raw body,
+// other values are encoded into json first and fail the test when they cannot be
+func (e *Expectation) Return(response interface{}) *Expectation {
+	switch body := response.(type) {
+	case string:
+		e.response = []byte(body)
+	case []byte:
+		e.response = body
+	default:
+		data, err := json.Marshal(response)
+		if err != nil {
+			e.t.Helper()
+			e.t.Fatalf("httpclient: cannot encode the response of %s %s: %v", e.method, e.path, err)
+			return e
+		}
+		e.response = data
+	}
+
+	return e
+}
+
+// ContentType sets the content type of the response, which selects its codec like the client does,
+// application/json by default
+func (e *Expectation) ContentType(contentType string) *Expectation {
+	e.contentType = contentType
+
+	return e
+}
+
+// ReturnStatus makes the calls fail with the status code and the body of the upstream,
+// decoded into the response error like the real client does
+func (e *Expectation) ReturnStatus(statusCode int, body string) *Expectation {
+	e.status = statusCode
+	e.response = []byte(body)
+
+	return e
+}
+
+// ReturnError makes the calls fail with the response error
+func (e *Expectation) ReturnError(errDo *client.ResponseError) *Expectation {
+	e.errDo = errDo
+
+	return e
+}
+
+// Match restricts the expectation to the calls accepted by the matcher, e.g. on their request
+func (e *Expectation) Match(match func(call Call) bool) *Expectation {
+	e.match = match
+
+	return e
+}
+
+// Run calls fn with every matched call before returning its outcome
+func (e *Expectation) Run(fn func(call Call)) *Expectation {
+	e.run = fn
+
+	return e
+}
+
+// Times limits the expectation to n calls, which AssertExpectations checks were all made
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+
+	return e
+}
+
+// Once limits the expectation to a single call
+func (e *Expectation) Once() *Expectation {
+	return e.Times(1)
+}
+
+// matches reports whether the call matches the expectation and the expectation can still be used
+func (e *Expectation) matches(call Call) bool {
+	if e.method != call.Method || !matchPath(e.path, call.Path) {
+		return false
+	}
+	if e.times > 0 && e.calls >= e.times {
+		return false
+	}
+
+	return e.match == nil || e.match(call)
+}
+
+// Mock is a scriptable client.GenericHTTPClient for the tests of the code using the client.
+//
+// The calls are matched against the expectations in their order of declaration, the paths being compared
+// with path.Match so that "patients/*" matches "patients/1"; the query is ignored unless the expectation has one,
+// which must then equal the query of the call whatever the order of its parameters.
+// A call without expectation fails with a 404 response error and is reported by AssertExpectations.
+//
+// The responses are decoded like the client does with the call options carried by the context
+// (see client.WithCallOptions), e.g. client.WithEnvelope unwraps their `data`.
+type Mock struct {
+	t               TestingT
+	mutex           sync.Mutex
+	expectations    []*Expectation
+	calls           []Call
+	unexpected      []Call
+	authentications []client.AuthorizationType
+}
+
+// NewMock creates a mock without expectation, failing the test on its invalid expectations
+func NewMock(t TestingT) *Mock {
+	return &Mock{t: t}
+}
+
+// On adds the expectation of the calls of the method and the path, which succeed without response by default
+func (m *Mock) On(method client.Method, path string) *Expectation {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	expectation := &Expectation{
+		t:           m.t,
+		method:      method,
+		path:        path,
+		contentType: "application/json",
+	}
+	m.expectations = append(m.expectations, expectation)
+
+	return expectation
+}
+
+// Calls returns the calls received by the mock
+func (m *Mock) Calls() []Call {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return append([]Call{}, m.calls...)
+}
+
+// CallsTo returns the calls received for the method and the path, matched like the expectations
+func (m *Mock) CallsTo(method client.Method, path string) []Call {
+	calls := []Call{}
+	for _, call := range m.Calls() {
+		if call.Method == method && matchPath(path, call.Path) {
+			calls = append(calls, call)
+		}
+	}
+
+	return calls
+}
+
+// Authentications returns the authorizations added with AddAuthentication
+func (m *Mock) Authentications() []client.AuthorizationType {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return append([]client.AuthorizationType{}, m.authentications...)
+}
+
+// AssertExpectations checks that every expectation was called, as many times as given with Times,
+// and that no call was made without expectation
+func (m *Mock) AssertExpectations(t TestingT) bool {
+	t.Helper()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	ok := true
+	for _, e := range m.expectations {
+		if e.calls == 0 || e.times > 0 && e.calls != e.times {
+			expected := "at least once"
+			if e.times > 0 {
+				expected = strconv.Itoa(e.times) + " times"
+			}
+			t.Errorf("httpclient: expected %s %s to be called %s, called %d times", e.method, e.path, expected, e.calls)
+			ok = false
+		}
+	}
+	for _, call := range m.unexpected {
+		t.Errorf("httpclient: unexpected call %s %s (%s)", call.Method, call.Path, call.Function)
+		ok = false
+	}
+
+	return ok
+}
+
+// AssertCalled checks that the method and the path were called
+func (m *Mock) AssertCalled(t TestingT, method client.Method, path string) bool {
+	t.Helper()
+
+	if len(m.CallsTo(method, path)) == 0 {
+		t.Errorf("httpclient: expected %s %s to be called", method, path)
+		return false
+	}
+
+	return true
+}
+
+// AssertNotCalled checks that the method and the path were not called
+func (m *Mock) AssertNotCalled(t TestingT, method client.Method, path string) bool {
+	t.Helper()
+
+	if calls := len(m.CallsTo(method, path)); calls > 0 {
+		t.Errorf("httpclient: expected %s %s not to be called, called %d times", method, path, calls)
+		return false
+	}
+
+	return true
+}
+
+// AssertNumberOfCalls checks that the method and the path were called n times
+func (m *Mock) AssertNumberOfCalls(t TestingT, method client.Method, path string, n int) bool {
+	t.Helper()
+
+	if calls := len(m.CallsTo(method, path)); calls != n {
+		t.Errorf("httpclient: expected %s %s to be called %d times, called %d times", method, path, n, calls)
+		return false
+	}
+
+	return true
+}
+
+// Do returns the response of the expectation of the request
+func (m *Mock) Do(req *http.Request) (string, *client.ResponseError) {
+	var body []byte
+	if req.Body != nil {
+		body, _ = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+	}
+
+	var response []byte
+	errDo := m.call(req.Context(), Call{Function: "Do", Method: client.Method(req.Method), Path: req.URL.String(), Request: body}, &response)
+	if errDo.Err() != nil {
+		return "", errDo
+	}
+
+	return string(response), errDo
+}
+
+// CallClient returns the outcome of the expectation of the call
+func (m *Mock) CallClient(ctx context.Context, path string, method client.Method, request interface{}, result interface{}, isAcknowledgeNeeded bool) *client.ResponseError {
+	return m.call(ctx, Call{Function: "CallClient", Method: method, Path: path, Request: request}, result)
+}
+
+// CallClientWithCachingInRedis returns the outcome of the expectation of the call, without caching
+func (m *Mock) CallClientWithCachingInRedis(ctx context.Context, durationInSecond int, path string, method client.Method, request interface{}, result interface{}, isAcknowledgeNeeded bool) *client.ResponseError {
+	return m.call(ctx, Call{Function: "CallClientWithCachingInRedis", Method: method, Path: path, Request: request}, result)
+}
+
+// CallClientWithCachingInRedisWithDifferentKey returns the outcome of the expectation of the call, without caching
+func (m *Mock) CallClientWithCachingInRedisWithDifferentKey(ctx context.Context, durationInSecond int, path string, pathToBeStoredAsKey string, method client.Method, request interface{}, result interface{}, isAcknowledgeNeeded bool) *client.ResponseError {
+	return m.call(ctx, Call{Function: "CallClientWithCachingInRedisWithDifferentKey", Method: method, Path: path, Request: request, CacheKey: pathToBeStoredAsKey}, result)
+}
+
+// CallClientWithCircuitBreaker returns the outcome of the expectation of the call
+func (m *Mock) CallClientWithCircuitBreaker(ctx context.Context, path string, method client.Method, request interface{}, result interface{}, isAcknowledgeNeeded bool) *client.ResponseError {
+	return m.call(ctx, Call{Function: "CallClientWithCircuitBreaker", Method: method, Path: path, Request: request}, result)
+}
+
+// CallClientWithBaseURLGiven returns the outcome of the expectation of the call, matched on its url
+func (m *Mock) CallClientWithBaseURLGiven(ctx context.Context, url string, method client.Method, request interface{}, result interface{}, isAcknowledgeNeeded bool) *client.ResponseError {
+	return m.call(ctx, Call{Function: "CallClientWithBaseURLGiven", Method: method, Path: url, Request: request}, result)
+}
+
+// CallClientWithRequestInBytes returns the outcome of the expectation of the call
+func (m *Mock) CallClientWithRequestInBytes(ctx context.Context, path string, method client.Method, request []byte, result interface{}) *client.ResponseError {
+	return m.call(ctx, Call{Function: "CallClientWithRequestInBytes", Method: method, Path: path, Request: request}, result)
+}
+
+// Stream returns the response of the expectation of the call as stream, the body is read to be recorded
+func (m *Mock) Stream(ctx context.Context, path string, method client.Method, contentType string, body io.Reader, opts ...client.CallOption) (*client.StreamResponse, *client.ResponseError) {
+	var request []byte
+	if body != nil {
+		request, _ = ioutil.ReadAll(body)
+	}
+
+	var response []byte
+	expectation, errDo := m.respond(ctx, Call{Function: "Stream", Method: method, Path: path, Request: request}, &response, opts...)
+	if errDo.Err() != nil {
+		return nil, errDo
+	}
+
+	header := http.Header{}
+	if expectation != nil {
+		header.Set("Content-Type", expectation.contentType)
+	}
+
+	return &client.StreamResponse{
+		StatusCode: http.StatusOK,
+		Header:     header,
+		Body:       ioutil.NopCloser(bytes.NewReader(response)),
+	}, errDo
+}
+
+// AddAuthentication records the authorization
+func (m *Mock) AddAuthentication(ctx context.Context, authorizationType client.AuthorizationType) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.authentications = append(m.authentications, authorizationType)
+}
+
+// call records the call and returns the outcome of its expectation, decoding the response into the result
+func (m *Mock) call(ctx context.Context, call Call, result interface{}, opts ...client.CallOption) *client.ResponseError {
+	_, errDo := m.respond(ctx, call, result, opts...)
+
+	return errDo
+}
+
+// respond records the call and returns its expectation and the outcome of the expectation,
+// decoding the response into the result
+func (m *Mock) respond(ctx context.Context, call Call, result interface{}, opts ...client.CallOption) (*Expectation, *client.ResponseError) {
+	m.mutex.Lock()
+	m.calls = append(m.calls, call)
+
+	var expectation *Expectation
+	for _, e := range m.expectations {
+		if e.matches(call) {
+			expectation = e
+			break
+		}
+	}
+	if expectation == nil {
+		m.unexpected = append(m.unexpected, call)
+		m.mutex.Unlock()
+
+		return nil, &client.ResponseError{
+			Code:       strconv.Itoa(http.StatusNotFound),
+			Message:    fmt.Sprintf("no expectation for %s %s", call.Method, call.Path),
+			StatusCode: http.StatusNotFound,
+			Error:      fmt.Errorf("httpclient: no expectation for %s %s", call.Method, call.Path),
+		}
+	}
+	expectation.calls++
+	m.mutex.Unlock()
+
+	if expectation.run != nil {
+		expectation.run(call)
+	}
+
+	if expectation.errDo != nil {
+		return expectation, expectation.errDo
+	}
+	if expectation.status >= 300 || expectation.status > 0 && expectation.status < 200 {
+		return expectation, statusError(expectation.status, expectation.response, call.Path)
+	}
+
+	if err := client.DecodeResponse(ctx, expectation.response, expectation.contentType, result, opts...); err != nil {
+		return expectation, &client.ResponseError{
+			Error: err,
+		}
+	}
+
+	status := expectation.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	return expectation, &client.ResponseError{
+		Code:       strconv.Itoa(status),
+		StatusCode: status,
+	}
+}
+
+// statusError builds the response error of a failed status like the client does
+func statusError(statusCode int, body []byte, path string) *client.ResponseError {
+	errDo := &client.ResponseError{
+		Code:       strconv.Itoa(statusCode),
+		StatusCode: statusCode,
+	}
+	if len(body) > 0 {
+		_ = json.Unmarshal(body, errDo)
+	}
+	if errDo.Info != "" {
+		errDo.Message = errDo.Info
+	}
+	errDo.Error = fmt.Errorf("Error while calling %s: %v", path, errDo.Message)
+
+	return errDo
+}
+
+// matchPath matches the path against the pattern with path.Match, ignoring the leading slashes,
+// and the query against the query of the pattern when it has one, whatever the order of the parameters
+func matchPath(pattern string, p string) bool {
+	patternPath, patternQuery, hasQuery := strings.Cut(strings.TrimPrefix(pattern, "/"), "?")
+	callPath, callQuery, _ := strings.Cut(strings.TrimPrefix(p, "/"), "?")
+
+	if patternPath != callPath {
+		matched, err := path.Match(patternPath, callPath)
+		if err != nil || !matched {
+			return false
+		}
+	}
+	if !hasQuery {
+		return true
+	}
+
+	want, err := url.ParseQuery(patternQuery)
+	if err != nil {
+		return false
+	}
+	got, err := url.ParseQuery(callQuery)
+
+	return err == nil && reflect.DeepEqual(want, got)
+}
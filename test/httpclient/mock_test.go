@@ -0,0 +1,226 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/medicplus-inc/medicplus-kit/client"
+)
+
+// recordingT records the failures of the mock instead of failing the test
+type recordingT struct {
+	errors []string
+	fatals []string
+}
+
+func (r *recordingT) Helper() {}
+
+func (r *recordingT) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *recordingT) Fatalf(format string, args ...interface{}) {
+	r.fatals = append(r.fatals, fmt.Sprintf(format, args...))
+}
+
+type patient struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{pattern: "patients/1", path: "/patients/1", want: true},
+		{pattern: "/patients/*", path: "patients/1", want: true},
+		{pattern: "patients/*", path: "patients/1/visits"},
+		{pattern: "patients/*", path: "patients/1?page=2", want: true},
+		{pattern: "patients?page=2&limit=10", path: "patients?limit=10&page=2", want: true},
+		{pattern: "patients/*?page=2", path: "patients/1?page=2", want: true},
+		{pattern: "patients?page=2", path: "patients?page=3"},
+		{pattern: "patients?page=2", path: "patients"},
+		{pattern: "patients?page=2", path: "patients?page=2&limit=10"},
+		{pattern: "http://api.local/patients/*", path: "http://api.local/patients/1?page=2", want: true},
+		{pattern: "patients/[", path: "patients/[", want: true},
+		{pattern: "patients/[", path: "patients/1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pattern+" "+test.path, func(t *testing.T) {
+			if got := matchPath(test.pattern, test.path); got != test.want {
+				t.Errorf("matchPath(%q, %q) = %t, want %t", test.pattern, test.path, got, test.want)
+			}
+		})
+	}
+}
+
+func TestMock(t *testing.T) {
+	tests := []struct {
+		name       string
+		expect     func(m *Mock)
+		ctx        context.Context
+		call       func(ctx context.Context, m *Mock, result interface{}) *client.ResponseError
+		want       patient
+		wantStatus int
+		wantErr    bool
+	}{
+		{
+			name:   "response encoded into json",
+			expect: func(m *Mock) { m.On(client.GET, "patients/*").Return(patient{ID: 1, Name: "Budi"}) },
+			call: func(ctx context.Context, m *Mock, result interface{}) *client.ResponseError {
+				return m.CallClient(ctx, "patients/1", client.GET, nil, result, false)
+			},
+			want:       patient{ID: 1, Name: "Budi"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:   "envelope unwrapped with the options of the context",
+			expect: func(m *Mock) { m.On(client.GET, "patients/1").Return(`{"data":{"id":1},"metadata":{"page":1}}`) },
+			ctx:    client.WithCallOptions(context.Background(), client.WithEnvelope()),
+			call: func(ctx context.Context, m *Mock, result interface{}) *client.ResponseError {
+				return m.CallClientWithCircuitBreaker(ctx, "patients/1", client.GET, nil, result, false)
+			},
+			want:       patient{ID: 1},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "response decoded with the codec of its content type",
+			expect: func(m *Mock) {
+				m.On(client.GET, "patients/1").Return(`<patient><ID>2</ID></patient>`).ContentType("application/xml")
+			},
+			call: func(ctx context.Context, m *Mock, result interface{}) *client.ResponseError {
+				return m.CallClientWithCachingInRedis(ctx, 60, "patients/1", client.GET, nil, result, false)
+			},
+			want:       patient{ID: 2},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "failed status",
+			expect: func(m *Mock) {
+				m.On(client.POST, "patients").ReturnStatus(http.StatusBadRequest, `{"message":"invalid"}`)
+			},
+			call: func(ctx context.Context, m *Mock, result interface{}) *client.ResponseError {
+				return m.CallClient(ctx, "patients", client.POST, patient{}, result, false)
+			},
+			wantStatus: http.StatusBadRequest,
+			wantErr:    true,
+		},
+		{
+			name:   "invalid response",
+			expect: func(m *Mock) { m.On(client.GET, "patients/1").Return(`{`) },
+			call: func(ctx context.Context, m *Mock, result interface{}) *client.ResponseError {
+				return m.CallClient(ctx, "patients/1", client.GET, nil, result, false)
+			},
+			wantErr: true,
+		},
+		{
+			name:   "call without expectation",
+			expect: func(m *Mock) { m.On(client.GET, "patients/1") },
+			call: func(ctx context.Context, m *Mock, result interface{}) *client.ResponseError {
+				return m.CallClient(ctx, "patients/2", client.GET, nil, result, false)
+			},
+			wantStatus: http.StatusNotFound,
+			wantErr:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mock := NewMock(t)
+			test.expect(mock)
+			ctx := test.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+
+			result := patient{}
+			errDo := test.call(ctx, mock, &result)
+			if (errDo.Err() != nil) != test.wantErr {
+				t.Fatalf("error = %v, want error %t", errDo.Err(), test.wantErr)
+			}
+			if errDo.StatusCode != test.wantStatus {
+				t.Errorf("status = %d, want %d", errDo.StatusCode, test.wantStatus)
+			}
+			if result != test.want {
+				t.Errorf("result = %+v, want %+v", result, test.want)
+			}
+		})
+	}
+}
+
+func TestMockExpectations(t *testing.T) {
+	mock := NewMock(t)
+	mock.On(client.GET, "patients/*").Times(2)
+	mock.On(client.DELETE, "patients/1").Once()
+	authorization := client.Bearer
+
+	ctx := context.Background()
+	_ = mock.CallClient(ctx, "patients/1", client.GET, nil, nil, false)
+	_ = mock.CallClientWithBaseURLGiven(ctx, "patients/2", client.GET, nil, nil, false)
+	_ = mock.CallClient(ctx, "patients/3", client.GET, nil, nil, false)
+	mock.AddAuthentication(ctx, authorization)
+
+	mock.AssertNumberOfCalls(t, client.GET, "patients/*", 3)
+	mock.AssertNotCalled(t, client.DELETE, "patients/1")
+	if authentications := mock.Authentications(); len(authentications) != 1 || authentications[0] != authorization {
+		t.Errorf("authentications = %v", authentications)
+	}
+
+	recorder := &recordingT{}
+	if mock.AssertExpectations(recorder) {
+		t.Errorf("AssertExpectations = true with a missing and an unexpected call")
+	}
+	if len(recorder.errors) != 2 {
+		t.Errorf("errors = %v, want the missing DELETE and the unexpected third GET", recorder.errors)
+	}
+}
+
+func TestMockReturnFailsTheTest(t *testing.T) {
+	recorder := &recordingT{}
+	mock := NewMock(recorder)
+
+	mock.On(client.GET, "patients/1").Return(map[string]interface{}{"channel": make(chan int)})
+
+	if len(recorder.fatals) != 1 {
+		t.Errorf("fatals = %v, want the encoding failure", recorder.fatals)
+	}
+}
+
+func TestMockStream(t *testing.T) {
+	mock := NewMock(t)
+	mock.On(client.GET, "patients/export").Return("id,name\n1,Budi\n").ContentType("text/csv")
+	mock.On(client.GET, "patients/failed").ReturnError(&client.ResponseError{Error: errors.New("unavailable")})
+
+	stream, errDo := mock.Stream(context.Background(), "patients/export", client.GET, "", nil)
+	if errDo.Err() != nil {
+		t.Fatalf("error = %v", errDo.Err())
+	}
+	defer stream.Body.Close()
+	body, _ := ioutil.ReadAll(stream.Body)
+	if string(body) != "id,name\n1,Budi\n" || stream.Header.Get("Content-Type") != "text/csv" {
+		t.Errorf("stream = %q with %q", body, stream.Header.Get("Content-Type"))
+	}
+
+	if _, errDo = mock.Stream(context.Background(), "patients/failed", client.GET, "", nil); errDo.Err() == nil {
+		t.Errorf("failed stream returned no error")
+	}
+}
+
+func TestMockDo(t *testing.T) {
+	mock := NewMock(t)
+	mock.On(client.GET, "http://api.local/patients?page=1").Return(`{"id":1}`)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://api.local/patients?page=1", nil)
+	response, errDo := mock.Do(req)
+	if errDo.Err() != nil || response != `{"id":1}` {
+		t.Errorf("Do = %q, %v", response, errDo.Err())
+	}
+	mock.AssertExpectations(t)
+}
@@ -0,0 +1,351 @@
+package httpclient
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/medicplus-inc/medicplus-kit/net/authentication/signature"
+)
+
+// Mode represents the enum for the mode of a recorder
+type Mode int
+
+// Enum value for recorder mode
+const (
+	// ModeReplay replays the golden file and fails the requests which were not recorded
+	ModeReplay Mode = iota
+	// ModeRecord sends the requests to the upstream and records them into the golden file, replacing it
+	ModeRecord
+	// ModeAuto records when the golden file does not exist and replays it otherwise
+	ModeAuto
+)
+
+// ErrNotRecorded is returned in replay mode for the requests missing from the golden file
+var ErrNotRecorded = errors.New("httpclient: request not recorded")
+
+//
+// Private variables
+//
+
+var defaultRecorderRedactedHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"Secret",
+	"X-Api-Key",
+	"Api-Key",
+	signature.HeaderSignature,
+	signature.HeaderKeyID,
+	signature.HeaderNonce,
+	signature.HeaderTimestamp,
+}
+
+var defaultRecorderRedactedQueryParams = []string{
+	"api_key",
+	"apikey",
+	"access_token",
+	"token",
+}
+
+// Interaction represents a request and its response stored in a golden file
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest represents a recorded request
+type RecordedRequest struct {
+	Method string       `json:"method"`
+	URL    string       `json:"url"`
+	Header http.Header  `json:"header,omitempty"`
+	Body   RecordedBody `json:"body,omitempty"`
+}
+
+// RecordedResponse represents a recorded response
+type RecordedResponse struct {
+	StatusCode int          `json:"statusCode"`
+	Header     http.Header  `json:"header,omitempty"`
+	Body       RecordedBody `json:"body,omitempty"`
+}
+
+// RecordedBody is a body stored as text, or base64 when it is binary
+type RecordedBody []byte
+
+// MarshalJSON encodes the body as text when it is valid utf-8, as {"base64": "..."} otherwise
+func (b RecordedBody) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		return json.Marshal(string(b))
+	}
+
+	return json.Marshal(map[string]string{"base64": base64.StdEncoding.EncodeToString(b)})
+}
+
+// UnmarshalJSON decodes the body stored as text or base64
+func (b *RecordedBody) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*b = []byte(text)
+		return nil
+	}
+
+	var encoded map[string]string
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded["base64"])
+	if err != nil {
+		return err
+	}
+	*b = decoded
+
+	return nil
+}
+
+// Recorder is an http.RoundTripper recording the real exchanges into a golden file and replaying them offline,
+// to be set as transport of the http client of a client.HTTPClient.
+//
+// The requests are replayed by method, url and body, in their recorded order; a request sent more times than
+// recorded gets its last recorded response. The values of the headers and query parameters redacted when recording
+// are replaced by "[REDACTED]", the query parameters being redacted the same way to match the replayed requests.
+type Recorder struct {
+	// Transport sends the requests when recording, http.DefaultTransport by default
+	Transport http.RoundTripper
+	// RedactHeaders are the headers redacted in addition to Authorization, Proxy-Authorization, Cookie,
+	// Set-Cookie, Secret, X-Api-Key, Api-Key and the signature headers X-Signature, X-Signature-Key-Id,
+	// X-Signature-Nonce and X-Signature-Timestamp
+	RedactHeaders []string
+	// RedactQueryParams are the query parameters redacted in addition to api_key, apikey, access_token and token,
+	// regardless of their case, e.g. the AuthorizationQueryParams of the client
+	RedactQueryParams []string
+
+	mutex        sync.Mutex
+	file         string
+	recording    bool
+	interactions []Interaction
+	replayed     map[int]bool
+	err          error
+}
+
+// NewRecorder creates the recorder of the golden file, e.g. "testdata/patients.json".
+// The golden file of a replaying recorder is read at its first request.
+func NewRecorder(file string, mode Mode) *Recorder {
+	recording := mode == ModeRecord
+	if mode == ModeAuto {
+		_, err := os.Stat(file)
+		recording = os.IsNotExist(err)
+	}
+
+	return &Recorder{
+		file:      file,
+		recording: recording,
+	}
+}
+
+// Recording reports whether the recorder records the requests rather than replaying them
+func (r *Recorder) Recording() bool {
+	return r.recording
+}
+
+// RoundTrip records or replays the request
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if r.recording {
+		return r.record(req, body)
+	}
+
+	return r.replay(req, body)
+}
+
+// record sends the request and appends the exchange to the golden file
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	outgoing := req.Clone(req.Context())
+	outgoing.Body = ioutil.NopCloser(bytes.NewReader(body))
+	res, err := transport.RoundTrip(outgoing)
+	if err != nil {
+		return nil, err
+	}
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(resBody))
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.interactions = append(r.interactions, Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			URL:    r.redactURL(req.URL),
+			Header: r.redact(req.Header),
+			Body:   body,
+		},
+		Response: RecordedResponse{
+			StatusCode: res.StatusCode,
+			Header:     r.redact(res.Header),
+			Body:       resBody,
+		},
+	})
+
+	if err = r.save(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// replay returns the recorded response of the request
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	recordedURL := r.redactURL(req.URL)
+	found := -1
+	for i, interaction := range r.interactions {
+		if interaction.Request.Method != req.Method || interaction.Request.URL != recordedURL ||
+			!bytes.Equal(interaction.Request.Body, body) {
+			continue
+		}
+
+		found = i
+		if !r.replayed[i] {
+			break
+		}
+	}
+	if found < 0 {
+		return nil, fmt.Errorf("%w: %s %s in %s", ErrNotRecorded, req.Method, recordedURL, r.file)
+	}
+	r.replayed[found] = true
+
+	recorded := r.interactions[found].Response
+	header := recorded.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(recorded.Body)),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}, nil
+}
+
+// load reads the golden file once
+func (r *Recorder) load() error {
+	if r.replayed != nil {
+		return r.err
+	}
+	r.replayed = map[int]bool{}
+
+	data, err := ioutil.ReadFile(r.file)
+	if err != nil {
+		r.err = err
+		return err
+	}
+	if err = json.Unmarshal(data, &r.interactions); err != nil {
+		r.err = fmt.Errorf("httpclient: invalid golden file %s: %w", r.file, err)
+	}
+
+	return r.err
+}
+
+// save writes the recorded interactions into the golden file
+func (r *Recorder) save() error {
+	data, err := json.MarshalIndent(r.interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(r.file), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(r.file, append(data, '\n'), 0644)
+}
+
+// redact returns a copy of the headers with the values of the redacted ones replaced
+func (r *Recorder) redact(header http.Header) http.Header {
+	redacted := header.Clone()
+	for _, name := range append(defaultRecorderRedactedHeaders, r.RedactHeaders...) {
+		if _, ok := redacted[http.CanonicalHeaderKey(name)]; ok {
+			redacted[http.CanonicalHeaderKey(name)] = []string{"[REDACTED]"}
+		}
+	}
+
+	return redacted
+}
+
+// redactURL returns the url with the values of the redacted query parameters replaced
+func (r *Recorder) redactURL(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.String()
+	}
+
+	query := u.Query()
+	redacted := false
+	for key, values := range query {
+		if !r.redactsQueryParam(key) {
+			continue
+		}
+		for i := range values {
+			values[i] = "[REDACTED]"
+		}
+		redacted = true
+	}
+	if !redacted {
+		return u.String()
+	}
+
+	recorded := *u
+	recorded.RawQuery = query.Encode()
+
+	return recorded.String()
+}
+
+func (r *Recorder) redactsQueryParam(key string) bool {
+	for _, name := range append(defaultRecorderRedactedQueryParams, r.RedactQueryParams...) {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,168 @@
+package httpclient
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Set-Cookie", "session=secret")
+		switch r.URL.Path {
+		case "/binary":
+			_, _ = w.Write([]byte{0xff, 0x00, 0xfe})
+		default:
+			_, _ = w.Write([]byte(`{"path":"` + r.URL.Path + `","body":"` + string(body) + `"}`))
+		}
+	}))
+	file := filepath.Join(t.TempDir(), "testdata", "patients.json")
+
+	recorder := NewRecorder(file, ModeAuto)
+	if !recorder.Recording() {
+		t.Fatalf("auto recorder replaying a missing golden file")
+	}
+	recorder.RedactHeaders = []string{"X-Tenant"}
+	recorder.RedactQueryParams = []string{"nik"}
+	recording := &http.Client{Transport: recorder}
+
+	requests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{method: http.MethodGet, path: "/patients?nik=3171&api_key=secret"},
+		{method: http.MethodPost, path: "/patients", body: "budi"},
+		{method: http.MethodGet, path: "/binary"},
+	}
+	recorded := map[string][]byte{}
+	for _, request := range requests {
+		req, _ := http.NewRequest(request.method, server.URL+request.path, strings.NewReader(request.body))
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("X-Tenant", "medicplus")
+		res, err := recording.Do(req)
+		if err != nil {
+			t.Fatalf("recording %s %s: %v", request.method, request.path, err)
+		}
+		recorded[request.method+request.path], _ = ioutil.ReadAll(res.Body)
+		res.Body.Close()
+	}
+	server.Close()
+
+	golden, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"Bearer secret", "medicplus", "session=secret", "3171", "api_key=secret"} {
+		if bytes.Contains(golden, []byte(secret)) {
+			t.Errorf("golden file contains %q", secret)
+		}
+	}
+
+	replayer := NewRecorder(file, ModeAuto)
+	if replayer.Recording() {
+		t.Fatalf("auto recorder recording an existing golden file")
+	}
+	replayer.RedactQueryParams = []string{"nik"}
+	replaying := &http.Client{Transport: replayer}
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		want    []byte
+		wantErr error
+	}{
+		{
+			name:   "redacted query replayed",
+			method: http.MethodGet,
+			path:   "/patients?nik=3172&api_key=other",
+			want:   recorded[http.MethodGet+"/patients?nik=3171&api_key=secret"],
+		},
+		{
+			name:   "request with body replayed",
+			method: http.MethodPost,
+			path:   "/patients",
+			body:   "budi",
+			want:   recorded[http.MethodPost+"/patients"],
+		},
+		{
+			name:   "request replayed again gets its last response",
+			method: http.MethodPost,
+			path:   "/patients",
+			body:   "budi",
+			want:   recorded[http.MethodPost+"/patients"],
+		},
+		{
+			name:   "binary body replayed",
+			method: http.MethodGet,
+			path:   "/binary",
+			want:   []byte{0xff, 0x00, 0xfe},
+		},
+		{
+			name:    "request with another body not recorded",
+			method:  http.MethodPost,
+			path:    "/patients",
+			body:    "siti",
+			wantErr: ErrNotRecorded,
+		},
+		{
+			name:    "request of another path not recorded",
+			method:  http.MethodGet,
+			path:    "/doctors",
+			wantErr: ErrNotRecorded,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, _ := http.NewRequest(test.method, server.URL+test.path, strings.NewReader(test.body))
+			res, err := replaying.Do(req)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("error = %v, want %v", err, test.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer res.Body.Close()
+
+			body, _ := ioutil.ReadAll(res.Body)
+			if res.StatusCode != http.StatusOK || !bytes.Equal(body, test.want) {
+				t.Errorf("response = %d %q, want 200 %q", res.StatusCode, body, test.want)
+			}
+		})
+	}
+}
+
+func TestRecorderInvalidGoldenFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "missing golden file"},
+		{name: "invalid golden file", content: "{"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "golden.json")
+			if test.content != "" {
+				if err := ioutil.WriteFile(file, []byte(test.content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			client := &http.Client{Transport: NewRecorder(file, ModeReplay)}
+			if _, err := client.Get("http://api.local/patients"); err == nil {
+				t.Errorf("request replayed from a %s", test.name)
+			}
+		})
+	}
+}
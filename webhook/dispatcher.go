@@ -0,0 +1,355 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/medicplus-inc/medicplus-kit/client"
+	"github.com/medicplus-inc/medicplus-kit/net/authentication/signature"
+)
+
+//
+// Private constants
+//
+
+const defaultMaxAttempts = 12
+const defaultMinDelay = 30 * time.Second
+const defaultMaxDelay = 4 * time.Hour
+const defaultAttemptTimeout = 30 * time.Second
+const defaultPollInterval = time.Second
+const defaultConcurrency = 10
+const defaultLease = 2 * time.Minute
+
+// signedHeaders are the webhook headers covered by the signature of the deliveries
+var signedHeaders = []string{"webhook-attempt", "webhook-delivery-id", "webhook-event-id", "webhook-event-type"}
+
+// DispatcherConfig represents the configuration of the dispatcher, zero values fall back to the defaults.
+//
+// With the defaults, a delivery is attempted 12 times with an exponential backoff from 30s up to 4h,
+// over about 12 hours, before being dead lettered.
+type DispatcherConfig struct {
+	// Client sends the deliveries, it should neither retry (the dispatcher retries the deliveries itself)
+	// nor sign its calls (the deliveries are signed with the secrets of their endpoints)
+	Client *client.HTTPClient
+	// Store is the persistent queue of the deliveries
+	Store Store
+	// Secrets provides the signing secrets of the endpoints, by endpoint id
+	Secrets signature.KeyStore
+	// MaxAttempts is the number of attempts of a delivery before it is dead lettered, 12 by default
+	MaxAttempts int
+	// MinDelay is the delay before the second attempt, doubled for every attempt, 30s by default
+	MinDelay time.Duration
+	// MaxDelay is the max delay between two attempts, 4h by default
+	MaxDelay time.Duration
+	// Timeout is the timeout of an attempt, 30s by default
+	Timeout time.Duration
+	// PollInterval is the delay between two claims of the due deliveries when the queue is drained, 1s by default
+	PollInterval time.Duration
+	// BatchSize is the max number of deliveries claimed at once, the Concurrency by default and at most;
+	// the deliveries are claimed only when a slot is free to send them right away
+	BatchSize int
+	// Concurrency is the max number of deliveries sent at once, 10 by default
+	Concurrency int
+	// Lease is how long a claimed delivery is hidden from the other dispatchers, 2 min by default;
+	// it must be longer than the time to send a batch, ceil(BatchSize/Concurrency) * Timeout
+	Lease time.Duration
+	// Logger receives the failures of the store, the standard logger by default
+	Logger client.Logger
+}
+
+// Dispatcher delivers the events to the endpoints through a persistent queue, so that the pending deliveries
+// survive the restarts, and signs them with the signature package: the key id of the signature is the endpoint id,
+// and the signature covers the payload along with the Webhook-* headers (see Receiver).
+//
+// The deliveries failing with a transport error or a non-2xx response are retried with backoff, the ones failing
+// MaxAttempts times or answered with 410 Gone are dead lettered. Every attempt is logged in the store.
+// The Idempotency-Key of the deliveries is their id, so that the receivers can drop the duplicates.
+type Dispatcher struct {
+	config DispatcherConfig
+}
+
+// NewDispatcher creates the dispatcher, it fails when the lease of the deliveries does not outlast their sending
+func NewDispatcher(config DispatcherConfig) (*Dispatcher, error) {
+	if config.MaxAttempts == 0 {
+		config.MaxAttempts = defaultMaxAttempts
+	}
+	if config.MinDelay == 0 {
+		config.MinDelay = defaultMinDelay
+	}
+	if config.MaxDelay == 0 {
+		config.MaxDelay = defaultMaxDelay
+	}
+	if config.Timeout == 0 {
+		config.Timeout = defaultAttemptTimeout
+	}
+	if config.PollInterval == 0 {
+		config.PollInterval = defaultPollInterval
+	}
+	if config.Concurrency == 0 {
+		config.Concurrency = defaultConcurrency
+	}
+	if config.BatchSize == 0 || config.BatchSize > config.Concurrency {
+		config.BatchSize = config.Concurrency
+	}
+	if config.Lease == 0 {
+		config.Lease = defaultLease
+	}
+	if config.Logger == nil {
+		config.Logger = client.NewStdLogger(nil)
+	}
+
+	batchTime := time.Duration((config.BatchSize+config.Concurrency-1)/config.Concurrency) * config.Timeout
+	if config.Lease <= batchTime {
+		return nil, fmt.Errorf("webhook: the lease %s must be longer than the time to send a batch %s", config.Lease, batchTime)
+	}
+
+	return &Dispatcher{
+		config: config,
+	}, nil
+}
+
+// Dispatch queues the deliveries of the event to the endpoints, it returns once they are stored
+func (d *Dispatcher) Dispatch(ctx context.Context, event Event, endpoints ...Endpoint) error {
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now().UTC()
+	}
+
+	payload, err := event.payload()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	deliveries := make([]Delivery, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		deliveries = append(deliveries, Delivery{
+			ID:            uuid.New().String(),
+			EventID:       event.ID,
+			EventType:     event.Type,
+			EndpointID:    endpoint.ID,
+			URL:           endpoint.URL,
+			Payload:       payload,
+			CreatedAt:     now,
+			NextAttemptAt: now,
+		})
+	}
+
+	return d.config.Store.Enqueue(ctx, deliveries...)
+}
+
+// Run sends the due deliveries until the context is done, it can run in several replicas sharing the store.
+// The deliveries are claimed as the slots of the Concurrency are freed, so that a claimed delivery is sent
+// right away and a slow endpoint only holds its own slot.
+// The deliveries in progress when the context is done are claimed again once their lease expired.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(d.config.PollInterval)
+	defer ticker.Stop()
+
+	slots := make(chan struct{}, d.config.Concurrency)
+	released := make(chan struct{}, 1)
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+
+	for {
+		// only this loop takes the slots, so the free ones stay free until they are taken below
+		free := d.config.Concurrency - len(slots)
+		if free > d.config.BatchSize {
+			free = d.config.BatchSize
+		}
+
+		claimed := 0
+		if free > 0 {
+			deliveries := d.claim(ctx, free)
+			for _, delivery := range deliveries {
+				slots <- struct{}{}
+				wg.Add(1)
+				go func(delivery Delivery) {
+					defer func() {
+						<-slots
+						select {
+						case released <- struct{}{}:
+						default:
+						}
+						wg.Done()
+					}()
+					d.deliver(ctx, delivery)
+				}(delivery)
+			}
+			claimed = len(deliveries)
+		}
+
+		// a full claim means that more deliveries may be due, claimed once a slot is free
+		if free > 0 && claimed == free && len(slots) < d.config.Concurrency && ctx.Err() == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-released:
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeadLetters returns the oldest dead letters
+func (d *Dispatcher) DeadLetters(ctx context.Context, limit int) ([]Delivery, error) {
+	return d.config.Store.DeadLetters(ctx, limit)
+}
+
+// Redrive queues the dead letter again
+func (d *Dispatcher) Redrive(ctx context.Context, deliveryID string) error {
+	return d.config.Store.Redrive(ctx, deliveryID, time.Now())
+}
+
+// Attempts returns the attempts of the deliveries of the event
+func (d *Dispatcher) Attempts(ctx context.Context, eventID string) ([]Attempt, error) {
+	return d.config.Store.Attempts(ctx, eventID)
+}
+
+// claim claims up to limit due deliveries
+func (d *Dispatcher) claim(ctx context.Context, limit int) []Delivery {
+	deliveries, err := d.config.Store.Claim(ctx, time.Now(), limit, d.config.Lease)
+	if err != nil {
+		if ctx.Err() == nil {
+			d.config.Logger.Log(ctx, client.LogLevelError, "Error claiming webhook deliveries", client.LogFields{"error": err})
+		}
+		return nil
+	}
+
+	return deliveries
+}
+
+// deliver sends the delivery and stores its outcome
+func (d *Dispatcher) deliver(ctx context.Context, delivery Delivery) {
+	attempt := Attempt{
+		DeliveryID:  delivery.ID,
+		EventID:     delivery.EventID,
+		EndpointID:  delivery.EndpointID,
+		URL:         delivery.URL,
+		Number:      delivery.Attempts + 1,
+		AttemptedAt: time.Now(),
+	}
+
+	attempt.StatusCode, attempt.Error = d.send(ctx, delivery, attempt.Number)
+	attempt.Duration = time.Since(attempt.AttemptedAt)
+	if ctx.Err() != nil {
+		// stopped, the delivery is claimed again once its lease expired
+		return
+	}
+
+	fields := client.LogFields{"delivery": delivery.ID, "event": delivery.EventID, "endpoint": delivery.EndpointID}
+	if err := d.config.Store.LogAttempt(ctx, attempt); err != nil {
+		d.config.Logger.Log(ctx, client.LogLevelWarn, "Error logging webhook attempt", client.LogFields{"delivery": delivery.ID, "error": err})
+	}
+
+	delivery.Attempts = attempt.Number
+	if attempt.Error == "" {
+		if err := d.config.Store.Complete(ctx, delivery); err != nil {
+			d.logStoreError(ctx, "Error completing webhook delivery", fields, err)
+		}
+		return
+	}
+
+	delivery.LastError = attempt.Error
+	if delivery.Attempts >= d.config.MaxAttempts || attempt.StatusCode == http.StatusGone {
+		delivery.NextAttemptAt = time.Now()
+		if err := d.config.Store.DeadLetter(ctx, delivery); err != nil {
+			d.logStoreError(ctx, "Error dead lettering webhook delivery", fields, err)
+			return
+		}
+		fields["error"] = attempt.Error
+		d.config.Logger.Log(ctx, client.LogLevelWarn, "Webhook delivery dead lettered", fields)
+		return
+	}
+
+	delivery.NextAttemptAt = time.Now().Add(d.backoff(delivery.Attempts))
+	if err := d.config.Store.Reschedule(ctx, delivery); err != nil {
+		d.logStoreError(ctx, "Error rescheduling webhook delivery", fields, err)
+	}
+}
+
+// logStoreError logs the failure to store the outcome of a delivery,
+// as warning when the delivery was claimed again by another dispatcher which takes it over
+func (d *Dispatcher) logStoreError(ctx context.Context, message string, fields client.LogFields, err error) {
+	fields["error"] = err
+	if errors.Is(err, ErrLeaseLost) {
+		d.config.Logger.Log(ctx, client.LogLevelWarn, "Webhook delivery lease lost", fields)
+		return
+	}
+
+	d.config.Logger.Log(ctx, client.LogLevelError, message, fields)
+}
+
+// send posts the payload of the delivery signed with the secret of its endpoint,
+// and returns the status code of the response and the error of the failed attempt
+func (d *Dispatcher) send(ctx context.Context, delivery Delivery, number int) (int, string) {
+	secret, err := d.config.Secrets.Secret(ctx, delivery.EndpointID)
+	if err != nil {
+		return 0, err.Error()
+	}
+	signer := signature.NewSigner(delivery.EndpointID, secret, signedHeaders...)
+
+	ctx = client.WithCallOptions(ctx,
+		client.WithTimeout(d.config.Timeout),
+		client.WithIdempotencyKey(delivery.ID),
+		client.WithMiddlewares(signing(signer, delivery, number)),
+	)
+	errDo := d.config.Client.CallClientWithBaseURLGiven(ctx, delivery.URL, client.POST, json.RawMessage(delivery.Payload), nil, false)
+	if errDo == nil {
+		return 0, ""
+	}
+	if err = errDo.Err(); err != nil {
+		return errDo.StatusCode, err.Error()
+	}
+
+	return errDo.StatusCode, ""
+}
+
+// backoff returns the delay before the next attempt of a delivery attempted the given number of times,
+// with a jitter of up to 10%
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.config.MaxDelay
+	if attempts <= 32 {
+		if exponential := d.config.MinDelay * time.Duration(1<<uint(attempts-1)); exponential > 0 && exponential < delay {
+			delay = exponential
+		}
+	}
+
+	return delay + time.Duration(rand.Int63n(int64(delay/10)+1))
+}
+
+// signing adds the webhook headers of the delivery to the call and signs it
+func signing(signer *signature.Signer, delivery Delivery, number int) client.Middleware {
+	return func(next client.Handler) client.Handler {
+		return func(ctx context.Context, call *client.Call) *client.ResponseError {
+			call.Header.Set(HeaderEventID, delivery.EventID)
+			call.Header.Set(HeaderEventType, delivery.EventType)
+			call.Header.Set(HeaderDeliveryID, delivery.ID)
+			call.Header.Set(HeaderAttempt, strconv.Itoa(number))
+
+			req, err := http.NewRequest(string(call.Method), call.URL, nil)
+			if err != nil {
+				return &client.ResponseError{
+					Error: err,
+				}
+			}
+			// the signature headers are set on the headers of the call
+			req.Header = call.Header
+			signer.Sign(req, call.Body)
+
+			return next(ctx, call)
+		}
+	}
+}
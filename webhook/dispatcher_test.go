@@ -0,0 +1,134 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/medicplus-inc/medicplus-kit/client"
+	"github.com/medicplus-inc/medicplus-kit/net/authentication/signature"
+)
+
+func TestNewDispatcherLease(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  DispatcherConfig
+		wantErr bool
+	}{
+		{name: "defaults", config: DispatcherConfig{}},
+		{name: "lease shorter than the timeout", config: DispatcherConfig{Timeout: time.Minute, Lease: 30 * time.Second}, wantErr: true},
+		{name: "lease equal to the timeout", config: DispatcherConfig{Timeout: time.Minute, Lease: time.Minute}, wantErr: true},
+		{name: "batch size capped at the concurrency", config: DispatcherConfig{Timeout: time.Minute, Lease: 90 * time.Second, BatchSize: 100, Concurrency: 5}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dispatcher, err := NewDispatcher(test.config)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("NewDispatcher() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if err == nil && dispatcher.config.BatchSize > dispatcher.config.Concurrency {
+				t.Errorf("BatchSize = %d, want at most the concurrency %d", dispatcher.config.BatchSize, dispatcher.config.Concurrency)
+			}
+		})
+	}
+}
+
+func TestDispatcherBackoff(t *testing.T) {
+	dispatcher, err := NewDispatcher(DispatcherConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: 30 * time.Second},
+		{attempts: 2, want: time.Minute},
+		{attempts: 3, want: 2 * time.Minute},
+		{attempts: 9, want: 128 * time.Minute},
+		{attempts: 10, want: 4 * time.Hour},
+		{attempts: 12, want: 4 * time.Hour},
+		{attempts: 100, want: 4 * time.Hour},
+	}
+
+	for _, test := range tests {
+		for i := 0; i < 20; i++ {
+			got := dispatcher.backoff(test.attempts)
+			if got < test.want || got > test.want+test.want/10 {
+				t.Fatalf("backoff(%d) = %s, want between %s and %s", test.attempts, got, test.want, test.want+test.want/10)
+			}
+		}
+	}
+}
+
+func TestDispatcherRun(t *testing.T) {
+	keys := signature.StaticKeyStore{"ok": []byte("s1"), "flaky": []byte("s2"), "gone": []byte("s3")}
+	verifier := signature.NewVerifier(signature.VerifierConfig{Keys: keys, Nonces: signature.NewMemoryNonceStore()})
+
+	var received, flaky int64
+	mux := http.NewServeMux()
+	mux.Handle("/ok", Receiver(verifier)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&received, 1)
+	})))
+	mux.Handle("/flaky", Receiver(verifier)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&flaky, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})))
+	mux.Handle("/gone", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	}))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	dispatcher, err := NewDispatcher(DispatcherConfig{
+		Client:       client.NewHTTPClient(client.HTTPClient{ClientName: "webhook", Logging: &client.LoggingConfig{Level: client.LogLevelOff}}, nil),
+		Store:        newTestRedisStore(t),
+		Secrets:      keys,
+		MinDelay:     10 * time.Millisecond,
+		MaxDelay:     20 * time.Millisecond,
+		PollInterval: 5 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	err = dispatcher.Dispatch(ctx, Event{ID: "e1", Type: "prescription.created", Data: map[string]int{"n": 1}},
+		Endpoint{ID: "ok", URL: server.URL + "/ok"},
+		Endpoint{ID: "flaky", URL: server.URL + "/flaky"},
+		Endpoint{ID: "gone", URL: server.URL + "/gone"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runCtx, stop := context.WithTimeout(ctx, time.Second)
+	defer stop()
+	dispatcher.Run(runCtx)
+
+	if received != 1 || flaky != 3 {
+		t.Errorf("received %d and %d flaky requests, want 1 and 3", received, flaky)
+	}
+
+	attempts, err := dispatcher.Attempts(ctx, "e1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attempts) != 5 {
+		t.Errorf("logged %d attempts, want 5", len(attempts))
+	}
+
+	dead, err := dispatcher.DeadLetters(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || dead[0].EndpointID != "gone" || dead[0].Attempts != 1 {
+		t.Fatalf("DeadLetters = %+v, want the delivery to the gone endpoint", dead)
+	}
+}
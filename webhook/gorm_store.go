@@ -0,0 +1,281 @@
+package webhook
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+//
+// Private constants
+//
+
+const deliveryStatusPending = "pending"
+const deliveryStatusDead = "dead"
+
+// deliveryModel represents a delivery in the webhook_deliveries table
+type deliveryModel struct {
+	ID            string `gorm:"primaryKey"`
+	EventID       string `gorm:"index"`
+	EventType     string
+	EndpointID    string
+	URL           string
+	Payload       []byte
+	Attempts      int
+	LastError     string
+	Status        string    `gorm:"index:idx_webhook_deliveries_due"`
+	NextAttemptAt time.Time `gorm:"index:idx_webhook_deliveries_due"`
+	// LeaseToken identifies the last claim of the delivery
+	LeaseToken string
+	CreatedAt  time.Time
+}
+
+// TableName returns the table of the deliveries
+func (deliveryModel) TableName() string {
+	return "webhook_deliveries"
+}
+
+// attemptModel represents an attempt in the webhook_attempts table
+type attemptModel struct {
+	ID          uint   `gorm:"primaryKey"`
+	DeliveryID  string `gorm:"index"`
+	EventID     string `gorm:"index"`
+	EndpointID  string
+	URL         string
+	Number      int
+	StatusCode  int
+	Error       string
+	Duration    time.Duration
+	AttemptedAt time.Time
+}
+
+// TableName returns the table of the attempts
+func (attemptModel) TableName() string {
+	return "webhook_attempts"
+}
+
+// GormStore is the store of the deliveries in the webhook_deliveries and webhook_attempts tables,
+// the deliveries being claimed with SELECT ... FOR UPDATE SKIP LOCKED (postgres)
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore creates the store in the database
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{
+		db: db,
+	}
+}
+
+// Migrate creates or updates the tables of the store
+func (g *GormStore) Migrate(ctx context.Context) error {
+	return g.db.WithContext(ctx).AutoMigrate(&deliveryModel{}, &attemptModel{})
+}
+
+// Enqueue inserts the deliveries
+func (g *GormStore) Enqueue(ctx context.Context, deliveries ...Delivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	models := make([]deliveryModel, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		models = append(models, toDeliveryModel(delivery, deliveryStatusPending))
+	}
+
+	return g.db.WithContext(ctx).Create(&models).Error
+}
+
+// Claim locks the due deliveries skipping the ones locked by the other claims, and moves them to the end of the lease
+// with a new lease token
+func (g *GormStore) Claim(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]Delivery, error) {
+	token := uuid.New().String()
+	deliveries := []Delivery{}
+	err := g.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		models := []deliveryModel{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", deliveryStatusPending, now).
+			Order("next_attempt_at").
+			Limit(limit).
+			Find(&models).Error
+		if err != nil || len(models) == 0 {
+			return err
+		}
+
+		ids := make([]string, 0, len(models))
+		for _, model := range models {
+			ids = append(ids, model.ID)
+			delivery := model.delivery()
+			delivery.Lease = token
+			deliveries = append(deliveries, delivery)
+		}
+
+		return tx.Model(&deliveryModel{}).Where("id IN ?", ids).
+			Updates(map[string]interface{}{"next_attempt_at": now.Add(lease), "lease_token": token}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// Reschedule updates the delivery when it still holds its lease
+func (g *GormStore) Reschedule(ctx context.Context, delivery Delivery) error {
+	return g.updateLeased(ctx, delivery, map[string]interface{}{
+		"attempts":        delivery.Attempts,
+		"last_error":      delivery.LastError,
+		"next_attempt_at": delivery.NextAttemptAt,
+		"lease_token":     "",
+	})
+}
+
+// Complete deletes the delivery when it still holds its lease
+func (g *GormStore) Complete(ctx context.Context, delivery Delivery) error {
+	result := g.db.WithContext(ctx).Where("id = ? AND lease_token = ?", delivery.ID, delivery.Lease).Delete(&deliveryModel{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrLeaseLost
+	}
+
+	return nil
+}
+
+// DeadLetter updates the delivery as dead when it still holds its lease
+func (g *GormStore) DeadLetter(ctx context.Context, delivery Delivery) error {
+	return g.updateLeased(ctx, delivery, map[string]interface{}{
+		"status":          deliveryStatusDead,
+		"attempts":        delivery.Attempts,
+		"last_error":      delivery.LastError,
+		"next_attempt_at": delivery.NextAttemptAt,
+		"lease_token":     "",
+	})
+}
+
+// DeadLetters returns the oldest dead deliveries
+func (g *GormStore) DeadLetters(ctx context.Context, limit int) ([]Delivery, error) {
+	models := []deliveryModel{}
+	err := g.db.WithContext(ctx).
+		Where("status = ?", deliveryStatusDead).
+		Order("next_attempt_at").
+		Limit(limit).
+		Find(&models).Error
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]Delivery, 0, len(models))
+	for _, model := range models {
+		deliveries = append(deliveries, model.delivery())
+	}
+
+	return deliveries, nil
+}
+
+// Redrive updates the dead delivery as pending
+func (g *GormStore) Redrive(ctx context.Context, deliveryID string, now time.Time) error {
+	result := g.db.WithContext(ctx).Model(&deliveryModel{}).
+		Where("id = ? AND status = ?", deliveryID, deliveryStatusDead).
+		Updates(map[string]interface{}{"status": deliveryStatusPending, "next_attempt_at": now, "attempts": 0, "lease_token": ""})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrDeliveryNotFound
+	}
+
+	return nil
+}
+
+// LogAttempt inserts the attempt
+func (g *GormStore) LogAttempt(ctx context.Context, attempt Attempt) error {
+	model := attemptModel{
+		DeliveryID:  attempt.DeliveryID,
+		EventID:     attempt.EventID,
+		EndpointID:  attempt.EndpointID,
+		URL:         attempt.URL,
+		Number:      attempt.Number,
+		StatusCode:  attempt.StatusCode,
+		Error:       attempt.Error,
+		Duration:    attempt.Duration,
+		AttemptedAt: attempt.AttemptedAt,
+	}
+
+	return g.db.WithContext(ctx).Create(&model).Error
+}
+
+// Attempts returns the attempts of the event
+func (g *GormStore) Attempts(ctx context.Context, eventID string) ([]Attempt, error) {
+	models := []attemptModel{}
+	if err := g.db.WithContext(ctx).Where("event_id = ?", eventID).Order("id").Find(&models).Error; err != nil {
+		return nil, err
+	}
+
+	attempts := make([]Attempt, 0, len(models))
+	for _, model := range models {
+		attempts = append(attempts, Attempt{
+			DeliveryID:  model.DeliveryID,
+			EventID:     model.EventID,
+			EndpointID:  model.EndpointID,
+			URL:         model.URL,
+			Number:      model.Number,
+			StatusCode:  model.StatusCode,
+			Error:       model.Error,
+			Duration:    model.Duration,
+			AttemptedAt: model.AttemptedAt,
+		})
+	}
+
+	return attempts, nil
+}
+
+// updateLeased updates the pending delivery whose lease token is still the lease of the delivery
+func (g *GormStore) updateLeased(ctx context.Context, delivery Delivery, values map[string]interface{}) error {
+	result := g.db.WithContext(ctx).Model(&deliveryModel{}).
+		Where("id = ? AND status = ? AND lease_token = ?", delivery.ID, deliveryStatusPending, delivery.Lease).
+		Updates(values)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrLeaseLost
+	}
+
+	return nil
+}
+
+func toDeliveryModel(delivery Delivery, status string) deliveryModel {
+	return deliveryModel{
+		ID:            delivery.ID,
+		EventID:       delivery.EventID,
+		EventType:     delivery.EventType,
+		EndpointID:    delivery.EndpointID,
+		URL:           delivery.URL,
+		Payload:       delivery.Payload,
+		Attempts:      delivery.Attempts,
+		LastError:     delivery.LastError,
+		Status:        status,
+		NextAttemptAt: delivery.NextAttemptAt,
+		CreatedAt:     delivery.CreatedAt,
+	}
+}
+
+func (model deliveryModel) delivery() Delivery {
+	return Delivery{
+		ID:            model.ID,
+		EventID:       model.EventID,
+		EventType:     model.EventType,
+		EndpointID:    model.EndpointID,
+		URL:           model.URL,
+		Payload:       model.Payload,
+		Attempts:      model.Attempts,
+		LastError:     model.LastError,
+		CreatedAt:     model.CreatedAt,
+		NextAttemptAt: model.NextAttemptAt,
+	}
+}
@@ -0,0 +1,101 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	libError "github.com/medicplus-inc/medicplus-kit/error"
+	"github.com/medicplus-inc/medicplus-kit/net/authentication/signature"
+	"github.com/medicplus-inc/medicplus-kit/net/http/encoding"
+)
+
+// ErrInvalidEvent is returned for the webhook requests whose event is missing or does not match their headers
+var ErrInvalidEvent = errors.New("webhook: invalid event")
+
+// ReceivedEvent represents the event of a verified webhook request
+type ReceivedEvent struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	Data       json.RawMessage `json:"data"`
+	DeliveryID string          `json:"-"`
+	// EndpointID is the key id of the signature of the request
+	EndpointID string `json:"-"`
+}
+
+// receivedEventKey is the context key of the event of a verified webhook request
+type receivedEventKey struct{}
+
+// Receiver rejects with 401 the webhook requests whose signature is missing, invalid, outside the clock skew window
+// of the verifier or replayed when the verifier has a nonce store, and with 400 the ones without a valid event.
+// The event of the verified requests is stored in the context (see EventFromContext).
+//
+// The secrets of the key store of the verifier are the secrets of the endpoints, by endpoint id.
+// A delivery can be received more than once: its id is sent as Idempotency-Key, so that the receiver can be wrapped
+// with the Idempotency middleware of net/http/middleware, or the events can be deduplicated by id.
+func Receiver(verifier *signature.Verifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			body, err := verifier.ReadBody(w, r)
+			if err != nil {
+				status := http.StatusBadRequest
+				if errors.Is(err, signature.ErrBodyTooLarge) {
+					status = http.StatusRequestEntityTooLarge
+				}
+				encoding.EncodeError(ctx, libError.New(err, status, "Invalid request body"), w)
+				return
+			}
+
+			if err := verifier.Verify(r, body); err != nil {
+				status := http.StatusUnauthorized
+				if !isSignatureError(err) {
+					status = http.StatusInternalServerError
+				}
+				encoding.EncodeError(ctx, libError.New(err, status, "Invalid webhook signature"), w)
+				return
+			}
+
+			var event ReceivedEvent
+			if err := json.Unmarshal(body, &event); err != nil || event.ID == "" ||
+				event.ID != r.Header.Get(HeaderEventID) || event.Type != r.Header.Get(HeaderEventType) {
+				encoding.EncodeError(ctx, libError.New(ErrInvalidEvent, http.StatusBadRequest, "Invalid webhook event"), w)
+				return
+			}
+			event.DeliveryID = r.Header.Get(HeaderDeliveryID)
+			event.EndpointID = r.Header.Get(signature.HeaderKeyID)
+
+			ctx = context.WithValue(ctx, receivedEventKey{}, event)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// EventFromContext returns the event of the webhook request verified by the Receiver
+func EventFromContext(ctx context.Context) (ReceivedEvent, bool) {
+	event, ok := ctx.Value(receivedEventKey{}).(ReceivedEvent)
+	return event, ok
+}
+
+// isSignatureError reports whether the error is a rejection of the signature rather than a failure of the verifier
+func isSignatureError(err error) bool {
+	for _, signatureErr := range []error{
+		signature.ErrMissingSignature,
+		signature.ErrUnknownKey,
+		signature.ErrExpiredSignature,
+		signature.ErrDigestMismatch,
+		signature.ErrInvalidSignature,
+		signature.ErrReplayedRequest,
+		signature.ErrUnsignedHeader,
+	} {
+		if errors.Is(err, signatureErr) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,91 @@
+package webhook
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/medicplus-inc/medicplus-kit/net/authentication/signature"
+)
+
+func TestReceiver(t *testing.T) {
+	secret := []byte("secret")
+	body := []byte(`{"id":"e1","type":"prescription.created","createdAt":"2021-01-01T00:00:00Z","data":{"n":1}}`)
+
+	newRequest := func(eventType string, payload []byte) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(payload))
+		req.Header.Set(HeaderEventID, "e1")
+		req.Header.Set(HeaderEventType, eventType)
+		req.Header.Set(HeaderDeliveryID, "d1")
+		req.Header.Set(HeaderAttempt, "1")
+		signature.NewSigner("endpoint", secret, signedHeaders...).Sign(req, payload)
+		return req
+	}
+
+	tests := []struct {
+		name       string
+		request    func() *http.Request
+		wantStatus int
+	}{
+		{
+			name:       "signed",
+			request:    func() *http.Request { return newRequest("prescription.created", body) },
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "unsigned",
+			request:    func() *http.Request { return httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(body)) },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "tampered body",
+			request: func() *http.Request {
+				req := newRequest("prescription.created", body)
+				req.Body = io.NopCloser(bytes.NewReader(bytes.Replace(body, []byte(`"n":1`), []byte(`"n":2`), 1)))
+				return req
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "tampered event header",
+			request: func() *http.Request {
+				req := newRequest("prescription.created", body)
+				req.Header.Set(HeaderEventType, "prescription.deleted")
+				return req
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "event not matching its headers",
+			request:    func() *http.Request { return newRequest("prescription.deleted", body) },
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			verifier := signature.NewVerifier(signature.VerifierConfig{Keys: signature.StaticKeyStore{"endpoint": secret}})
+
+			var received ReceivedEvent
+			handler := Receiver(verifier)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received, _ = EventFromContext(r.Context())
+			}))
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, test.request())
+
+			if recorder.Code != test.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, test.wantStatus)
+			}
+			if test.wantStatus != http.StatusOK {
+				return
+			}
+			if received.ID != "e1" || received.Type != "prescription.created" || string(received.Data) != `{"n":1}` ||
+				received.DeliveryID != "d1" || received.EndpointID != "endpoint" {
+				t.Errorf("received %+v, want the signed event", received)
+			}
+		})
+	}
+}
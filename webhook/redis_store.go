@@ -0,0 +1,300 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// DefaultRedisWebhookPrefix is the prefix of the keys of the redis store
+const DefaultRedisWebhookPrefix = "webhook:"
+
+//
+// Private constants
+//
+
+const defaultAttemptLogTTL = 30 * 24 * time.Hour
+
+// claimScript leases up to ARGV[2] deliveries of the queue due at ARGV[1] until ARGV[3] and returns their ids
+const claimScript = `
+local ids = redis.call("zrangebyscore", KEYS[1], "-inf", ARGV[1], "limit", 0, ARGV[2])
+for _, id in ipairs(ids) do
+	redis.call("zadd", KEYS[1], ARGV[3], id)
+end
+return ids
+`
+
+// rescheduleScript stores the delivery ARGV[3] of the id ARGV[1] due at ARGV[4],
+// when the delivery is still leased until ARGV[2] in the queue
+const rescheduleScript = `
+if tonumber(redis.call("zscore", KEYS[1], ARGV[1])) ~= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call("hset", KEYS[2], ARGV[1], ARGV[3])
+redis.call("zadd", KEYS[1], ARGV[4], ARGV[1])
+return 1
+`
+
+// completeScript removes the delivery of the id ARGV[1], when it is still leased until ARGV[2] in the queue
+const completeScript = `
+if tonumber(redis.call("zscore", KEYS[1], ARGV[1])) ~= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call("zrem", KEYS[1], ARGV[1])
+redis.call("hdel", KEYS[2], ARGV[1])
+return 1
+`
+
+// deadLetterScript stores the delivery ARGV[3] of the id ARGV[1] and moves it to the dead letters at ARGV[4],
+// when it is still leased until ARGV[2] in the queue
+const deadLetterScript = `
+if tonumber(redis.call("zscore", KEYS[1], ARGV[1])) ~= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call("hset", KEYS[2], ARGV[1], ARGV[3])
+redis.call("zrem", KEYS[1], ARGV[1])
+redis.call("zadd", KEYS[3], ARGV[4], ARGV[1])
+return 1
+`
+
+// redriveScript moves the dead letter of the id ARGV[1] back to the queue due at ARGV[2], with its attempts reset
+// and its next attempt at the json time ARGV[3], and returns 0 when it does not exist
+const redriveScript = `
+if not redis.call("zscore", KEYS[1], ARGV[1]) then
+	return 0
+end
+local stored = redis.call("hget", KEYS[2], ARGV[1])
+if not stored then
+	return 0
+end
+local delivery = cjson.decode(stored)
+delivery["attempts"] = 0
+delivery["nextAttemptAt"] = ARGV[3]
+redis.call("hset", KEYS[2], ARGV[1], cjson.encode(delivery))
+redis.call("zrem", KEYS[1], ARGV[1])
+redis.call("zadd", KEYS[3], ARGV[2], ARGV[1])
+return 1
+`
+
+// RedisStore is the store of the deliveries in redis: the queue and the dead letters are sorted sets of the ids
+// of the deliveries stored in a hash, and the attempts of an event are a list expiring after the AttemptLogTTL
+type RedisStore struct {
+	redisClient *redis.Client
+	prefix      string
+	// AttemptLogTTL is how long the attempts of an event are kept after its last attempt, 30 days by default
+	AttemptLogTTL time.Duration
+}
+
+// NewRedisStore creates the store in redis, DefaultRedisWebhookPrefix is used when the prefix is empty
+func NewRedisStore(redisClient *redis.Client, prefix string) *RedisStore {
+	if prefix == "" {
+		prefix = DefaultRedisWebhookPrefix
+	}
+
+	return &RedisStore{
+		redisClient:   redisClient,
+		prefix:        prefix,
+		AttemptLogTTL: defaultAttemptLogTTL,
+	}
+}
+
+// Enqueue stores the deliveries and adds them to the queue
+func (r *RedisStore) Enqueue(ctx context.Context, deliveries ...Delivery) error {
+	_, err := r.redisClient.WithContext(ctx).TxPipelined(func(pipe redis.Pipeliner) error {
+		for _, delivery := range deliveries {
+			if err := r.save(pipe, delivery); err != nil {
+				return err
+			}
+			pipe.ZAdd(r.key("queue"), redis.Z{Score: score(delivery.NextAttemptAt), Member: delivery.ID})
+		}
+		return nil
+	})
+
+	return err
+}
+
+// Claim leases the deliveries due at now with a script, so that concurrent claims never return the same delivery.
+// The lease of the deliveries is their score in the queue until the lease expires.
+func (r *RedisStore) Claim(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]Delivery, error) {
+	leasedUntil := score(now.Add(lease))
+	result, err := r.redisClient.WithContext(ctx).Eval(claimScript, []string{r.key("queue")},
+		score(now), limit, leasedUntil).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	values, _ := result.([]interface{})
+	for _, value := range values {
+		if id, ok := value.(string); ok {
+			ids = append(ids, id)
+		}
+	}
+
+	deliveries, err := r.load(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range deliveries {
+		deliveries[i].Lease = strconv.FormatFloat(leasedUntil, 'f', -1, 64)
+	}
+
+	return deliveries, nil
+}
+
+// Reschedule stores the delivery and moves it in the queue to its next attempt
+func (r *RedisStore) Reschedule(ctx context.Context, delivery Delivery) error {
+	value, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+
+	return leased(r.redisClient.WithContext(ctx).Eval(rescheduleScript, []string{r.key("queue"), r.key("deliveries")},
+		delivery.ID, delivery.Lease, value, score(delivery.NextAttemptAt)))
+}
+
+// Complete removes the delivery
+func (r *RedisStore) Complete(ctx context.Context, delivery Delivery) error {
+	return leased(r.redisClient.WithContext(ctx).Eval(completeScript, []string{r.key("queue"), r.key("deliveries")},
+		delivery.ID, delivery.Lease))
+}
+
+// DeadLetter moves the delivery from the queue to the dead letters
+func (r *RedisStore) DeadLetter(ctx context.Context, delivery Delivery) error {
+	value, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+
+	return leased(r.redisClient.WithContext(ctx).Eval(deadLetterScript, []string{r.key("queue"), r.key("deliveries"), r.key("dead")},
+		delivery.ID, delivery.Lease, value, score(delivery.NextAttemptAt)))
+}
+
+// DeadLetters returns the oldest dead letters
+func (r *RedisStore) DeadLetters(ctx context.Context, limit int) ([]Delivery, error) {
+	ids, err := r.redisClient.WithContext(ctx).ZRange(r.key("dead"), 0, int64(limit)-1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.load(ctx, ids)
+}
+
+// Redrive moves the dead letter back to the queue with a script
+func (r *RedisStore) Redrive(ctx context.Context, deliveryID string, now time.Time) error {
+	nextAttemptAt, err := now.MarshalText()
+	if err != nil {
+		return err
+	}
+
+	redriven, err := r.redisClient.WithContext(ctx).Eval(redriveScript, []string{r.key("dead"), r.key("deliveries"), r.key("queue")},
+		deliveryID, score(now), string(nextAttemptAt)).Int64()
+	if err != nil {
+		return err
+	}
+	if redriven == 0 {
+		return ErrDeliveryNotFound
+	}
+
+	return nil
+}
+
+// LogAttempt appends the attempt to the attempts of its event
+func (r *RedisStore) LogAttempt(ctx context.Context, attempt Attempt) error {
+	value, err := json.Marshal(attempt)
+	if err != nil {
+		return err
+	}
+
+	key := r.key("attempts:" + attempt.EventID)
+	_, err = r.redisClient.WithContext(ctx).TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.RPush(key, value)
+		pipe.Expire(key, r.AttemptLogTTL)
+		return nil
+	})
+
+	return err
+}
+
+// Attempts returns the attempts of the event
+func (r *RedisStore) Attempts(ctx context.Context, eventID string) ([]Attempt, error) {
+	values, err := r.redisClient.WithContext(ctx).LRange(r.key("attempts:"+eventID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := make([]Attempt, 0, len(values))
+	for _, value := range values {
+		var attempt Attempt
+		if err = json.Unmarshal([]byte(value), &attempt); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, attempt)
+	}
+
+	return attempts, nil
+}
+
+func (r *RedisStore) key(name string) string {
+	return r.prefix + name
+}
+
+// leased returns ErrLeaseLost when the script updating a leased delivery did not find its lease
+func leased(cmd *redis.Cmd) error {
+	updated, err := cmd.Int64()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrLeaseLost
+	}
+
+	return nil
+}
+
+// save stores the delivery in the hash of the deliveries
+func (r *RedisStore) save(pipe redis.Pipeliner, delivery Delivery) error {
+	value, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+
+	pipe.HSet(r.key("deliveries"), delivery.ID, value)
+	return nil
+}
+
+// load returns the stored deliveries of the ids, skipping the ones removed meanwhile
+func (r *RedisStore) load(ctx context.Context, ids []string) ([]Delivery, error) {
+	if len(ids) == 0 {
+		return []Delivery{}, nil
+	}
+
+	values, err := r.redisClient.WithContext(ctx).HMGet(r.key("deliveries"), ids...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]Delivery, 0, len(values))
+	for _, value := range values {
+		stored, ok := value.(string)
+		if !ok {
+			continue
+		}
+
+		var delivery Delivery
+		if err = json.Unmarshal([]byte(stored), &delivery); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, nil
+}
+
+// score returns the time in ms, the score of the sorted sets
+func score(t time.Time) float64 {
+	return float64(t.UnixNano() / int64(time.Millisecond))
+}
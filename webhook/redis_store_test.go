@@ -0,0 +1,164 @@
+package webhook
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+)
+
+func newTestRedisStore(t *testing.T) *RedisStore {
+	server := miniredis.RunT(t)
+	redisClient := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { redisClient.Close() })
+
+	return NewRedisStore(redisClient, "")
+}
+
+func TestRedisStoreClaimLease(t *testing.T) {
+	ctx := context.Background()
+	store := newTestRedisStore(t)
+	now := time.Now()
+
+	if err := store.Enqueue(ctx, Delivery{ID: "d1", EventID: "e1", NextAttemptAt: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := store.Claim(ctx, now, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 1 || first[0].ID != "d1" || first[0].Lease == "" {
+		t.Fatalf("claimed %+v, want d1 with a lease", first)
+	}
+
+	hidden, err := store.Claim(ctx, now.Add(30*time.Second), 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hidden) != 0 {
+		t.Fatalf("claimed %+v during the lease, want none", hidden)
+	}
+
+	second, err := store.Claim(ctx, now.Add(2*time.Minute), 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second) != 1 || second[0].Lease == first[0].Lease {
+		t.Fatalf("claimed %+v after the lease expired, want d1 with a new lease", second)
+	}
+
+	stale := first[0]
+	stale.NextAttemptAt = now.Add(time.Hour)
+	if err = store.Reschedule(ctx, stale); err != ErrLeaseLost {
+		t.Errorf("Reschedule with a stale lease = %v, want ErrLeaseLost", err)
+	}
+	if err = store.DeadLetter(ctx, stale); err != ErrLeaseLost {
+		t.Errorf("DeadLetter with a stale lease = %v, want ErrLeaseLost", err)
+	}
+	if err = store.Complete(ctx, stale); err != ErrLeaseLost {
+		t.Errorf("Complete with a stale lease = %v, want ErrLeaseLost", err)
+	}
+
+	if err = store.Complete(ctx, second[0]); err != nil {
+		t.Fatalf("Complete with the current lease = %v", err)
+	}
+	remaining, err := store.Claim(ctx, now.Add(time.Hour), 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remaining) != 0 {
+		t.Fatalf("claimed %+v after completion, want none", remaining)
+	}
+}
+
+func TestRedisStoreReschedule(t *testing.T) {
+	ctx := context.Background()
+	store := newTestRedisStore(t)
+	now := time.Now()
+
+	if err := store.Enqueue(ctx, Delivery{ID: "d1", NextAttemptAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	claimed, err := store.Claim(ctx, now, 10, time.Minute)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("Claim = %+v, %v", claimed, err)
+	}
+
+	delivery := claimed[0]
+	delivery.Attempts = 1
+	delivery.LastError = "503 Service Unavailable"
+	delivery.NextAttemptAt = now.Add(10 * time.Second)
+	if err = store.Reschedule(ctx, delivery); err != nil {
+		t.Fatal(err)
+	}
+
+	early, err := store.Claim(ctx, now.Add(5*time.Second), 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(early) != 0 {
+		t.Fatalf("claimed %+v before its next attempt, want none", early)
+	}
+
+	due, err := store.Claim(ctx, now.Add(10*time.Second), 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 1 || due[0].Attempts != 1 || due[0].LastError != delivery.LastError {
+		t.Fatalf("claimed %+v at its next attempt, want the rescheduled delivery", due)
+	}
+}
+
+func TestRedisStoreRedrive(t *testing.T) {
+	ctx := context.Background()
+	store := newTestRedisStore(t)
+	now := time.Now()
+
+	if err := store.Enqueue(ctx, Delivery{ID: "d1", NextAttemptAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	claimed, err := store.Claim(ctx, now, 10, time.Minute)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("Claim = %+v, %v", claimed, err)
+	}
+
+	delivery := claimed[0]
+	delivery.Attempts = 12
+	delivery.NextAttemptAt = now
+	if err = store.DeadLetter(ctx, delivery); err != nil {
+		t.Fatal(err)
+	}
+
+	dead, err := store.DeadLetters(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dead) != 1 || dead[0].ID != "d1" || dead[0].Attempts != 12 {
+		t.Fatalf("DeadLetters = %+v, want d1", dead)
+	}
+
+	redrivenAt := now.Add(time.Hour)
+	if err = store.Redrive(ctx, "d1", redrivenAt); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Redrive(ctx, "d1", redrivenAt); err != ErrDeliveryNotFound {
+		t.Errorf("Redrive of a redriven delivery = %v, want ErrDeliveryNotFound", err)
+	}
+	if err = store.Redrive(ctx, "unknown", redrivenAt); err != ErrDeliveryNotFound {
+		t.Errorf("Redrive of an unknown delivery = %v, want ErrDeliveryNotFound", err)
+	}
+
+	if dead, err = store.DeadLetters(ctx, 10); err != nil || len(dead) != 0 {
+		t.Fatalf("DeadLetters = %+v, %v, want none", dead, err)
+	}
+	due, err := store.Claim(ctx, redrivenAt, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 1 || due[0].Attempts != 0 || !due[0].NextAttemptAt.Equal(redrivenAt) {
+		t.Fatalf("claimed %+v, want d1 with its attempts reset", due)
+	}
+}
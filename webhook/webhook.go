@@ -0,0 +1,105 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Headers of the webhook requests, signed along with the payload
+const (
+	HeaderEventID    = "Webhook-Event-Id"
+	HeaderEventType  = "Webhook-Event-Type"
+	HeaderDeliveryID = "Webhook-Delivery-Id"
+	HeaderAttempt    = "Webhook-Attempt"
+)
+
+// Errors of the store
+var (
+	// ErrDeliveryNotFound is returned when the delivery does not exist in the store
+	ErrDeliveryNotFound = errors.New("webhook: delivery not found")
+	// ErrLeaseLost is returned when the delivery is updated after its lease expired and it was claimed again
+	ErrLeaseLost = errors.New("webhook: delivery lease lost")
+)
+
+// Event represents an event pushed to the endpoints of the partners
+type Event struct {
+	// ID identifies the event, generated when empty
+	ID string `json:"id"`
+	// Type is the type of the event, e.g. "prescription.created"
+	Type string `json:"type"`
+	// CreatedAt is the time of the event, now when zero
+	CreatedAt time.Time `json:"createdAt"`
+	// Data is the payload of the event, encoded to json
+	Data interface{} `json:"data"`
+}
+
+// Endpoint represents the url of a partner receiving the events
+type Endpoint struct {
+	// ID identifies the endpoint, it is the key id of the signatures of its deliveries
+	ID  string
+	URL string
+}
+
+// Delivery represents an event to deliver to an endpoint
+type Delivery struct {
+	ID         string    `json:"id"`
+	EventID    string    `json:"eventId"`
+	EventType  string    `json:"eventType"`
+	EndpointID string    `json:"endpointId"`
+	URL        string    `json:"url"`
+	Payload    []byte    `json:"payload"`
+	Attempts   int       `json:"attempts"`
+	LastError  string    `json:"lastError"`
+	CreatedAt  time.Time `json:"createdAt"`
+	// NextAttemptAt is when the delivery is due, or when it was dead lettered
+	NextAttemptAt time.Time `json:"nextAttemptAt"`
+	// Lease identifies the claim of the delivery, set by Claim and checked by the updates of the delivery
+	Lease string `json:"-"`
+}
+
+// Attempt represents an attempt to send a delivery
+type Attempt struct {
+	DeliveryID  string        `json:"deliveryId"`
+	EventID     string        `json:"eventId"`
+	EndpointID  string        `json:"endpointId"`
+	URL         string        `json:"url"`
+	Number      int           `json:"number"`
+	StatusCode  int           `json:"statusCode"`
+	Error       string        `json:"error"`
+	Duration    time.Duration `json:"duration"`
+	AttemptedAt time.Time     `json:"attemptedAt"`
+}
+
+// Store represents the persistent queue of the deliveries, with their dead letters and the log of their attempts
+type Store interface {
+	// Enqueue adds the deliveries to the queue
+	Enqueue(ctx context.Context, deliveries ...Delivery) error
+	// Claim returns up to limit deliveries due at now and hides them from the other claims for the lease,
+	// so that a delivery whose dispatcher died is claimed again once its lease expired.
+	// The Lease of the returned deliveries identifies the claim.
+	Claim(ctx context.Context, now time.Time, limit int, lease time.Duration) ([]Delivery, error)
+	// Reschedule stores the claimed delivery to be claimed again at its NextAttemptAt,
+	// ErrLeaseLost when it was claimed again meanwhile
+	Reschedule(ctx context.Context, delivery Delivery) error
+	// Complete removes the claimed delivery from the queue, ErrLeaseLost when it was claimed again meanwhile
+	Complete(ctx context.Context, delivery Delivery) error
+	// DeadLetter moves the claimed delivery from the queue to the dead letters,
+	// ErrLeaseLost when it was claimed again meanwhile
+	DeadLetter(ctx context.Context, delivery Delivery) error
+	// DeadLetters returns up to limit dead letters, the oldest first
+	DeadLetters(ctx context.Context, limit int) ([]Delivery, error)
+	// Redrive moves the dead letter back to the queue, due at now and with its attempts reset,
+	// ErrDeliveryNotFound when it does not exist
+	Redrive(ctx context.Context, deliveryID string, now time.Time) error
+	// LogAttempt adds the attempt to the log
+	LogAttempt(ctx context.Context, attempt Attempt) error
+	// Attempts returns the attempts of the deliveries of the event, in their order
+	Attempts(ctx context.Context, eventID string) ([]Attempt, error)
+}
+
+// payload encodes the event sent to the endpoints
+func (e Event) payload() ([]byte, error) {
+	return json.Marshal(e)
+}